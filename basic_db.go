@@ -2,7 +2,6 @@ package yabf
 
 import (
 	"fmt"
-	g "github.com/hhkbp2/yabf/generator"
 	"strconv"
 	"strings"
 	"time"
@@ -48,7 +47,7 @@ func (self *BasicDB) Delay() {
 	if self.toDelay > 0 {
 		var nanos int64
 		if self.randomizeDelay {
-			nanos = MillisecondToNanosecond(g.NextInt64(self.toDelay))
+			nanos = MillisecondToNanosecond(self.GetRandom().Int63n(self.toDelay))
 			if nanos == 0 {
 				return
 			}
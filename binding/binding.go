@@ -8,4 +8,13 @@ func AddBindings() {
 	yabf.Databases["mysql"] = func() yabf.DB {
 		return NewMysqlDB()
 	}
+	yabf.Databases["postgres"] = func() yabf.DB {
+		return NewPostgresDB()
+	}
+	yabf.Databases["sqlite"] = func() yabf.DB {
+		return NewSqliteDB()
+	}
+	yabf.Databases["bolt"] = func() yabf.DB {
+		return NewBoltDB()
+	}
 }
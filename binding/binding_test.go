@@ -0,0 +1,122 @@
+package binding
+
+import (
+	"context"
+	"fmt"
+	"github.com/hhkbp2/testify/require"
+	"github.com/hhkbp2/yabf"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Check the operations which all the bindings agree on against db, whose
+// table is empty and has the fields "field0" and "field1".
+func testBinding(t *testing.T, db yabf.DB, table string) {
+	values := yabf.KVMap{"field0": yabf.Binary("a"), "field1": yabf.Binary("b")}
+	require.Equal(t, yabf.StatusOK, db.Insert(table, "k1", values))
+	require.Equal(t, yabf.StatusError, db.Insert(table, "k1", values))
+	ret, status := db.Read(table, "k1", []string{"field1"})
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, yabf.KVMap{"field1": yabf.Binary("b")}, ret)
+	_, status = db.Read(table, "k0", nil)
+	require.Equal(t, yabf.StatusNotFound, status)
+	require.Equal(t, yabf.StatusOK, db.Update(table, "k1", yabf.KVMap{"field0": yabf.Binary("c")}))
+	ret, status = db.Read(table, "k1", nil)
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, yabf.KVMap{"field0": yabf.Binary("c"), "field1": yabf.Binary("b")}, ret)
+
+	batchDB, ok := db.(yabf.BatchDB)
+	require.True(t, ok)
+	require.Equal(t, yabf.StatusOK, batchDB.BatchInsert(table, []string{"k3", "k2"}, []yabf.KVMap{values, values}))
+	// the batch is inserted all or nothing
+	require.Equal(t, yabf.StatusError, batchDB.BatchInsert(table, []string{"k4", "k2"}, []yabf.KVMap{values, values}))
+	rets, status := db.Scan(table, "k1", 2, []string{"field0"})
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, []yabf.KVMap{{"field0": yabf.Binary("c")}, {"field0": yabf.Binary("a")}}, rets)
+	rets, status = db.Scan(table, "k1", 1, nil)
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, []yabf.KVMap{{"field0": yabf.Binary("c"), "field1": yabf.Binary("b")}}, rets)
+	rets, status = db.Scan(table, "k1", 0, nil)
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, 0, len(rets))
+	_, status = db.Scan(table, "k1", -1, nil)
+	require.Equal(t, yabf.StatusBadRequest, status)
+	rets, status = batchDB.MultiRead(table, []string{"k4", "k3", "k0", "k1"}, []string{"field0"})
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, []yabf.KVMap{nil, {"field0": yabf.Binary("a")}, nil, {"field0": yabf.Binary("c")}}, rets)
+	rets, status = batchDB.MultiRead(table, []string{"k1"}, nil)
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, []yabf.KVMap{{"field0": yabf.Binary("c"), "field1": yabf.Binary("b")}}, rets)
+
+	if txDB, ok := db.(yabf.TransactionalDB); ok {
+		require.Equal(t, yabf.StatusOK, txDB.Begin())
+		require.Equal(t, yabf.StatusOK, db.Delete(table, "k2"))
+		require.Equal(t, yabf.StatusOK, txDB.Abort())
+		_, status = db.Read(table, "k2", nil)
+		require.Equal(t, yabf.StatusOK, status)
+	}
+	require.Equal(t, yabf.StatusOK, db.Delete(table, "k2"))
+	_, status = db.Read(table, "k2", nil)
+	require.Equal(t, yabf.StatusNotFound, status)
+	rets, status = db.Scan(table, "k", 10, nil)
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, 2, len(rets))
+}
+
+// Check that the transaction is rolled back when its context is canceled,
+// with the record "k3" left by testBinding.
+func testContextTransaction(t *testing.T, db yabf.DB, table string) {
+	txDB, ok := db.(yabf.ContextTransactionalDB)
+	require.True(t, ok)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.Equal(t, yabf.StatusOK, txDB.BeginContext(ctx))
+	require.Equal(t, yabf.StatusOK, db.Delete(table, "k3"))
+	cancel()
+	require.Equal(t, yabf.StatusError, txDB.Commit())
+	_, status := db.Read(table, "k3", nil)
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, yabf.StatusCanceled, txDB.BeginContext(ctx))
+}
+
+// Insert and read the records with the instances of a binding concurrently,
+// and then clean them up one by one. The instances share the resources
+// of the binding, e.g. the database file, which should stay opened until
+// the last one is cleaned up.
+func testSharedBinding(t *testing.T, dbs []yabf.DB, table string, opened func() bool) {
+	var group sync.WaitGroup
+	for i, db := range dbs {
+		group.Add(1)
+		go func(i int, db yabf.DB) {
+			defer group.Done()
+			for j := 0; j < 25; j++ {
+				key := fmt.Sprintf("k%d-%02d", i, j)
+				require.Equal(t, yabf.StatusOK, db.Insert(table, key, yabf.KVMap{"field0": yabf.Binary(key)}))
+				ret, status := db.Read(table, key, nil)
+				require.Equal(t, yabf.StatusOK, status)
+				require.Equal(t, yabf.Binary(key), ret["field0"])
+			}
+		}(i, db)
+	}
+	group.Wait()
+	count := 25 * len(dbs)
+	rets, status := dbs[0].Scan(table, "", int64(count)*2, nil)
+	require.Equal(t, yabf.StatusOK, status)
+	require.Equal(t, count, len(rets))
+	require.Equal(t, yabf.Binary("k0-00"), rets[0]["field0"])
+	require.Equal(t, yabf.Binary(fmt.Sprintf("k%d-24", len(dbs)-1)), rets[count-1]["field0"])
+
+	for _, db := range dbs {
+		require.True(t, opened())
+		require.Nil(t, db.Cleanup())
+	}
+	require.False(t, opened())
+}
+
+func TestMemoryDBBinding(t *testing.T) {
+	db := yabf.NewMemoryDB()
+	require.Nil(t, db.Init())
+	defer db.Cleanup()
+	// the tables of the memory binding are shared by the whole process
+	testBinding(t, db, fmt.Sprintf("t%d", time.Now().UnixNano()))
+}
@@ -0,0 +1,306 @@
+package binding
+
+import (
+	"errors"
+	"github.com/hhkbp2/yabf"
+	bolt "go.etcd.io/bbolt"
+	"strconv"
+	"sync"
+)
+
+const (
+	PropertyBoltFile              = "bolt.file"
+	PropertyBoltFileDefault       = "yabf.bolt"
+	PropertyBoltCodec             = "bolt.codec"
+	PropertyBoltCodecDefault      = "binary"
+	PropertyBoltSyncWrites        = "bolt.syncwrites"
+	PropertyBoltSyncWritesDefault = "true"
+	PropertyBoltBatchSize         = "bolt.batchsize"
+	PropertyBoltBatchSizeDefault  = "0"
+	PropertyBoltCacheSize         = "bolt.cachesize"
+	PropertyBoltCacheSizeDefault  = "0"
+)
+
+var (
+	errBoltNotFound = errors.New("record not found")
+	errBoltExists   = errors.New("record exists")
+)
+
+// A database file of bbolt, which is shared by all the BoltDB instances of
+// it since it could be opened only once.
+type boltFile struct {
+	db   *bolt.DB
+	refs int
+}
+
+var (
+	boltFiles     = make(map[string]*boltFile)
+	boltFilesLock sync.Mutex
+)
+
+// BoltDB is the binding of the embedded B+tree key-value store bbolt.
+// Every table is a bucket, in which a record is kept under its key in
+// a single value encoded by the codec "bolt.codec".
+// Properties to tune the engine:
+//
+//	bolt.syncwrites: fsync every write transaction (default: true)
+//	bolt.batchsize: the max number of concurrent writes coalesced into one
+//	                transaction, 0 for a transaction per write (default: 0)
+//	bolt.cachesize: the size(in MB) of the memory map reserved on open,
+//	                through which bbolt caches the pages (default: 0)
+type BoltDB struct {
+	*yabf.DBBase
+	file      string
+	codec     KVCodec
+	batchSize int
+	db        *bolt.DB
+}
+
+func NewBoltDB() *BoltDB {
+	return &BoltDB{
+		DBBase: yabf.NewDBBase(),
+	}
+}
+
+func (self *BoltDB) Init() error {
+	props := self.GetProperties()
+	file := props.GetDefault(PropertyBoltFile, PropertyBoltFileDefault)
+	codec, err := NewKVCodec(props.GetDefault(PropertyBoltCodec, PropertyBoltCodecDefault))
+	if err != nil {
+		return err
+	}
+	propStr := props.GetDefault(PropertyBoltSyncWrites, PropertyBoltSyncWritesDefault)
+	syncWrites, err := strconv.ParseBool(propStr)
+	if err != nil {
+		return err
+	}
+	propStr = props.GetDefault(PropertyBoltBatchSize, PropertyBoltBatchSizeDefault)
+	batchSize, err := strconv.ParseInt(propStr, 0, 32)
+	if err != nil {
+		return err
+	}
+	propStr = props.GetDefault(PropertyBoltCacheSize, PropertyBoltCacheSizeDefault)
+	cacheSize, err := strconv.ParseInt(propStr, 0, 32)
+	if err != nil {
+		return err
+	}
+
+	boltFilesLock.Lock()
+	defer boltFilesLock.Unlock()
+	f, ok := boltFiles[file]
+	if !ok {
+		db, err := bolt.Open(file, 0644, &bolt.Options{
+			NoSync:          !syncWrites,
+			InitialMmapSize: int(cacheSize) * 1024 * 1024,
+		})
+		if err != nil {
+			return err
+		}
+		if batchSize > 0 {
+			db.MaxBatchSize = int(batchSize)
+		}
+		f = &boltFile{db: db}
+		boltFiles[file] = f
+	}
+	f.refs++
+	self.file = file
+	self.codec = codec
+	self.batchSize = int(batchSize)
+	self.db = f.db
+	return nil
+}
+
+// Release the shared database file, which is closed by the last instance.
+func (self *BoltDB) Cleanup() error {
+	if self.db == nil {
+		return nil
+	}
+	self.db = nil
+	boltFilesLock.Lock()
+	defer boltFilesLock.Unlock()
+	f := boltFiles[self.file]
+	f.refs--
+	if f.refs > 0 {
+		return nil
+	}
+	delete(boltFiles, self.file)
+	return f.db.Close()
+}
+
+// Run the write transaction, which is coalesced with the concurrent ones
+// if "bolt.batchsize" is set.
+func (self *BoltDB) write(op string, table string, key string, fn func(*bolt.Bucket) error) yabf.StatusType {
+	update := self.db.Update
+	if self.batchSize > 0 {
+		update = self.db.Batch
+	}
+	err := update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(table))
+		if err != nil {
+			return err
+		}
+		return fn(bucket)
+	})
+	switch err {
+	case nil:
+		return yabf.StatusOK
+	case errBoltNotFound:
+		return yabf.StatusNotFound
+	case errBoltExists:
+		return yabf.StatusError
+	default:
+		yabf.Errorf("fail to %s table: %s, key: %s, error: %s", op, table, key, err)
+		return yabf.StatusError
+	}
+}
+
+// Run the read transaction on the bucket of table, which is nil if
+// the table doesn't exist yet.
+func (self *BoltDB) read(op string, table string, key string, fn func(*bolt.Bucket) error) yabf.StatusType {
+	err := self.db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket([]byte(table)))
+	})
+	switch err {
+	case nil:
+		return yabf.StatusOK
+	case errBoltNotFound:
+		return yabf.StatusNotFound
+	default:
+		yabf.Errorf("fail to %s table: %s, key: %s, error: %s", op, table, key, err)
+		return yabf.StatusError
+	}
+}
+
+// Read a record from the database.
+func (self *BoltDB) Read(table string, key string, fields []string) (yabf.KVMap, yabf.StatusType) {
+	var ret yabf.KVMap
+	status := self.read("read", table, key, func(bucket *bolt.Bucket) (err error) {
+		if bucket == nil {
+			return errBoltNotFound
+		}
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			return errBoltNotFound
+		}
+		ret, err = self.codec.Decode(data, fields)
+		return
+	})
+	return ret, status
+}
+
+// Perform a range scan for a set of records in the database.
+func (self *BoltDB) Scan(table string, startKey string, recordCount int64, fields []string) ([]yabf.KVMap, yabf.StatusType) {
+	if recordCount < 0 {
+		return nil, yabf.StatusBadRequest
+	}
+	ret := make([]yabf.KVMap, 0, recordCount)
+	status := self.read("scan", table, startKey, func(bucket *bolt.Bucket) error {
+		if bucket == nil {
+			return nil
+		}
+		c := bucket.Cursor()
+		for k, v := c.Seek([]byte(startKey)); (k != nil) && (int64(len(ret)) < recordCount); k, v = c.Next() {
+			record, err := self.codec.Decode(v, fields)
+			if err != nil {
+				return err
+			}
+			ret = append(ret, record)
+		}
+		return nil
+	})
+	if status != yabf.StatusOK {
+		return nil, status
+	}
+	return ret, status
+}
+
+// Update a record in the database.
+func (self *BoltDB) Update(table string, key string, values yabf.KVMap) yabf.StatusType {
+	return self.write("update", table, key, func(bucket *bolt.Bucket) error {
+		data := bucket.Get([]byte(key))
+		if data == nil {
+			return errBoltNotFound
+		}
+		data, err := mergeRecord(self.codec, data, values)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), data)
+	})
+}
+
+// Insert a record in the database.
+func (self *BoltDB) Insert(table string, key string, values yabf.KVMap) yabf.StatusType {
+	data, err := self.codec.Encode(values)
+	if err != nil {
+		return yabf.StatusBadRequest
+	}
+	return self.write("insert", table, key, func(bucket *bolt.Bucket) error {
+		if bucket.Get([]byte(key)) != nil {
+			return errBoltExists
+		}
+		return bucket.Put([]byte(key), data)
+	})
+}
+
+// Delete a record from the database.
+func (self *BoltDB) Delete(table string, key string) yabf.StatusType {
+	return self.write("delete", table, key, func(bucket *bolt.Bucket) error {
+		if bucket.Get([]byte(key)) == nil {
+			return errBoltNotFound
+		}
+		return bucket.Delete([]byte(key))
+	})
+}
+
+// Insert a batch of records in one transaction. None of them is inserted
+// if any of them exists already.
+func (self *BoltDB) BatchInsert(table string, keys []string, values []yabf.KVMap) yabf.StatusType {
+	if (len(keys) == 0) || (len(keys) != len(values)) {
+		return yabf.StatusBadRequest
+	}
+	data := make([][]byte, 0, len(values))
+	for _, v := range values {
+		d, err := self.codec.Encode(v)
+		if err != nil {
+			return yabf.StatusBadRequest
+		}
+		data = append(data, d)
+	}
+	return self.write("batch insert", table, keys[0], func(bucket *bolt.Bucket) error {
+		for i, key := range keys {
+			if bucket.Get([]byte(key)) != nil {
+				return errBoltExists
+			}
+			if err := bucket.Put([]byte(key), data[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Read a batch of records in one transaction.
+func (self *BoltDB) MultiRead(table string, keys []string, fields []string) ([]yabf.KVMap, yabf.StatusType) {
+	ret := make([]yabf.KVMap, len(keys))
+	if len(keys) == 0 {
+		return ret, yabf.StatusOK
+	}
+	status := self.read("multi-read", table, keys[0], func(bucket *bolt.Bucket) (err error) {
+		if bucket == nil {
+			return nil
+		}
+		for i, key := range keys {
+			if data := bucket.Get([]byte(key)); data != nil {
+				if ret[i], err = self.codec.Decode(data, fields); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if status != yabf.StatusOK {
+		return nil, status
+	}
+	return ret, status
+}
@@ -0,0 +1,64 @@
+package binding
+
+import (
+	"github.com/hhkbp2/testify/require"
+	"github.com/hhkbp2/yabf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestBoltDB(t *testing.T, props yabf.Properties) *BoltDB {
+	db := NewBoltDB()
+	db.SetProperties(props)
+	require.Nil(t, db.Init())
+	return db
+}
+
+func TestBoltDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for _, codec := range []string{"binary", "json"} {
+		props := yabf.NewProperties()
+		props.Add(PropertyBoltFile, filepath.Join(dir, codec+".bolt"))
+		props.Add(PropertyBoltCodec, codec)
+		props.Add(PropertyBoltSyncWrites, "false")
+		db := newTestBoltDB(t, props)
+
+		// the bucket of the table is created by the first write
+		_, status := db.Read("t", "k1", nil)
+		require.Equal(t, yabf.StatusNotFound, status)
+		rets, status := db.Scan("t", "k1", 10, nil)
+		require.Equal(t, yabf.StatusOK, status)
+		require.Equal(t, 0, len(rets))
+
+		testBinding(t, db, "t")
+		values := yabf.KVMap{"field0": yabf.Binary("a")}
+		require.Equal(t, yabf.StatusNotFound, db.Update("t", "k0", values))
+		require.Equal(t, yabf.StatusNotFound, db.Delete("t", "k2"))
+		require.Nil(t, db.Cleanup())
+	}
+}
+
+// The concurrent writes of all the instances are coalesced into
+// the transactions of the shared database file.
+func TestBoltDBBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	props := yabf.NewProperties()
+	props.Add(PropertyBoltFile, filepath.Join(dir, "test.bolt"))
+	props.Add(PropertyBoltBatchSize, "8")
+	props.Add(PropertyBoltCacheSize, "1")
+	dbs := make([]yabf.DB, 0)
+	for i := 0; i < 4; i++ {
+		dbs = append(dbs, newTestBoltDB(t, props))
+	}
+	require.True(t, dbs[0].(*BoltDB).db == dbs[3].(*BoltDB).db)
+	file := props.Get(PropertyBoltFile)
+	testSharedBinding(t, dbs, "t", func() bool {
+		return boltFiles[file] != nil
+	})
+}
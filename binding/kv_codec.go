@@ -0,0 +1,161 @@
+package binding
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/hhkbp2/yabf"
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// KVCodec encodes a record into a single value, for the bindings of
+// the key-value stores which keep a record under one key.
+type KVCodec interface {
+	// Encode the fields of a record.
+	Encode(values yabf.KVMap) ([]byte, error)
+
+	// Decode the specified fields of a record, or all of them if fields
+	// is empty.
+	Decode(data []byte, fields []string) (yabf.KVMap, error)
+}
+
+type MakeKVCodecFunc func() KVCodec
+
+var (
+	KVCodecs = map[string]MakeKVCodecFunc{
+		"binary": func() KVCodec {
+			return NewBinaryKVCodec()
+		},
+		"json": func() KVCodec {
+			return NewJSONKVCodec()
+		},
+	}
+)
+
+func NewKVCodec(name string) (KVCodec, error) {
+	f, ok := KVCodecs[name]
+	if !ok {
+		return nil, g.NewErrorf("unsupported record codec: %s", name)
+	}
+	return f(), nil
+}
+
+// Return whether the field is selected by fields, which selects all
+// the fields if it's empty.
+func isFieldSelected(fields []string, field string) bool {
+	if len(fields) == 0 {
+		return true
+	}
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode the record, update its fields with values and encode it again.
+func mergeRecord(codec KVCodec, data []byte, values yabf.KVMap) ([]byte, error) {
+	record, err := codec.Decode(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range values {
+		record[k] = v
+	}
+	return codec.Encode(record)
+}
+
+// BinaryKVCodec encodes a record into the length-prefixed names and values
+// of its fields, in the order of names. It's compact and cheap to decode.
+type BinaryKVCodec struct{}
+
+func NewBinaryKVCodec() *BinaryKVCodec {
+	return &BinaryKVCodec{}
+}
+
+func (self *BinaryKVCodec) Encode(values yabf.KVMap) ([]byte, error) {
+	fields := sortedFields(values)
+	size := binary.MaxVarintLen64
+	for _, k := range fields {
+		size += 2*binary.MaxVarintLen64 + len(k) + len(values[k])
+	}
+	buf := make([]byte, binary.MaxVarintLen64, size)
+	buf = buf[:binary.PutUvarint(buf, uint64(len(fields)))]
+	for _, k := range fields {
+		buf = appendUvarintBytes(buf, []byte(k))
+		buf = appendUvarintBytes(buf, values[k])
+	}
+	return buf, nil
+}
+
+func appendUvarintBytes(buf []byte, b []byte) []byte {
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+	buf = append(buf, lenBuf[:n]...)
+	return append(buf, b...)
+}
+
+// Read a length-prefixed bytes from data, and return them with the rest
+// of data.
+func readUvarintBytes(data []byte) ([]byte, []byte, bool) {
+	length, n := binary.Uvarint(data)
+	if (n <= 0) || (uint64(len(data)-n) < length) {
+		return nil, nil, false
+	}
+	end := n + int(length)
+	return data[n:end], data[end:], true
+}
+
+func (self *BinaryKVCodec) Decode(data []byte, fields []string) (yabf.KVMap, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, g.NewErrorf("corrupted record")
+	}
+	data = data[n:]
+	ret := make(yabf.KVMap)
+	for i := uint64(0); i < count; i++ {
+		var k, v []byte
+		var ok bool
+		if k, data, ok = readUvarintBytes(data); !ok {
+			return nil, g.NewErrorf("corrupted record")
+		}
+		if v, data, ok = readUvarintBytes(data); !ok {
+			return nil, g.NewErrorf("corrupted record")
+		}
+		if isFieldSelected(fields, string(k)) {
+			// copy the value since data may be reused by the store
+			ret[string(k)] = append(yabf.Binary(nil), v...)
+		}
+	}
+	return ret, nil
+}
+
+// JSONKVCodec encodes a record into a JSON object, which is readable by
+// the other tools at the cost of space and time.
+type JSONKVCodec struct{}
+
+func NewJSONKVCodec() *JSONKVCodec {
+	return &JSONKVCodec{}
+}
+
+func (self *JSONKVCodec) Encode(values yabf.KVMap) ([]byte, error) {
+	record := make(map[string][]byte, len(values))
+	for k, v := range values {
+		record[k] = v
+	}
+	return json.Marshal(record)
+}
+
+func (self *JSONKVCodec) Decode(data []byte, fields []string) (yabf.KVMap, error) {
+	var record map[string][]byte
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	ret := make(yabf.KVMap, len(record))
+	for k, v := range record {
+		if isFieldSelected(fields, k) {
+			ret[k] = v
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,48 @@
+package binding
+
+import (
+	"github.com/hhkbp2/testify/require"
+	"github.com/hhkbp2/yabf"
+	"testing"
+)
+
+func TestKVCodec(t *testing.T) {
+	values := yabf.KVMap{
+		"field0": yabf.Binary("a"),
+		"field1": yabf.Binary(""),
+		"field2": yabf.Binary{0, 1, 2, 255},
+	}
+	for name, _ := range KVCodecs {
+		codec, err := NewKVCodec(name)
+		require.Nil(t, err)
+		data, err := codec.Encode(values)
+		require.Nil(t, err, name)
+		ret, err := codec.Decode(data, nil)
+		require.Nil(t, err, name)
+		require.Equal(t, len(values), len(ret), name)
+		for k, v := range values {
+			require.Equal(t, string(v), string(ret[k]), name)
+		}
+		ret, err = codec.Decode(data, []string{"field2", "field3"})
+		require.Nil(t, err, name)
+		require.Equal(t, yabf.KVMap{"field2": yabf.Binary{0, 1, 2, 255}}, ret, name)
+
+		data, err = mergeRecord(codec, data, yabf.KVMap{"field0": yabf.Binary("b"), "field3": yabf.Binary("c")})
+		require.Nil(t, err, name)
+		ret, err = codec.Decode(data, []string{"field0", "field3"})
+		require.Nil(t, err, name)
+		require.Equal(t, yabf.KVMap{"field0": yabf.Binary("b"), "field3": yabf.Binary("c")}, ret, name)
+	}
+	_, err := NewKVCodec("unknown")
+	require.NotNil(t, err)
+}
+
+func TestBinaryKVCodecCorrupted(t *testing.T) {
+	codec := NewBinaryKVCodec()
+	data, err := codec.Encode(yabf.KVMap{"field0": yabf.Binary("value")})
+	require.Nil(t, err)
+	for i := 0; i < len(data); i++ {
+		_, err = codec.Decode(data[:i], nil)
+		require.NotNil(t, err)
+	}
+}
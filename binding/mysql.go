@@ -2,10 +2,12 @@ package binding
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/hhkbp2/yabf"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -37,6 +39,13 @@ type MysqlDB struct {
 	password   string
 	options    string
 	db         *sql.DB
+	tx         *sql.Tx
+}
+
+// The methods shared by sql.DB and sql.Tx to run statements.
+type sqlQuerier interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 }
 
 func NewMysqlDB() *MysqlDB {
@@ -75,52 +84,145 @@ func (self *MysqlDB) Init() error {
 }
 
 func (self *MysqlDB) Cleanup() error {
+	if self.tx != nil {
+		self.tx.Rollback()
+		self.tx = nil
+	}
 	if self.db != nil {
 		return self.db.Close()
 	}
 	return nil
 }
 
-func (self *MysqlDB) createReadStat(table string, fields []string, recordCount int64) string {
-	var fieldStr string
+// Return the querier for the statements, which is the current transaction
+// if there is one.
+func (self *MysqlDB) querier() sqlQuerier {
+	if self.tx != nil {
+		return self.tx
+	}
+	return self.db
+}
+
+func (self *MysqlDB) Begin() yabf.StatusType {
+	return self.BeginContext(context.Background())
+}
+
+func (self *MysqlDB) BeginContext(ctx context.Context) yabf.StatusType {
+	if self.tx != nil {
+		return yabf.StatusBadRequest
+	}
+	tx, err := self.db.BeginTx(ctx, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return yabf.StatusFromContext(ctx)
+		}
+		yabf.Errorf("fail to begin transaction, error: %s", err)
+		return yabf.StatusError
+	}
+	self.tx = tx
+	return yabf.StatusOK
+}
+
+func (self *MysqlDB) Commit() yabf.StatusType {
+	if self.tx == nil {
+		return yabf.StatusBadRequest
+	}
+	err := self.tx.Commit()
+	self.tx = nil
+	if err != nil {
+		yabf.Errorf("fail to commit transaction, error: %s", err)
+		return yabf.StatusError
+	}
+	return yabf.StatusOK
+}
+
+func (self *MysqlDB) Abort() yabf.StatusType {
+	if self.tx == nil {
+		return yabf.StatusBadRequest
+	}
+	err := self.tx.Rollback()
+	self.tx = nil
+	if err != nil {
+		yabf.Errorf("fail to abort transaction, error: %s", err)
+		return yabf.StatusError
+	}
+	return yabf.StatusOK
+}
+
+func (self *MysqlDB) createFieldStr(fields []string) string {
 	if len(fields) == 0 {
-		fieldStr = "*"
-	} else {
-		fieldStr = strings.Join(fields, ", ")
+		return "*"
 	}
-	if recordCount == 0 {
-		return fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", fieldStr, table, self.primaryKey)
-	} else {
-		return fmt.Sprintf("SELECT %s FROM %s WHERE %s >= ? ORDER BY %s LIMIT ?", fieldStr, table, self.primaryKey, self.primaryKey)
+	return strings.Join(fields, ", ")
+}
+
+func (self *MysqlDB) createReadStat(table string, fields []string) string {
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", self.createFieldStr(fields), table, self.primaryKey)
+}
+
+// The statement of a scan always takes the start key and the record count,
+// so a scan of zero records returns nothing rather than the start key.
+func (self *MysqlDB) createScanStat(table string, fields []string) string {
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s >= ? ORDER BY %s LIMIT ?",
+		self.createFieldStr(fields), table, self.primaryKey, self.primaryKey)
+}
+
+// Return the index of the column in columns, or -1 if it's not there.
+func columnIndex(columns []string, column string) int {
+	for i, c := range columns {
+		if c == column {
+			return i
+		}
 	}
+	return -1
+}
+
+// Return the status of a failed statement. The statements which fail
+// because of the deadline or cancellation of ctx are told apart.
+func statusOfError(ctx context.Context, err error) yabf.StatusType {
+	if ctx.Err() != nil {
+		return yabf.StatusFromContext(ctx)
+	}
+	if err == sql.ErrNoRows {
+		return yabf.StatusNotFound
+	}
+	return yabf.StatusError
 }
 
 func (self *MysqlDB) Read(table string, key string, fields []string) (yabf.KVMap, yabf.StatusType) {
-	statement := self.createReadStat(table, fields, 0)
-	stmt, err := self.db.Prepare(statement)
-	defer stmt.Close()
+	return self.ReadContext(context.Background(), table, key, fields)
+}
+
+func (self *MysqlDB) ReadContext(ctx context.Context, table string, key string, fields []string) (yabf.KVMap, yabf.StatusType) {
+	statement := self.createReadStat(table, fields)
+	stmt, err := self.querier().PrepareContext(ctx, statement)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, yabf.StatusFromContext(ctx)
+		}
 		return nil, yabf.StatusBadRequest
 	}
-	rows, err := stmt.Query(key)
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx, key)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, yabf.StatusNotFound
+		status := statusOfError(ctx, err)
+		if status == yabf.StatusError {
+			yabf.Errorf("fail to read table: %s, key: %s, error: %s", table, key, err)
 		}
-		yabf.Errorf("fail to read table: %s, key: %s, error: %s", table, key, err)
-		return nil, yabf.StatusError
+		return nil, status
 	}
+	defer rows.Close()
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, yabf.StatusError
+		return nil, statusOfError(ctx, err)
 	}
 	length := len(columns)
 	if (len(fields) != 0) && (length != len(fields)) {
 		return nil, yabf.StatusUnexpectedState
 	}
 	if !rows.Next() {
-		if rows.Err() != nil {
-			return nil, yabf.StatusError
+		if err = rows.Err(); err != nil {
+			return nil, statusOfError(ctx, err)
 		}
 		return nil, yabf.StatusNotFound
 	}
@@ -131,38 +233,55 @@ func (self *MysqlDB) Read(table string, key string, fields []string) (yabf.KVMap
 	}
 	err = rows.Scan(toScan...)
 	if err != nil {
-		return nil, yabf.StatusError
+		return nil, statusOfError(ctx, err)
 	}
+	// the primary key selected along with all the fields is not a field
+	keyIndex := columnIndex(columns, self.primaryKey)
 	ret := make(yabf.KVMap)
 	for i := 0; i < length; i++ {
+		if i == keyIndex {
+			continue
+		}
 		ret[columns[i]] = results[i]
 	}
 	return ret, yabf.StatusOK
 }
 
 func (self *MysqlDB) Scan(table string, startKey string, recordCount int64, fields []string) ([]yabf.KVMap, yabf.StatusType) {
-	statement := self.createReadStat(table, fields, recordCount)
-	stmt, err := self.db.Prepare(statement)
-	defer stmt.Close()
+	return self.ScanContext(context.Background(), table, startKey, recordCount, fields)
+}
+
+func (self *MysqlDB) ScanContext(ctx context.Context, table string, startKey string, recordCount int64, fields []string) ([]yabf.KVMap, yabf.StatusType) {
+	if recordCount < 0 {
+		return nil, yabf.StatusBadRequest
+	}
+	statement := self.createScanStat(table, fields)
+	stmt, err := self.querier().PrepareContext(ctx, statement)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, yabf.StatusFromContext(ctx)
+		}
 		return nil, yabf.StatusBadRequest
 	}
-	rows, err := stmt.Query(startKey, recordCount)
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx, startKey, recordCount)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, yabf.StatusNotFound
+		status := statusOfError(ctx, err)
+		if status == yabf.StatusError {
+			yabf.Errorf("fail to scan table: %s, start key: %s, record count: %d, error: %s", table, startKey, recordCount, err)
 		}
-		yabf.Errorf("fail to scan table: %s, start key: %s, record count: %d, error: %s", table, startKey, recordCount, err)
-		return nil, yabf.StatusError
+		return nil, status
 	}
+	defer rows.Close()
 	columns, err := rows.Columns()
 	if err != nil {
-		return nil, yabf.StatusError
+		return nil, statusOfError(ctx, err)
 	}
 	length := len(columns)
 	if (len(fields) != 0) && (length != len(fields)) {
 		return nil, yabf.StatusUnexpectedState
 	}
+	keyIndex := columnIndex(columns, self.primaryKey)
 	ret := make([]yabf.KVMap, 0, recordCount)
 	for rows.Next() {
 		results := make([][]byte, length)
@@ -172,20 +291,27 @@ func (self *MysqlDB) Scan(table string, startKey string, recordCount int64, fiel
 		}
 		err = rows.Scan(toScan...)
 		if err != nil {
-			return nil, yabf.StatusError
+			return nil, statusOfError(ctx, err)
 		}
 		m := make(yabf.KVMap)
 		for i := 0; i < length; i++ {
+			if i == keyIndex {
+				continue
+			}
 			m[columns[i]] = results[i]
 		}
+		ret = append(ret, m)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, statusOfError(ctx, err)
 	}
 	return ret, yabf.StatusOK
 }
 
-func (self *MysqlDB) createUpdateStat(table string, values yabf.KVMap) (string, []interface{}) {
+func (self *MysqlDB) createUpdateStat(table string, key string, values yabf.KVMap) (string, []interface{}) {
 	var buf bytes.Buffer
 	afterFirst := false
-	args := make([]interface{}, 0, len(values))
+	args := make([]interface{}, 0, len(values)+1)
 	for k, v := range values {
 		if afterFirst {
 			buf.WriteString(", ")
@@ -196,24 +322,37 @@ func (self *MysqlDB) createUpdateStat(table string, values yabf.KVMap) (string,
 		buf.WriteString(" = ?")
 		args = append(args, v)
 	}
+	args = append(args, key)
 	setStr := buf.String()
 	return fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?", table, setStr, self.primaryKey), args
 }
 
 func (self *MysqlDB) Update(table string, key string, values yabf.KVMap) yabf.StatusType {
-	statement, args := self.createUpdateStat(table, values)
-	stmt, err := self.db.Prepare(statement)
-	defer stmt.Close()
+	return self.UpdateContext(context.Background(), table, key, values)
+}
+
+func (self *MysqlDB) UpdateContext(ctx context.Context, table string, key string, values yabf.KVMap) yabf.StatusType {
+	statement, args := self.createUpdateStat(table, key, values)
+	return self.exec(ctx, "update", table, key, statement, args...)
+}
+
+// Execute the statement which doesn't return rows.
+func (self *MysqlDB) exec(ctx context.Context, op string, table string, key string, statement string, args ...interface{}) yabf.StatusType {
+	stmt, err := self.querier().PrepareContext(ctx, statement)
 	if err != nil {
+		if ctx.Err() != nil {
+			return yabf.StatusFromContext(ctx)
+		}
 		return yabf.StatusBadRequest
 	}
-	_, err = stmt.Exec(args...)
+	defer stmt.Close()
+	_, err = stmt.ExecContext(ctx, args...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return yabf.StatusNotFound
+		status := statusOfError(ctx, err)
+		if status == yabf.StatusError {
+			yabf.Errorf("fail to %s table: %s, key: %s, error: %s", op, table, key, err)
 		}
-		yabf.Errorf("fail to update table: %s, key: %s, error: %s", table, key, err)
-		return yabf.StatusError
+		return status
 	}
 	return yabf.StatusOK
 }
@@ -223,7 +362,8 @@ func (self *MysqlDB) createInsertStat(table string, key string, values yabf.KVMa
 	args := make([]interface{}, 0, len(values)+1)
 	buf1.WriteString(self.primaryKey)
 	buf2.WriteString("?")
-	args = append(args, []byte(key))
+	// bind the key as text, which SqliteDB relies on to compare it
+	args = append(args, key)
 	for k, v := range values {
 		buf1.WriteString(", ")
 		buf2.WriteString(", ")
@@ -235,34 +375,143 @@ func (self *MysqlDB) createInsertStat(table string, key string, values yabf.KVMa
 }
 
 func (self *MysqlDB) Insert(table string, key string, values yabf.KVMap) yabf.StatusType {
+	return self.InsertContext(context.Background(), table, key, values)
+}
+
+func (self *MysqlDB) InsertContext(ctx context.Context, table string, key string, values yabf.KVMap) yabf.StatusType {
 	statement, args := self.createInsertStat(table, key, values)
-	stmt, err := self.db.Prepare(statement)
-	defer stmt.Close()
-	if err != nil {
+	return self.exec(ctx, "insert", table, key, statement, args...)
+}
+
+func (self *MysqlDB) Delete(table string, key string) yabf.StatusType {
+	return self.DeleteContext(context.Background(), table, key)
+}
+
+func (self *MysqlDB) DeleteContext(ctx context.Context, table string, key string) yabf.StatusType {
+	statement := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table, self.primaryKey)
+	return self.exec(ctx, "delete", table, key, statement, key)
+}
+
+// Build a multi-row insert statement. All the records of a batch should have
+// the same set of fields.
+func (self *MysqlDB) createBatchInsertStat(table string, keys []string, values []yabf.KVMap) (string, []interface{}, bool) {
+	fields := make([]string, 0, len(values[0]))
+	for k, _ := range values[0] {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	var buf1, buf2 bytes.Buffer
+	args := make([]interface{}, 0, len(keys)*(len(fields)+1))
+	buf1.WriteString(self.primaryKey)
+	for _, k := range fields {
+		buf1.WriteString(", ")
+		buf1.WriteString(k)
+	}
+	for i, key := range keys {
+		if len(values[i]) != len(fields) {
+			return "", nil, false
+		}
+		if i > 0 {
+			buf2.WriteString(", ")
+		}
+		buf2.WriteString("(?")
+		args = append(args, key)
+		for _, k := range fields {
+			v, ok := values[i][k]
+			if !ok {
+				return "", nil, false
+			}
+			buf2.WriteString(", ?")
+			args = append(args, v)
+		}
+		buf2.WriteString(")")
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, buf1.String(), buf2.String()), args, true
+}
+
+func (self *MysqlDB) BatchInsert(table string, keys []string, values []yabf.KVMap) yabf.StatusType {
+	return self.BatchInsertContext(context.Background(), table, keys, values)
+}
+
+func (self *MysqlDB) BatchInsertContext(ctx context.Context, table string, keys []string, values []yabf.KVMap) yabf.StatusType {
+	if (len(keys) == 0) || (len(keys) != len(values)) {
 		return yabf.StatusBadRequest
 	}
-	_, err = stmt.Exec(args...)
-	if err != nil {
-		yabf.Errorf("fail to insert table: %s, key: %s, error: %s", table, key, err)
-		return yabf.StatusError
+	statement, args, ok := self.createBatchInsertStat(table, keys, values)
+	if !ok {
+		return yabf.StatusBadRequest
 	}
-	return yabf.StatusOK
+	return self.exec(ctx, "batch insert", table, keys[0], statement, args...)
 }
 
-func (self *MysqlDB) Delete(table string, key string) yabf.StatusType {
-	statement := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", table, self.primaryKey)
-	stmt, err := self.db.Prepare(statement)
-	defer stmt.Close()
+func (self *MysqlDB) createMultiReadStat(table string, fields []string, keyCount int) string {
+	var fieldStr string
+	if len(fields) == 0 {
+		fieldStr = "*"
+	} else {
+		fieldStr = self.primaryKey + ", " + strings.Join(fields, ", ")
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", keyCount), ", ")
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (%s)", fieldStr, table, self.primaryKey, placeholders)
+}
+
+func (self *MysqlDB) MultiRead(table string, keys []string, fields []string) ([]yabf.KVMap, yabf.StatusType) {
+	return self.MultiReadContext(context.Background(), table, keys, fields)
+}
+
+func (self *MysqlDB) MultiReadContext(ctx context.Context, table string, keys []string, fields []string) ([]yabf.KVMap, yabf.StatusType) {
+	if len(keys) == 0 {
+		return nil, yabf.StatusOK
+	}
+	statement := self.createMultiReadStat(table, fields, len(keys))
+	args := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	rows, err := self.querier().QueryContext(ctx, statement, args...)
 	if err != nil {
-		return yabf.StatusBadRequest
+		status := statusOfError(ctx, err)
+		if status == yabf.StatusError {
+			yabf.Errorf("fail to multi-read table: %s, keys: %d, error: %s", table, len(keys), err)
+		}
+		return nil, status
 	}
-	_, err = stmt.Exec(key)
+	defer rows.Close()
+	columns, err := rows.Columns()
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return yabf.StatusNotFound
+		return nil, statusOfError(ctx, err)
+	}
+	length := len(columns)
+	keyIndex := columnIndex(columns, self.primaryKey)
+	if (keyIndex < 0) || ((len(fields) != 0) && (length != len(fields)+1)) {
+		return nil, yabf.StatusUnexpectedState
+	}
+	found := make(map[string]yabf.KVMap, len(keys))
+	for rows.Next() {
+		results := make([][]byte, length)
+		toScan := make([]interface{}, length)
+		for i, _ := range results {
+			toScan[i] = &results[i]
 		}
-		yabf.Errorf("fail to delete table: %s, key: %s, error: %s", table, key, err)
-		return yabf.StatusError
+		err = rows.Scan(toScan...)
+		if err != nil {
+			return nil, statusOfError(ctx, err)
+		}
+		m := make(yabf.KVMap)
+		for i := 0; i < length; i++ {
+			if i == keyIndex {
+				continue
+			}
+			m[columns[i]] = results[i]
+		}
+		found[string(results[keyIndex])] = m
 	}
-	return yabf.StatusOK
+	if err = rows.Err(); err != nil {
+		return nil, statusOfError(ctx, err)
+	}
+	ret := make([]yabf.KVMap, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, found[key])
+	}
+	return ret, yabf.StatusOK
 }
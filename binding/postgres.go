@@ -0,0 +1,548 @@
+package binding
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/hhkbp2/yabf"
+	"github.com/lib/pq"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	PropertyPostgresHost               = "postgres.host"
+	PropertyPostgresHostDefault        = "127.0.0.1"
+	PropertyPostgresPort               = "postgres.port"
+	PropertyPostgresPortDefault        = "5432"
+	PropertyPostgresDatabase           = "postgres.db"
+	PropertyPostgresDatabaseDefault    = "db"
+	PropertyPostgresUser               = "postgres.user"
+	PropertyPostgresUserDefault        = "user"
+	PropertyPostgresPassword           = "postgres.password"
+	PropertyPostgresPasswordDefault    = "password"
+	PropertyPostgresOptions            = "postgres.options"
+	PropertyPostgresOptionsDefault     = "sslmode=disable"
+	PropertyPostgresPrimaryKey         = "postgres.primarykey"
+	PropertyPostgresPrimaryKeyDefault  = "yabf_key"
+	PropertyPostgresUpsert             = "postgres.upsert"
+	PropertyPostgresUpsertDefault      = "false"
+	PropertyPostgresCreateTable        = "postgres.createtable"
+	PropertyPostgresCreateTableDefault = "false"
+)
+
+// The tables created by PostgresDB in this process, so that they are
+// created only once by all the client routines.
+var (
+	postgresTables     = make(map[string]bool)
+	postgresTablesLock sync.Mutex
+)
+
+// PostgresDB is the binding of PostgreSQL. The statements are prepared once
+// and cached in every instance. The inserts overwrite the existing records
+// by "INSERT ... ON CONFLICT" if "postgres.upsert" is set. The table of
+// "fieldcount" fields is created if "postgres.createtable" is set.
+type PostgresDB struct {
+	*yabf.DBBase
+	host       string
+	port       int
+	database   string
+	primaryKey string
+	user       string
+	password   string
+	options    string
+	upsert     bool
+	db         *sql.DB
+	tx         *sql.Tx
+	statements map[string]*sql.Stmt
+}
+
+func NewPostgresDB() *PostgresDB {
+	return &PostgresDB{
+		DBBase:     yabf.NewDBBase(),
+		statements: make(map[string]*sql.Stmt),
+	}
+}
+
+func (self *PostgresDB) Init() error {
+	props := self.GetProperties()
+	host := props.GetDefault(PropertyPostgresHost, PropertyPostgresHostDefault)
+	propStr := props.GetDefault(PropertyPostgresPort, PropertyPostgresPortDefault)
+	port, err := strconv.ParseInt(propStr, 0, 32)
+	if err != nil {
+		return err
+	}
+	database := props.GetDefault(PropertyPostgresDatabase, PropertyPostgresDatabaseDefault)
+	primaryKey := props.GetDefault(PropertyPostgresPrimaryKey, PropertyPostgresPrimaryKeyDefault)
+	user := props.GetDefault(PropertyPostgresUser, PropertyPostgresUserDefault)
+	password := props.GetDefault(PropertyPostgresPassword, PropertyPostgresPasswordDefault)
+	options := props.GetDefault(PropertyPostgresOptions, PropertyPostgresOptionsDefault)
+	propStr = props.GetDefault(PropertyPostgresUpsert, PropertyPostgresUpsertDefault)
+	upsert, err := strconv.ParseBool(propStr)
+	if err != nil {
+		return err
+	}
+	propStr = props.GetDefault(PropertyPostgresCreateTable, PropertyPostgresCreateTableDefault)
+	createTable, err := strconv.ParseBool(propStr)
+	if err != nil {
+		return err
+	}
+	self.host = host
+	self.port = int(port)
+	self.database = database
+	self.primaryKey = primaryKey
+	self.user = user
+	self.password = password
+	self.options = options
+	self.upsert = upsert
+	sourceName := postgresSourceName(host, self.port, database, user, password, options)
+	db, err := sql.Open("postgres", sourceName)
+	if err != nil {
+		return err
+	}
+	self.db = db
+	if createTable {
+		return self.createTable(sourceName)
+	}
+	return nil
+}
+
+// Return the connection URL of the database. The user name, the password
+// and the database are escaped, so that they may contain any character.
+func postgresSourceName(host string, port int, database, user, password, options string) string {
+	sourceURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(user, password),
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/" + database,
+		RawQuery: options,
+	}
+	return sourceURL.String()
+}
+
+// Create the table of the workload if it doesn't exist, with the primary
+// key and "fieldcount" fields of bytes.
+func (self *PostgresDB) createTable(sourceName string) error {
+	props := self.GetProperties()
+	table := props.GetDefault(yabf.PropertyTableName, yabf.PropertyTableNameDefault)
+	propStr := props.GetDefault(yabf.PropertyFieldCount, yabf.PropertyFieldCountDefault)
+	fieldCount, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return err
+	}
+	fieldPrefix := props.GetDefault(yabf.PropertyFieldPrefix, yabf.PropertyFieldPrefixDefault)
+	postgresTablesLock.Lock()
+	defer postgresTablesLock.Unlock()
+	name := sourceName + "/" + table
+	if postgresTables[name] {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString(self.primaryKey)
+	buf.WriteString(" VARCHAR(255) PRIMARY KEY")
+	for i := int64(0); i < fieldCount; i++ {
+		buf.WriteString(fmt.Sprintf(", %s%d BYTEA", fieldPrefix, i))
+	}
+	statement := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, buf.String())
+	if _, err = self.db.Exec(statement); err != nil {
+		return err
+	}
+	postgresTables[name] = true
+	return nil
+}
+
+func (self *PostgresDB) Cleanup() error {
+	if self.tx != nil {
+		self.tx.Rollback()
+		self.tx = nil
+	}
+	for _, stmt := range self.statements {
+		stmt.Close()
+	}
+	self.statements = make(map[string]*sql.Stmt)
+	if self.db != nil {
+		return self.db.Close()
+	}
+	return nil
+}
+
+// Return the prepared statement, which is prepared on first use and cached.
+// It's bound to the current transaction if there is one.
+func (self *PostgresDB) prepare(ctx context.Context, statement string) (*sql.Stmt, error) {
+	stmt, ok := self.statements[statement]
+	if !ok {
+		var err error
+		stmt, err = self.db.PrepareContext(ctx, statement)
+		if err != nil {
+			return nil, err
+		}
+		self.statements[statement] = stmt
+	}
+	if self.tx != nil {
+		return self.tx.StmtContext(ctx, stmt), nil
+	}
+	return stmt, nil
+}
+
+func (self *PostgresDB) Begin() yabf.StatusType {
+	return self.BeginContext(context.Background())
+}
+
+func (self *PostgresDB) BeginContext(ctx context.Context) yabf.StatusType {
+	if self.tx != nil {
+		return yabf.StatusBadRequest
+	}
+	tx, err := self.db.BeginTx(ctx, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return yabf.StatusFromContext(ctx)
+		}
+		yabf.Errorf("fail to begin transaction, error: %s", err)
+		return yabf.StatusError
+	}
+	self.tx = tx
+	return yabf.StatusOK
+}
+
+func (self *PostgresDB) Commit() yabf.StatusType {
+	if self.tx == nil {
+		return yabf.StatusBadRequest
+	}
+	err := self.tx.Commit()
+	self.tx = nil
+	if err != nil {
+		yabf.Errorf("fail to commit transaction, error: %s", err)
+		return yabf.StatusError
+	}
+	return yabf.StatusOK
+}
+
+func (self *PostgresDB) Abort() yabf.StatusType {
+	if self.tx == nil {
+		return yabf.StatusBadRequest
+	}
+	err := self.tx.Rollback()
+	self.tx = nil
+	if err != nil {
+		yabf.Errorf("fail to abort transaction, error: %s", err)
+		return yabf.StatusError
+	}
+	return yabf.StatusOK
+}
+
+// Return the sorted field names of values, so that the statements of
+// the same fields are the same ones in the cache.
+func sortedFields(values yabf.KVMap) []string {
+	fields := make([]string, 0, len(values))
+	for k, _ := range values {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func (self *PostgresDB) createFieldStr(fields []string) string {
+	if len(fields) == 0 {
+		return "*"
+	}
+	return strings.Join(fields, ", ")
+}
+
+func (self *PostgresDB) createReadStat(table string, fields []string) string {
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s = $1", self.createFieldStr(fields), table, self.primaryKey)
+}
+
+// The statement of a scan always takes the start key and the record count,
+// so a scan of zero records returns nothing rather than the start key.
+func (self *PostgresDB) createScanStat(table string, fields []string) string {
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s >= $1 ORDER BY %s LIMIT $2",
+		self.createFieldStr(fields), table, self.primaryKey, self.primaryKey)
+}
+
+// Read the rows into the records, skipping the column of index skip
+// unless it's negative.
+func scanRows(rows *sql.Rows, columns []string, skip int, f func(results [][]byte, record yabf.KVMap)) error {
+	length := len(columns)
+	for rows.Next() {
+		results := make([][]byte, length)
+		toScan := make([]interface{}, length)
+		for i, _ := range results {
+			toScan[i] = &results[i]
+		}
+		if err := rows.Scan(toScan...); err != nil {
+			return err
+		}
+		m := make(yabf.KVMap)
+		for i := 0; i < length; i++ {
+			if i == skip {
+				continue
+			}
+			m[columns[i]] = results[i]
+		}
+		f(results, m)
+	}
+	return rows.Err()
+}
+
+// Run the query and return its records, or the status of failure.
+func (self *PostgresDB) query(ctx context.Context, op string, table string, statement string, fields []string, args ...interface{}) ([]yabf.KVMap, yabf.StatusType) {
+	stmt, err := self.prepare(ctx, statement)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, yabf.StatusFromContext(ctx)
+		}
+		return nil, yabf.StatusBadRequest
+	}
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		status := statusOfError(ctx, err)
+		if status == yabf.StatusError {
+			yabf.Errorf("fail to %s table: %s, error: %s", op, table, err)
+		}
+		return nil, status
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, statusOfError(ctx, err)
+	}
+	if (len(fields) != 0) && (len(columns) != len(fields)) {
+		return nil, yabf.StatusUnexpectedState
+	}
+	// the primary key selected along with all the fields is not a field
+	ret := make([]yabf.KVMap, 0)
+	err = scanRows(rows, columns, columnIndex(columns, self.primaryKey), func(results [][]byte, record yabf.KVMap) {
+		ret = append(ret, record)
+	})
+	if err != nil {
+		return nil, statusOfError(ctx, err)
+	}
+	return ret, yabf.StatusOK
+}
+
+func (self *PostgresDB) Read(table string, key string, fields []string) (yabf.KVMap, yabf.StatusType) {
+	return self.ReadContext(context.Background(), table, key, fields)
+}
+
+func (self *PostgresDB) ReadContext(ctx context.Context, table string, key string, fields []string) (yabf.KVMap, yabf.StatusType) {
+	statement := self.createReadStat(table, fields)
+	ret, status := self.query(ctx, "read", table, statement, fields, key)
+	if status != yabf.StatusOK {
+		return nil, status
+	}
+	if len(ret) == 0 {
+		return nil, yabf.StatusNotFound
+	}
+	return ret[0], yabf.StatusOK
+}
+
+func (self *PostgresDB) Scan(table string, startKey string, recordCount int64, fields []string) ([]yabf.KVMap, yabf.StatusType) {
+	return self.ScanContext(context.Background(), table, startKey, recordCount, fields)
+}
+
+func (self *PostgresDB) ScanContext(ctx context.Context, table string, startKey string, recordCount int64, fields []string) ([]yabf.KVMap, yabf.StatusType) {
+	if recordCount < 0 {
+		return nil, yabf.StatusBadRequest
+	}
+	statement := self.createScanStat(table, fields)
+	return self.query(ctx, "scan", table, statement, fields, startKey, recordCount)
+}
+
+func (self *PostgresDB) createUpdateStat(table string, key string, values yabf.KVMap) (string, []interface{}) {
+	var buf bytes.Buffer
+	args := make([]interface{}, 0, len(values)+1)
+	for i, k := range sortedFields(values) {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(fmt.Sprintf("%s = $%d", k, i+1))
+		args = append(args, values[k])
+	}
+	args = append(args, key)
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s = $%d", table, buf.String(), self.primaryKey, len(args)), args
+}
+
+func (self *PostgresDB) Update(table string, key string, values yabf.KVMap) yabf.StatusType {
+	return self.UpdateContext(context.Background(), table, key, values)
+}
+
+func (self *PostgresDB) UpdateContext(ctx context.Context, table string, key string, values yabf.KVMap) yabf.StatusType {
+	statement, args := self.createUpdateStat(table, key, values)
+	return self.exec(ctx, "update", table, key, true, statement, args...)
+}
+
+// Execute the statement which doesn't return rows. It fails with
+// StatusNotFound if it affects no row and mustAffect is set.
+func (self *PostgresDB) exec(ctx context.Context, op string, table string, key string, mustAffect bool, statement string, args ...interface{}) yabf.StatusType {
+	stmt, err := self.prepare(ctx, statement)
+	if err != nil {
+		if ctx.Err() != nil {
+			return yabf.StatusFromContext(ctx)
+		}
+		return yabf.StatusBadRequest
+	}
+	result, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		status := statusOfError(ctx, err)
+		if status == yabf.StatusError {
+			yabf.Errorf("fail to %s table: %s, key: %s, error: %s", op, table, key, err)
+		}
+		return status
+	}
+	if mustAffect {
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return yabf.StatusError
+		}
+		if affected == 0 {
+			return yabf.StatusNotFound
+		}
+	}
+	return yabf.StatusOK
+}
+
+// Return the clause to overwrite the fields of the existing record
+// in upsert mode.
+func (self *PostgresDB) createConflictClause(fields []string) string {
+	if !self.upsert {
+		return ""
+	}
+	if len(fields) == 0 {
+		return fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", self.primaryKey)
+	}
+	sets := make([]string, 0, len(fields))
+	for _, k := range fields {
+		sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", k, k))
+	}
+	return fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", self.primaryKey, strings.Join(sets, ", "))
+}
+
+// Build the insert statement of the records, all of which should have
+// the same set of fields.
+func (self *PostgresDB) createInsertStat(table string, keys []string, values []yabf.KVMap) (string, []interface{}, bool) {
+	fields := sortedFields(values[0])
+	var buf1, buf2 bytes.Buffer
+	args := make([]interface{}, 0, len(keys)*(len(fields)+1))
+	buf1.WriteString(self.primaryKey)
+	for _, k := range fields {
+		buf1.WriteString(", ")
+		buf1.WriteString(k)
+	}
+	for i, key := range keys {
+		if len(values[i]) != len(fields) {
+			return "", nil, false
+		}
+		if i > 0 {
+			buf2.WriteString(", ")
+		}
+		args = append(args, key)
+		buf2.WriteString(fmt.Sprintf("($%d", len(args)))
+		for _, k := range fields {
+			v, ok := values[i][k]
+			if !ok {
+				return "", nil, false
+			}
+			args = append(args, v)
+			buf2.WriteString(fmt.Sprintf(", $%d", len(args)))
+		}
+		buf2.WriteString(")")
+	}
+	statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s%s",
+		table, buf1.String(), buf2.String(), self.createConflictClause(fields))
+	return statement, args, true
+}
+
+func (self *PostgresDB) Insert(table string, key string, values yabf.KVMap) yabf.StatusType {
+	return self.InsertContext(context.Background(), table, key, values)
+}
+
+func (self *PostgresDB) InsertContext(ctx context.Context, table string, key string, values yabf.KVMap) yabf.StatusType {
+	statement, args, _ := self.createInsertStat(table, []string{key}, []yabf.KVMap{values})
+	return self.exec(ctx, "insert", table, key, false, statement, args...)
+}
+
+func (self *PostgresDB) Delete(table string, key string) yabf.StatusType {
+	return self.DeleteContext(context.Background(), table, key)
+}
+
+func (self *PostgresDB) DeleteContext(ctx context.Context, table string, key string) yabf.StatusType {
+	statement := fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table, self.primaryKey)
+	return self.exec(ctx, "delete", table, key, true, statement, key)
+}
+
+func (self *PostgresDB) BatchInsert(table string, keys []string, values []yabf.KVMap) yabf.StatusType {
+	return self.BatchInsertContext(context.Background(), table, keys, values)
+}
+
+func (self *PostgresDB) BatchInsertContext(ctx context.Context, table string, keys []string, values []yabf.KVMap) yabf.StatusType {
+	if (len(keys) == 0) || (len(keys) != len(values)) {
+		return yabf.StatusBadRequest
+	}
+	statement, args, ok := self.createInsertStat(table, keys, values)
+	if !ok {
+		return yabf.StatusBadRequest
+	}
+	return self.exec(ctx, "batch insert", table, keys[0], false, statement, args...)
+}
+
+func (self *PostgresDB) createMultiReadStat(table string, fields []string) string {
+	var fieldStr string
+	if len(fields) == 0 {
+		fieldStr = "*"
+	} else {
+		fieldStr = self.primaryKey + ", " + strings.Join(fields, ", ")
+	}
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s = ANY($1)", fieldStr, table, self.primaryKey)
+}
+
+func (self *PostgresDB) MultiRead(table string, keys []string, fields []string) ([]yabf.KVMap, yabf.StatusType) {
+	return self.MultiReadContext(context.Background(), table, keys, fields)
+}
+
+func (self *PostgresDB) MultiReadContext(ctx context.Context, table string, keys []string, fields []string) ([]yabf.KVMap, yabf.StatusType) {
+	if len(keys) == 0 {
+		return nil, yabf.StatusOK
+	}
+	statement := self.createMultiReadStat(table, fields)
+	stmt, err := self.prepare(ctx, statement)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, yabf.StatusFromContext(ctx)
+		}
+		return nil, yabf.StatusBadRequest
+	}
+	rows, err := stmt.QueryContext(ctx, pq.Array(keys))
+	if err != nil {
+		status := statusOfError(ctx, err)
+		if status == yabf.StatusError {
+			yabf.Errorf("fail to multi-read table: %s, keys: %d, error: %s", table, len(keys), err)
+		}
+		return nil, status
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, statusOfError(ctx, err)
+	}
+	keyIndex := columnIndex(columns, self.primaryKey)
+	if (keyIndex < 0) || ((len(fields) != 0) && (len(columns) != len(fields)+1)) {
+		return nil, yabf.StatusUnexpectedState
+	}
+	found := make(map[string]yabf.KVMap, len(keys))
+	err = scanRows(rows, columns, keyIndex, func(results [][]byte, record yabf.KVMap) {
+		found[string(results[keyIndex])] = record
+	})
+	if err != nil {
+		return nil, statusOfError(ctx, err)
+	}
+	ret := make([]yabf.KVMap, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, found[key])
+	}
+	return ret, yabf.StatusOK
+}
@@ -0,0 +1,131 @@
+package binding
+
+import (
+	"fmt"
+	"github.com/hhkbp2/testify/require"
+	"github.com/hhkbp2/yabf"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPostgresStatements(t *testing.T) {
+	db := NewPostgresDB()
+	db.primaryKey = "k"
+	require.Equal(t, "SELECT * FROM t WHERE k = $1", db.createReadStat("t", nil))
+	require.Equal(t, "SELECT f0, f1 FROM t WHERE k >= $1 ORDER BY k LIMIT $2",
+		db.createScanStat("t", []string{"f0", "f1"}))
+	require.Equal(t, "SELECT * FROM t WHERE k >= $1 ORDER BY k LIMIT $2", db.createScanStat("t", nil))
+
+	require.Equal(t, "postgres://u:p%40ss%2Fw%3Ard@[::1]:5432/db?sslmode=disable",
+		postgresSourceName("::1", 5432, "db", "u", "p@ss/w:rd", "sslmode=disable"))
+
+	values := yabf.KVMap{"f1": yabf.Binary("b"), "f0": yabf.Binary("a")}
+	statement, args := db.createUpdateStat("t", "key", values)
+	require.Equal(t, "UPDATE t SET f0 = $1, f1 = $2 WHERE k = $3", statement)
+	require.Equal(t, []interface{}{yabf.Binary("a"), yabf.Binary("b"), "key"}, args)
+
+	statement, args, ok := db.createInsertStat("t", []string{"k0", "k1"}, []yabf.KVMap{values, values})
+	require.True(t, ok)
+	require.Equal(t, "INSERT INTO t (k, f0, f1) VALUES ($1, $2, $3), ($4, $5, $6)", statement)
+	require.Equal(t, 6, len(args))
+	require.Equal(t, "k1", args[3])
+	_, _, ok = db.createInsertStat("t", []string{"k0", "k1"}, []yabf.KVMap{values, {"f0": yabf.Binary("a")}})
+	require.False(t, ok)
+
+	db.upsert = true
+	statement, _, _ = db.createInsertStat("t", []string{"k0"}, []yabf.KVMap{values})
+	require.Equal(t, "INSERT INTO t (k, f0, f1) VALUES ($1, $2, $3) ON CONFLICT (k) DO UPDATE SET f0 = EXCLUDED.f0, f1 = EXCLUDED.f1", statement)
+
+	require.Equal(t, "SELECT k, f0 FROM t WHERE k = ANY($1)", db.createMultiReadStat("t", []string{"f0"}))
+}
+
+// Return the path of the PostgreSQL program, which is looked up in PATH
+// and the usual installation directories.
+func lookPostgresProgram(name string) (string, bool) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, true
+	}
+	paths, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql/*/bin", name))
+	if len(paths) > 0 {
+		return paths[len(paths)-1], true
+	}
+	return "", false
+}
+
+// Return the properties to connect to a PostgreSQL server for test. It's
+// the server specified by the environment variable YABF_TEST_POSTGRES_HOST
+// (with YABF_TEST_POSTGRES_PORT, _USER, _PASSWORD and _DB), or a local
+// server started by the test if PostgreSQL is installed. The test is
+// skipped if there is neither.
+func startPostgres(t *testing.T) (yabf.Properties, func()) {
+	props := yabf.NewProperties()
+	if host := os.Getenv("YABF_TEST_POSTGRES_HOST"); host != "" {
+		props.Add(PropertyPostgresHost, host)
+		for env, name := range map[string]string{
+			"YABF_TEST_POSTGRES_PORT":     PropertyPostgresPort,
+			"YABF_TEST_POSTGRES_USER":     PropertyPostgresUser,
+			"YABF_TEST_POSTGRES_PASSWORD": PropertyPostgresPassword,
+			"YABF_TEST_POSTGRES_DB":       PropertyPostgresDatabase,
+		} {
+			if v := os.Getenv(env); v != "" {
+				props.Add(name, v)
+			}
+		}
+		return props, func() {}
+	}
+	initdb, ok1 := lookPostgresProgram("initdb")
+	pgctl, ok2 := lookPostgresProgram("pg_ctl")
+	if !ok1 || !ok2 || (os.Geteuid() == 0) {
+		// the server refuses to run as root
+		t.Skip("no PostgreSQL server to test against")
+	}
+	dir, err := ioutil.TempDir("", "postgres")
+	require.Nil(t, err)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	dataDir := filepath.Join(dir, "data")
+	out, err := exec.Command(initdb, "-D", dataDir, "-U", "yabf", "--auth=trust").CombinedOutput()
+	require.Nil(t, err, string(out))
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1", port, dir)
+	out, err = exec.Command(pgctl, "start", "-w", "-D", dataDir, "-l", filepath.Join(dir, "log"), "-o", options).CombinedOutput()
+	require.Nil(t, err, string(out))
+	props.Add(PropertyPostgresPort, fmt.Sprintf("%d", port))
+	props.Add(PropertyPostgresUser, "yabf")
+	props.Add(PropertyPostgresDatabase, "postgres")
+	return props, func() {
+		exec.Command(pgctl, "stop", "-m", "immediate", "-D", dataDir).Run()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestPostgresDB(t *testing.T) {
+	props, stop := startPostgres(t)
+	defer stop()
+	table := "yabf_test"
+	props.Add(yabf.PropertyTableName, table)
+	props.Add(yabf.PropertyFieldCount, "2")
+	props.Add(PropertyPostgresCreateTable, "true")
+	db := NewPostgresDB()
+	db.SetProperties(props)
+	require.Nil(t, db.Init())
+	defer db.Cleanup()
+	_, err := db.db.Exec("TRUNCATE " + table)
+	require.Nil(t, err)
+
+	testBinding(t, db, table)
+	testContextTransaction(t, db, table)
+	values := yabf.KVMap{"field0": yabf.Binary("a"), "field1": yabf.Binary("b")}
+	require.Equal(t, yabf.StatusNotFound, db.Update(table, "k0", values))
+	require.Equal(t, yabf.StatusNotFound, db.Delete(table, "k2"))
+
+	db.upsert = true
+	require.Equal(t, yabf.StatusOK, db.Insert(table, "k1", values))
+	ret, _ := db.Read(table, "k1", []string{"field0"})
+	require.Equal(t, yabf.Binary("a"), ret["field0"])
+}
@@ -0,0 +1,139 @@
+package binding
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/hhkbp2/yabf"
+	_ "github.com/mattn/go-sqlite3"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+const (
+	PropertySqliteFile               = "sqlite.file"
+	PropertySqliteFileDefault        = "yabf.db"
+	PropertySqliteJournalMode        = "sqlite.journalmode"
+	PropertySqliteJournalModeDefault = "WAL"
+	PropertySqliteSynchronous        = "sqlite.synchronous"
+	PropertySqliteSynchronousDefault = "NORMAL"
+	PropertySqliteBusyTimeout        = "sqlite.busytimeout"
+	PropertySqliteBusyTimeoutDefault = "5000"
+	PropertySqliteMaxConns           = "sqlite.maxconns"
+	PropertySqliteMaxConnsDefault    = "0"
+	PropertySqlitePrimaryKey         = "sqlite.primarykey"
+	PropertySqlitePrimaryKeyDefault  = "yabf_key"
+)
+
+// A connection pool to a database file, which is shared by all the SqliteDB
+// instances of it.
+type sqlitePool struct {
+	db   *sql.DB
+	refs int
+}
+
+var (
+	sqlitePools     = make(map[string]*sqlitePool)
+	sqlitePoolsLock sync.Mutex
+)
+
+// SqliteDB is the binding of the embedded SQLite. It runs the same
+// statements as MysqlDB, on the connection pool shared by all the client
+// routines, which is opened on the first Init() and closed on the last
+// Cleanup(). The table of "fieldcount" fields is created if it doesn't exist.
+type SqliteDB struct {
+	*MysqlDB
+	file string
+}
+
+func NewSqliteDB() *SqliteDB {
+	return &SqliteDB{
+		MysqlDB: NewMysqlDB(),
+	}
+}
+
+func (self *SqliteDB) Init() error {
+	props := self.GetProperties()
+	file := props.GetDefault(PropertySqliteFile, PropertySqliteFileDefault)
+	journalMode := props.GetDefault(PropertySqliteJournalMode, PropertySqliteJournalModeDefault)
+	synchronous := props.GetDefault(PropertySqliteSynchronous, PropertySqliteSynchronousDefault)
+	propStr := props.GetDefault(PropertySqliteBusyTimeout, PropertySqliteBusyTimeoutDefault)
+	busyTimeout, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return err
+	}
+	propStr = props.GetDefault(PropertySqliteMaxConns, PropertySqliteMaxConnsDefault)
+	maxConns, err := strconv.ParseInt(propStr, 0, 32)
+	if err != nil {
+		return err
+	}
+	self.primaryKey = props.GetDefault(PropertySqlitePrimaryKey, PropertySqlitePrimaryKeyDefault)
+
+	sqlitePoolsLock.Lock()
+	defer sqlitePoolsLock.Unlock()
+	pool, ok := sqlitePools[file]
+	if !ok {
+		query := url.Values{}
+		query.Set("_journal_mode", journalMode)
+		query.Set("_synchronous", synchronous)
+		query.Set("_busy_timeout", strconv.FormatInt(busyTimeout, 10))
+		db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?%s", file, query.Encode()))
+		if err != nil {
+			return err
+		}
+		db.SetMaxOpenConns(int(maxConns))
+		if err = self.createTable(db); err != nil {
+			db.Close()
+			return err
+		}
+		pool = &sqlitePool{db: db}
+		sqlitePools[file] = pool
+	}
+	pool.refs++
+	self.file = file
+	self.db = pool.db
+	return nil
+}
+
+// Create the table of the workload if it doesn't exist, with the primary
+// key and "fieldcount" fields of bytes.
+func (self *SqliteDB) createTable(db *sql.DB) error {
+	props := self.GetProperties()
+	table := props.GetDefault(yabf.PropertyTableName, yabf.PropertyTableNameDefault)
+	propStr := props.GetDefault(yabf.PropertyFieldCount, yabf.PropertyFieldCountDefault)
+	fieldCount, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return err
+	}
+	fieldPrefix := props.GetDefault(yabf.PropertyFieldPrefix, yabf.PropertyFieldPrefixDefault)
+	var buf bytes.Buffer
+	buf.WriteString(self.primaryKey)
+	buf.WriteString(" TEXT PRIMARY KEY")
+	for i := int64(0); i < fieldCount; i++ {
+		buf.WriteString(fmt.Sprintf(", %s%d BLOB", fieldPrefix, i))
+	}
+	_, err = db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, buf.String()))
+	return err
+}
+
+// Release the shared connection pool, which is closed by the last instance.
+func (self *SqliteDB) Cleanup() error {
+	if self.tx != nil {
+		self.tx.Rollback()
+		self.tx = nil
+	}
+	if self.db == nil {
+		return nil
+	}
+	self.db = nil
+	sqlitePoolsLock.Lock()
+	defer sqlitePoolsLock.Unlock()
+	pool := sqlitePools[self.file]
+	pool.refs--
+	if pool.refs > 0 {
+		return nil
+	}
+	delete(sqlitePools, self.file)
+	return pool.db.Close()
+}
@@ -0,0 +1,57 @@
+package binding
+
+import (
+	"github.com/hhkbp2/testify/require"
+	"github.com/hhkbp2/yabf"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestSqliteProps(t *testing.T) (yabf.Properties, func()) {
+	dir, err := ioutil.TempDir("", "sqlite")
+	require.Nil(t, err)
+	props := yabf.NewProperties()
+	props.Add(PropertySqliteFile, filepath.Join(dir, "test.db"))
+	props.Add(yabf.PropertyTableName, "t")
+	props.Add(yabf.PropertyFieldCount, "2")
+	return props, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSqliteDB(t *testing.T) {
+	props, remove := newTestSqliteProps(t)
+	defer remove()
+	db := NewSqliteDB()
+	db.SetProperties(props)
+	require.Nil(t, db.Init())
+	defer db.Cleanup()
+
+	var journalMode string
+	require.Nil(t, db.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	require.Equal(t, "wal", journalMode)
+
+	testBinding(t, db, "t")
+	testContextTransaction(t, db, "t")
+}
+
+// All the instances share one connection pool, which is closed by
+// the last one.
+func TestSqliteDBSharedPool(t *testing.T) {
+	props, remove := newTestSqliteProps(t)
+	defer remove()
+	dbs := make([]yabf.DB, 0)
+	for i := 0; i < 4; i++ {
+		db := NewSqliteDB()
+		db.SetProperties(props)
+		require.Nil(t, db.Init())
+		dbs = append(dbs, db)
+	}
+	require.True(t, dbs[0].(*SqliteDB).db == dbs[3].(*SqliteDB).db)
+	file := props.Get(PropertySqliteFile)
+	testSharedBinding(t, dbs, "t", func() bool {
+		return sqlitePools[file] != nil
+	})
+}
@@ -3,13 +3,16 @@ package yabf
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"math"
+	"math/rand"
 	"os"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hhkbp2/go-strftime"
@@ -23,6 +26,9 @@ type Client interface {
 type ClientBase struct {
 	Args           *Arguemnts
 	DoTransactions bool
+	// the routines of the current run
+	lock    sync.Mutex
+	workers []opsCounter
 }
 
 func NewClientBase(args *Arguemnts) *ClientBase {
@@ -54,33 +60,82 @@ func (self *ClientBase) CheckProperties() {
 			ExitOnError("property %s=%s conflicts with command %s", PropertyTransactions, propStr, self.Args.Command)
 		}
 	}
+	if _, _, err := parseSeed(self.Args.Properties); err != nil {
+		ExitOnError("%s", err)
+	}
+}
+
+// The result of one run of the workload.
+type RunResult struct {
+	// the start time in milliseconds since epoch, after warm-up if any
+	StartTime int64
+	// the number of operations done
+	Operations int64
+	// the run time in milliseconds
+	RunTime int64
+}
+
+// Return the overall throughput in operations per second.
+func (self *RunResult) Throughput() float64 {
+	return float64(self.Operations) * 1000.0 / float64(self.RunTime)
 }
 
 func (self *ClientBase) Main() {
 	self.CheckProperties()
 
 	props := self.Args.Properties
+	document := NewResultDocument(self.Args)
+	result := self.Run(props)
+	err := self.exportMeasurements(props, document, result)
+	if err != nil {
+		ExitOnError("could not export measurements, error: %s", err)
+	}
+}
+
+// Run the workload with the specified properties, and return the result.
+// The measurements of the run are left in GetMeasurements(). It exits
+// the process on error.
+func (self *ClientBase) Run(props Properties) *RunResult {
+	result, err := self.run(props)
+	if err != nil {
+		ExitOnError("%s", err)
+	}
+	return result
+}
+
+// Run the workload with the specified properties, and return the result
+// or the error which fails the run.
+func (self *ClientBase) run(props Properties) (*RunResult, error) {
+	// copy the properties so that the ones of the caller are left untouched
+	props = NewProperties().Merge(props)
+	props.Add(PropertyTransactions, strconv.FormatBool(self.DoTransactions))
 	propStr := props.GetDefault(PropertyMaxExecutionTime, PropertyMaxExecutionTimeDefault)
 	maxExecutionTime, err := strconv.ParseInt(propStr, 0, 64)
 	if err != nil {
-		ExitOnError("invalid property %s=%s, should be integer", PropertyMaxExecutionTime, propStr)
+		return nil, g.NewErrorf("invalid property %s=%s, should be integer", PropertyMaxExecutionTime, propStr)
 	}
 	// get number of threads, target and db
 	propStr = props.GetDefault(PropertyThreadCount, PropertyThreadCountDefault)
 	threadCount, err := strconv.ParseInt(propStr, 0, 64)
 	if err != nil {
-		ExitOnError("invalid property %s=%s, should be integer", PropertyThreadCount, propStr)
+		return nil, g.NewErrorf("invalid property %s=%s, should be integer", PropertyThreadCount, propStr)
 	}
 	dbName := props.GetDefault(PropertyDB, PropertyDBDefault)
-	propStr = props.GetDefault(PropertyTarget, PropertyTargetDefault)
-	target, err := strconv.ParseInt(propStr, 0, 64)
+	loadMode := props.GetDefault(PropertyLoadMode, PropertyLoadModeDefault)
+	if (loadMode != "closed") && (loadMode != "open") {
+		return nil, g.NewErrorf("invalid property %s=%s, should be closed or open", PropertyLoadMode, loadMode)
+	}
+	schedule, err := NewTargetSchedule(props)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := servePrometheus(props)
 	if err != nil {
-		ExitOnError("invalid property %s=%s, should be integer", PropertyTarget, propStr)
+		return nil, g.NewErrorf("fail to serve prometheus metrics, error: %s", err)
 	}
-	targetPerThreadPerMS := float64(-1)
-	if target > 0 {
-		targetPerThread := float64(target) / float64(threadCount)
-		targetPerThreadPerMS = targetPerThread / 1000.0
+	var threadSchedule TargetSchedule
+	if schedule != nil {
+		threadSchedule = NewScaledTargetSchedule(schedule, 1.0/float64(threadCount))
 	}
 
 	Printf("YCSB Client 0.1")
@@ -106,50 +161,98 @@ func (self *ClientBase) Main() {
 	// load the workload
 	workloadName := props.Get(PropertyWorkload)
 	workload, err := NewWorkload(workloadName)
-	if err != nil {
-		ExitOnError("%s", err)
-	}
-	if err = workload.Init(props); err != nil {
-		ExitOnError("%s", err)
+	if err == nil {
+		err = workload.Init(props)
 	}
 	warningCh <- 1
+	if err != nil {
+		return nil, err
+	}
 
 	// run the workload
 	Printf("Starting test.")
 	var opCount int64
-	if self.Args.Command == "run" {
+	if self.DoTransactions {
 		propStr = props.GetDefault(PropertyOperationCount, PropertyOperationCountDefault)
 		opCount, err = strconv.ParseInt(propStr, 0, 64)
 		if err != nil {
-			ExitOnError("invalid property %s=%s, should be integer", PropertyOperationCount, propStr)
+			return nil, g.NewErrorf("invalid property %s=%s, should be integer", PropertyOperationCount, propStr)
 		}
 	} else {
+		// insert all the records unless the insert count is specified
 		propStr, ok := props[PropertyInsertCount]
-		if ok {
-			opCount, err = strconv.ParseInt(propStr, 0, 64)
-		} else {
-			opCount, _ = strconv.ParseInt(PropertyRecordCountDefault, 0, 64)
+		if !ok {
+			propStr = props.GetDefault(PropertyRecordCount, PropertyRecordCountDefault)
+		}
+		opCount, err = strconv.ParseInt(propStr, 0, 64)
+		if err != nil {
+			return nil, g.NewErrorf("invalid property %s=%s, should be integer", PropertyInsertCount, propStr)
 		}
 	}
 
+	// all the operations in flight are canceled when the run is over
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	resultCh := make(chan int64, threadCount)
 	// init all worker routines
 	workerCh := make(chan int, threadCount)
-	workers := make([]*Worker, 0, threadCount)
-	startTime := NowNS()
-	for i := int64(0); i < threadCount; i++ {
-		db, err := NewDB(dbName, props)
+	workers := make([]opsCounter, 0, threadCount)
+	// the routines are started after all of them are created, so that
+	// none is left running if the run fails to start
+	routines := make([]func(), 0, threadCount)
+	// the number of routines to wait for
+	routineCount := threadCount
+	if loadMode == "open" {
+		dispatcher, err := NewOpenLoopDispatcher(ctx, dbName, workload, props, self.DoTransactions, opCount, schedule, workerCh, resultCh)
 		if err != nil {
-			ExitOnError("fail to create db, error: %s", err)
+			return nil, g.NewErrorf("fail to create open loop dispatcher, error: %s", err)
 		}
-		threadOpCount := opCount / threadCount
-		// ensure correct number of operations, in case opCount is not a multiple of threadCount
-		if i < (opCount % threadCount) {
-			threadOpCount++
+		workers = append(workers, dispatcher)
+		routines = append(routines, dispatcher.run)
+		routineCount = 1
+	} else {
+		for i := int64(0); i < threadCount; i++ {
+			db, err := NewDBWithContext(ctx, dbName, props)
+			if err != nil {
+				return nil, g.NewErrorf("fail to create db, error: %s", err)
+			}
+			threadOpCount := opCount / threadCount
+			// ensure correct number of operations, in case opCount is not a multiple of threadCount
+			if i < (opCount % threadCount) {
+				threadOpCount++
+			}
+			random, err := NewRandomStream(props, i)
+			if err != nil {
+				return nil, g.NewErrorf("fail to create random stream, error: %s", err)
+			}
+			worker := NewWorker(ctx, db, workload, random, props, self.DoTransactions, threadOpCount, threadSchedule, workerCh, resultCh)
+			workers = append(workers, worker)
+			routines = append(routines, worker.run)
+		}
+	}
+	warmup, err := newWarmup(props, workers)
+	if err != nil {
+		return nil, err
+	}
+	_, status := self.Args.Options["s"]
+	var statusIntervalSeconds int64
+	if status {
+		propStr = props.GetDefault(PropertyStatusInterval, PropertyStatusIntervalDefault)
+		statusIntervalSeconds, err = strconv.ParseInt(propStr, 0, 64)
+		if err != nil {
+			return nil, g.NewErrorf("invalid property %s=%s, should be integer", PropertyStatusInterval, propStr)
 		}
-		worker := NewWorker(db, workload, props, self.DoTransactions, threadOpCount, targetPerThreadPerMS, workerCh, resultCh)
-		workers = append(workers, worker)
-		go worker.run()
+	}
+
+	startTime := NowNS()
+	for _, routine := range routines {
+		go routine()
+	}
+	self.lock.Lock()
+	self.workers = workers
+	self.lock.Unlock()
+	if exporter != nil {
+		exporter.setClient(self)
 	}
 
 	stopCh := make(chan int, 1)
@@ -158,29 +261,27 @@ func (self *ClientBase) Main() {
 	if l, ok := self.Args.Options["l"]; ok {
 		label = l
 	}
-	_, status := self.Args.Options["s"]
 	if status {
 		standardStatus := false
 		propStr, ok := props[PropertyMeasurementType]
 		if ok && (propStr == "timeseries") {
 			standardStatus = true
 		}
-		propStr = props.GetDefault(PropertyStatusInterval, PropertyStatusIntervalDefault)
-		statusIntervalSeconds, err := strconv.ParseInt(propStr, 0, 64)
-		if err != nil {
-			ExitOnError("invalid property %s=%s, should be integer", PropertyStatusInterval, propStr)
-		}
-		reporter := NewStatusReporter(workers, stopCh, waitGroup, standardStatus, statusIntervalSeconds, label)
+		reporter := NewStatusReporter(workers, stopCh, waitGroup, standardStatus, statusIntervalSeconds, label, schedule)
 		waitGroup.Add(1)
 		go reporter.run()
 	}
 
+	warmupStopCh := make(chan int, 1)
+	waitGroup.Add(1)
+	go warmup.run(startTime, warmupStopCh, waitGroup)
+
 	workerDoneCount := int64(0)
 	total := int64(0)
 	if maxExecutionTime > 0 {
 		deadline := startTime + SecondToNanosecond(maxExecutionTime)
 		now := NowNS()
-		for (workerDoneCount < threadCount) && (now <= deadline) {
+		for (workerDoneCount < routineCount) && (now <= deadline) {
 			select {
 			case t := <-resultCh:
 				total += t
@@ -191,7 +292,7 @@ func (self *ClientBase) Main() {
 			now = NowNS()
 		}
 	} else {
-		for workerDoneCount < threadCount {
+		for workerDoneCount < routineCount {
 			select {
 			case t := <-resultCh:
 				total += t
@@ -200,18 +301,21 @@ func (self *ClientBase) Main() {
 		}
 	}
 
-	// stop all worker routine
-	for i := int64(0); i < threadCount; i++ {
+	// stop all worker routine, and abort the operations which are still
+	// in flight so that a hung database couldn't block the shutdown.
+	cancel()
+	for i := int64(0); i < routineCount; i++ {
 		workerCh <- 1
 	}
 
+	// stop status and warm-up routine
 	if status {
-		// stop status routine
 		stopCh <- 1
-		waitGroup.Wait()
 	}
+	warmupStopCh <- 1
+	waitGroup.Wait()
 	// wait for all routine to stop
-	for workerDoneCount < threadCount {
+	for workerDoneCount < routineCount {
 		select {
 		case t := <-resultCh:
 			total += t
@@ -223,60 +327,176 @@ func (self *ClientBase) Main() {
 
 	err = workload.Cleanup()
 	if err != nil {
-		ExitOnError("fail to cleanup workload, error: %s", err)
+		return nil, g.NewErrorf("fail to cleanup workload, error: %s", err)
 	}
 
-	err = exportMeasurements(props, total, NanosecondToMillisecond(endTime-startTime))
+	if warmup.ended {
+		// only the measured window after warm-up counts
+		total -= warmup.opDone
+		startTime = warmup.endTime
+	} else if warmup.enabled() {
+		Warnf("the run ends before warm-up ends, the measurements include warm-up")
+	}
+	return &RunResult{
+		StartTime:  NanosecondToMillisecond(startTime),
+		Operations: total,
+		RunTime:    NanosecondToMillisecond(endTime - startTime),
+	}, nil
+}
+
+// Return the routines of the current run, or the last one if there is
+// no run in progress.
+func (self *ClientBase) getWorkers() []opsCounter {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.workers
+}
+
+// Return the total amount of operations done so far by the current run,
+// or the last one if there is no run in progress.
+func (self *ClientBase) OpsDone() int64 {
+	var total int64
+	for _, worker := range self.getWorkers() {
+		total += worker.getOpsDone()
+	}
+	return total
+}
+
+// The warm-up period at the beginning of a run. The workload runs normally
+// during warm-up, but the measurements are discarded when it ends.
+type warmup struct {
+	timeNS     int64
+	operations int64
+	workers    []opsCounter
+	// whether it's ended, the time when it ends and the operations done
+	// by then, which are set by run()
+	ended   bool
+	endTime int64
+	opDone  int64
+}
+
+func newWarmup(props Properties, workers []opsCounter) (*warmup, error) {
+	propStr := props.GetDefault(PropertyWarmupTime, PropertyWarmupTimeDefault)
+	seconds, err := strconv.ParseInt(propStr, 0, 64)
 	if err != nil {
-		ExitOnError("could not export measurements, error: %s", err)
+		return nil, g.NewErrorf("invalid property %s=%s, should be integer", PropertyWarmupTime, propStr)
+	}
+	propStr = props.GetDefault(PropertyWarmupOperations, PropertyWarmupOperationsDefault)
+	operations, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return nil, g.NewErrorf("invalid property %s=%s, should be integer", PropertyWarmupOperations, propStr)
+	}
+	return &warmup{
+		timeNS:     SecondToNanosecond(seconds),
+		operations: operations,
+		workers:    workers,
+	}, nil
+}
+
+func (self *warmup) enabled() bool {
+	return (self.timeNS > 0) || (self.operations > 0)
+}
+
+func (self *warmup) getOpsDone() int64 {
+	var total int64
+	for _, worker := range self.workers {
+		total += worker.getOpsDone()
+	}
+	return total
+}
+
+// Wait for the warm-up to end, and then reset the measurements.
+func (self *warmup) run(startTime int64, stopCh chan int, waitGroup *sync.WaitGroup) {
+	defer waitGroup.Done()
+	if !self.enabled() {
+		<-stopCh
+		return
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			now := NowNS()
+			opDone := self.getOpsDone()
+			if (now-startTime >= self.timeNS) && (opDone >= self.operations) {
+				GetMeasurements().Reset()
+				self.ended = true
+				self.endTime = now
+				self.opDone = opDone
+				Infof("warm-up ends after %d ms and %d operations",
+					NanosecondToMillisecond(now-startTime), opDone)
+				<-stopCh
+				return
+			}
+		}
 	}
 }
 
 // A routine for executing transactions or data inserts to the database.
 type Worker struct {
-	db                   DB
-	workload             Workload
-	props                Properties
-	doTransactions       bool
-	opCount              int64
-	targetPerThreadPerMS float64
-	targetOpsPerMS       float64
-	targetOpsTickNS      int64
-	opDone               int64
-	stopCh               chan int
-	resultCh             chan int64
-	measurements         Measurements
-}
-
-func NewWorker(db DB, workload Workload, props Properties, doTransactions bool, opCount int64, targetPerThreadPerMS float64, stopCh chan int, resultCh chan int64) *Worker {
-	targetOpsPerMS := targetPerThreadPerMS
-	targetOpsTickNS := int64(1000000.0 / targetOpsPerMS)
+	ctx           context.Context
+	db            DB
+	workload      Workload
+	batchWorkload BatchWorkload
+	// the random source of this routine
+	random         *rand.Rand
+	props          Properties
+	doTransactions bool
+	opCount        int64
+	// the schedule of target throughput of this routine, nil for no throttling
+	schedule TargetSchedule
+	// the time of the next operation in the schedule, in nanoseconds since
+	// the start of the routine
+	nextOpTime   int64
+	scheduledOps int64
+	dbWrapper    *DBWrapper
+	opDone       int64
+	// 1 when an operation is in progress, otherwise 0
+	inFlight     int32
+	stopCh       chan int
+	resultCh     chan int64
+	measurements Measurements
+}
+
+func NewWorker(ctx context.Context, db DB, workload Workload, random *rand.Rand, props Properties, doTransactions bool, opCount int64, schedule TargetSchedule, stopCh chan int, resultCh chan int64) *Worker {
+	batchWorkload, _ := workload.(BatchWorkload)
+	dbWrapper, _ := db.(*DBWrapper)
 	return &Worker{
-		db:                   db,
-		workload:             workload,
-		props:                props,
-		opCount:              opCount,
-		doTransactions:       doTransactions,
-		targetPerThreadPerMS: targetPerThreadPerMS,
-		targetOpsPerMS:       targetOpsPerMS,
-		targetOpsTickNS:      targetOpsTickNS,
-		stopCh:               stopCh,
-		resultCh:             resultCh,
-		measurements:         GetMeasurements(),
+		ctx:            ctx,
+		db:             db,
+		workload:       workload,
+		batchWorkload:  batchWorkload,
+		random:         random,
+		props:          props,
+		opCount:        opCount,
+		doTransactions: doTransactions,
+		schedule:       schedule,
+		dbWrapper:      dbWrapper,
+		stopCh:         stopCh,
+		resultCh:       resultCh,
+		measurements:   GetMeasurements(),
 	}
 }
 
 func (self *Worker) run() {
 	defer func() {
-		self.resultCh <- self.opDone
+		self.resultCh <- self.getOpsDone()
 	}()
 
+	// the database draws from a stream of its own, so that it doesn't
+	// shift the stream of the workload
+	if db, ok := self.db.(RandomDB); ok {
+		db.SetRandom(newChildRandom(self.random))
+	}
 	if err := self.db.Init(); err != nil {
 		EPrintf("worker routine fail to init db, error: %s", err)
 		self.resultCh <- 0
 		return
 	}
-	workloadState, err := self.workload.InitRoutine(self.props)
+	workloadState, err := self.workload.InitRoutine(self.props, self.random)
 	if err != nil {
 		EPrintf("workload fail to init routine, error: %s", err)
 		return
@@ -285,31 +505,52 @@ func (self *Worker) run() {
 	// the measurements and the routine have the save view on time.
 	// spread the thread operations out so they don't all hit the DB at the
 	// same time.
-	if (self.targetOpsPerMS > 0) && (self.targetOpsPerMS <= 1.0) {
-		randomMinorDelay := g.NextInt64(self.targetOpsTickNS)
-		time.Sleep(time.Duration(int64(time.Nanosecond) * randomMinorDelay))
+	if self.schedule != nil {
+		target := self.schedule.TargetAt(0)
+		if (target > 0) && (target <= 1000.0) {
+			randomMinorDelay := self.random.Int63n(ConstantInterval(target))
+			time.Sleep(time.Duration(int64(time.Nanosecond) * randomMinorDelay))
+		}
 	}
 
 	startTime := NowNS()
+	self.setIntendedStartTime(startTime)
 WORKER_LOOP:
-	for (self.opCount == 0) || (self.opDone < self.opCount) {
+	for (self.opCount == 0) || (self.getOpsDone() < self.opCount) {
 		select {
 		case <-self.stopCh:
 			break WORKER_LOOP
+		case <-self.ctx.Done():
+			break WORKER_LOOP
 		default:
+			atomic.StoreInt32(&self.inFlight, 1)
 			if self.doTransactions {
 				if !self.workload.DoTransaction(self.db, workloadState) {
 					break WORKER_LOOP
 				}
+				atomic.AddInt64(&self.opDone, 1)
+			} else if self.batchWorkload != nil {
+				// the operations of load phase are counted in records
+				todo := int64(0)
+				if self.opCount > 0 {
+					todo = self.opCount - self.getOpsDone()
+				}
+				n, ok := self.batchWorkload.DoBatchInsert(self.db, workloadState, todo)
+				atomic.AddInt64(&self.opDone, n)
+				if !ok {
+					break WORKER_LOOP
+				}
 			} else {
 				if !self.workload.DoInsert(self.db, workloadState) {
 					break WORKER_LOOP
 				}
+				atomic.AddInt64(&self.opDone, 1)
 			}
-			self.opDone++
+			atomic.StoreInt32(&self.inFlight, 0)
 			self.throttleNanos(startTime)
 		}
 	}
+	atomic.StoreInt32(&self.inFlight, 0)
 	if err = self.db.Cleanup(); err != nil {
 		EPrintf("cleanup database error: %s", err)
 	}
@@ -324,41 +565,71 @@ func waitUtil(to int64) {
 }
 
 func (self *Worker) throttleNanos(startTime int64) {
-	if self.targetOpsPerMS > 0 {
-		// delay until next tick
-		deadline := startTime + self.opDone*self.targetOpsTickNS
+	if self.schedule != nil {
+		// follow the schedule for the operations done, and delay until
+		// the time of the next one
+		for opDone := self.getOpsDone(); self.scheduledOps < opDone; self.scheduledOps++ {
+			self.nextOpTime = NextScheduledTime(self.schedule, self.nextOpTime, ConstantInterval)
+		}
+		deadline := startTime + self.nextOpTime
 		waitUtil(deadline)
+		self.setIntendedStartTime(deadline)
+	}
+}
+
+// Tell the database the time the next operation is scheduled at,
+// so that the coordinated omission could be corrected.
+func (self *Worker) setIntendedStartTime(t int64) {
+	if (self.schedule != nil) && (self.dbWrapper != nil) {
+		self.dbWrapper.SetIntendedStartTime(t)
 	}
 }
 
 // the total amount of work this routine is still expected to do.
 func (self *Worker) getOpsDone() int64 {
-	return self.opDone
+	return atomic.LoadInt64(&self.opDone)
 }
 
 // the operations left for this routine to do.
 func (self *Worker) getOpsTodo() int64 {
-	todo := self.opCount - self.opDone
+	todo := self.opCount - self.getOpsDone()
 	if todo < 0 {
 		return 0
 	}
 	return todo
 }
 
+// the operations in progress, at most 1.
+func (self *Worker) getInFlight() int64 {
+	return int64(atomic.LoadInt32(&self.inFlight))
+}
+
+// The progress of a routine issuing operations, which is shown by StatusReporter.
+type opsCounter interface {
+	// the total amount of operations completed.
+	getOpsDone() int64
+	// the operations left to do.
+	getOpsTodo() int64
+	// the operations in progress.
+	getInFlight() int64
+}
+
 // A routine to periodically show the status of the experiement, to reassure
 // you that process is being made.
 type StatusReporter struct {
 	// the worker routines that are running
-	workers        []*Worker
+	workers        []opsCounter
 	stopCh         chan int
 	waitGroup      *sync.WaitGroup
 	standardStatus bool
 	// the interval for reporting status
 	sleepTimeNS int64
 	label       string
+	// the schedule of the target throughput, nil for no throttling
+	schedule TargetSchedule
 }
 
-func NewStatusReporter(workers []*Worker, stopCh chan int, waitGroup *sync.WaitGroup, standardStatus bool, intervalSeconds int64, label string) *StatusReporter {
+func NewStatusReporter(workers []opsCounter, stopCh chan int, waitGroup *sync.WaitGroup, standardStatus bool, intervalSeconds int64, label string, schedule TargetSchedule) *StatusReporter {
 	return &StatusReporter{
 		workers:        workers,
 		stopCh:         stopCh,
@@ -366,6 +637,7 @@ func NewStatusReporter(workers []*Worker, stopCh chan int, waitGroup *sync.WaitG
 		standardStatus: standardStatus,
 		sleepTimeNS:    SecondToNanosecond(intervalSeconds),
 		label:          label,
+		schedule:       schedule,
 	}
 }
 
@@ -419,6 +691,10 @@ func (self *StatusReporter) computeStats(startTimeMS int64, startIntervalMS int6
 	if totalOps != 0 {
 		buf.WriteString(fmt.Sprintf("%.2f current ops/sec; ", currentThrough))
 	}
+	if self.schedule != nil {
+		target := self.schedule.TargetAt(MillisecondToNanosecond(interval))
+		buf.WriteString(fmt.Sprintf("%.2f target ops/sec; ", target))
+	}
 	if todoOps != 0 {
 		buf.WriteString(fmt.Sprintf("est completion in %s; ", formatRemaining(int64(estimateRemaining))))
 	}
@@ -482,16 +758,43 @@ func NewRunner(args *Arguemnts) *Runner {
 }
 
 // Exports the measurements to either stdout or a file using the exporter
-// specified by conf.
-func exportMeasurements(props Properties, opCount, runtime int64) error {
+// specified by conf, and writes the result document if it's specified.
+func (self *ClientBase) exportMeasurements(props Properties, document *ResultDocument, result *RunResult) error {
+	exporter, err := openMeasurementExporter(props, self.Args.Options["l"])
+	if err != nil {
+		return err
+	}
+	defer exporter.Close()
+	command := "load"
+	if self.DoTransactions {
+		command = "run"
+	}
+	phase := document.AddPhase(command, command, props, result)
+	if err = writeMeasurements(phase.Recorder(exporter), result.Operations, result.RunTime); err != nil {
+		return err
+	}
+	return document.Write(props)
+}
+
+// Open the exporter specified by conf, which writes to either stdout or a file.
+func openMeasurementExporter(props Properties, label string) (MeasurementExporter, error) {
 	var f *os.File
 	propStr, ok := props[PropertyExportFile]
 	var err error
 	// if no destination file is specified then the results will be written to stdout.
 	if ok && (len(propStr) > 0) {
-		f, err = os.Open(propStr)
+		appendStr := props.GetDefault(PropertyExportFileAppend, PropertyExportFileAppendDefault)
+		doAppend, err := strconv.ParseBool(appendStr)
+		if err != nil {
+			return nil, g.NewErrorf("invalid property %s=%s, should be bool", PropertyExportFileAppend, appendStr)
+		}
+		flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if doAppend {
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err = os.OpenFile(propStr, flag, 0666)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	} else {
 		f = os.Stdout
@@ -499,16 +802,28 @@ func exportMeasurements(props Properties, opCount, runtime int64) error {
 
 	// if no exporter is provided then the default text one will be used
 	propStr = props.GetDefault(PropertyExporter, PropertyExporterDefault)
-	exporter, err := NewMeasurementExporter(propStr, f)
+	exporter, err := NewMeasurementExporter(propStr, f, props, label)
 	if err != nil {
 		EPrintf("Could not find exporter %s, will use default text exporter.", propStr)
 		exporter = NewTextMeasurementExporter(f)
 	}
-	defer exporter.Close()
+	return exporter, nil
+}
+
+// Write the overall result and the measurements of a run to the exporter.
+func writeMeasurements(exporter MeasurementExporter, opCount, runtime int64) error {
 	exporter.Write("OVERALL", "RunTime(ms)", runtime)
 	throughput := float64(opCount) * 1000.0 / float64(runtime)
 	exporter.Write("OVERALL", "Throughput(ops/sec)", throughput)
-	GetMeasurements().ExportMeasurements(exporter)
+	measurements := GetMeasurements()
+	if err := measurements.ExportMeasurements(exporter); err != nil {
+		return err
+	}
+	for _, op := range []string{"BATCH-INSERT", "MULTI-READ"} {
+		if records := measurements.GetCount(op, "Records"); records > 0 {
+			exporter.Write(op, "Throughput(records/sec)", float64(records)*1000.0/float64(runtime))
+		}
+	}
 	return nil
 }
 
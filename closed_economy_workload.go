@@ -0,0 +1,333 @@
+package yabf
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// ClosedEconomyWorkload represents a benchmark scenario which moves money
+// between the records. Every record holds a balance, and the money is
+// neither created nor destroyed by the transfers, so the total of all
+// the balances should never change. Any lost update or dirty write made
+// by the database under concurrency breaks this invariant, which is
+// validated by reading all the records back when the workload is cleaned up.
+// The result of the validation is reported under the label "VALIDATION",
+// and the run fails if the invariant is broken.
+// The money is moved only among the records from "insertstart" to
+// "insertstart" + "insertcount", which are the whole table by default, so
+// that the clients working on separate ranges of the table validate their
+// own ranges.
+// Properties to control the client, besides the ones of CoreWorkload:
+//   totalcash: the total amount of money in all the records, which is
+//              divided evenly among them during load (default: 1000000)
+//   readproportion: what proportion of operations should be reads of
+//                   a balance (default: 0.95)
+//   transferproportion: what proportion of operations should be transfers
+//                       between two records (default: 0.05)
+//   transactional: should the two reads and two writes of a transfer
+//                  be done in one database transaction (default: false)
+type ClosedEconomyWorkload struct {
+	*CoreWorkload
+	props          Properties
+	doTransactions bool
+	balanceField   string
+	initialBalance int64
+	// the range of the records which the money is moved among
+	keyStart int64
+	keyCount int64
+	// the total of all the balances which is expected at the validation
+	expectedTotal int64
+	// the total amount of the transfers which may or may not be lost by
+	// the failed writes, so the total of all the balances is expected to be
+	// in [expectedTotal - uncertainTotal, expectedTotal]
+	uncertainTotal int64
+}
+
+func NewClosedEconomyWorkload() *ClosedEconomyWorkload {
+	return &ClosedEconomyWorkload{
+		CoreWorkload: NewCoreWorkload(),
+	}
+}
+
+func (self *ClosedEconomyWorkload) Init(p Properties) (err error) {
+	defer catch(&err)
+	try(self.CoreWorkload.Init(p))
+	propStr := p.GetDefault(PropertyTotalCash, PropertyTotalCashDefault)
+	totalCash, err := strconv.ParseInt(propStr, 0, 64)
+	try(err)
+	propStr = p.GetDefault(PropertyReadProportion, PropertyReadProportionDefault)
+	readProportion, err := strconv.ParseFloat(propStr, 64)
+	try(err)
+	propStr = p.GetDefault(PropertyTransferProportion, PropertyTransferProportionDefault)
+	transferProportion, err := strconv.ParseFloat(propStr, 64)
+	try(err)
+	propStr = p.GetDefault(PropertyTransactions, "false")
+	doTransactions, err := strconv.ParseBool(propStr)
+	try(err)
+	if self.recordCount <= 0 {
+		try(g.NewErrorf("invalid %s=%d, should be positive", PropertyRecordCount, self.recordCount))
+	}
+	propStr = p.GetDefault(PropertyInsertStart, PropertyInsertStartDefault)
+	keyStart, err := strconv.ParseInt(propStr, 0, 64)
+	try(err)
+	propStr = p.GetDefault(PropertyInsertCount, strconv.FormatInt(self.recordCount-keyStart, 10))
+	keyCount, err := strconv.ParseInt(propStr, 0, 64)
+	try(err)
+	if (keyStart < 0) || (keyCount <= 0) || (keyStart+keyCount > self.recordCount) {
+		try(g.NewErrorf("invalid %s=%d and %s=%d for %d records",
+			PropertyInsertStart, keyStart, PropertyInsertCount, keyCount, self.recordCount))
+	}
+	initialBalance := totalCash / self.recordCount
+	if initialBalance <= 0 {
+		try(g.NewErrorf("%s=%d is too small for %d records", PropertyTotalCash, totalCash, self.recordCount))
+	}
+	operationChooser := g.NewDiscreteGenerator()
+	if transferProportion > 0 {
+		operationChooser.AddValue(transferProportion, "TRANSFER")
+	}
+	if readProportion > 0 {
+		operationChooser.AddValue(readProportion, "READ")
+	}
+
+	self.props = p
+	self.doTransactions = doTransactions
+	self.balanceField = self.fieldNames[0]
+	self.initialBalance = initialBalance
+	self.keyStart = keyStart
+	self.keyCount = keyCount
+	self.operationChooser = operationChooser
+	// all the records of the range are expected to be loaded by a former
+	// load phase
+	self.expectedTotal = initialBalance * keyCount
+	return
+}
+
+func (self *ClosedEconomyWorkload) encodeBalance(balance int64) KVMap {
+	return KVMap{
+		self.balanceField: Binary(strconv.FormatInt(balance, 10)),
+	}
+}
+
+func (self *ClosedEconomyWorkload) decodeBalance(values KVMap) (int64, bool) {
+	v, ok := values[self.balanceField]
+	if !ok {
+		return 0, false
+	}
+	balance, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return balance, true
+}
+
+// Insert one record with the initial balance.
+func (self *ClosedEconomyWorkload) DoInsert(db DB, object interface{}) bool {
+	keyNumber := self.keySequence.NextInt()
+	dbKey := self.buildKeyName(keyNumber)
+	values := self.encodeBalance(self.initialBalance)
+	return self.insertWithRetry(routineState(object), func() StatusType {
+		return db.Insert(self.table, dbKey, values)
+	})
+}
+
+// The records are always inserted one by one with the initial balance.
+func (self *ClosedEconomyWorkload) DoBatchInsert(db DB, object interface{}, count int64) (int64, bool) {
+	return 1, self.DoInsert(db, object)
+}
+
+func (self *ClosedEconomyWorkload) DoTransaction(db DB, object interface{}) bool {
+	state := routineState(object)
+	op := state.operationChooser.NextStringFrom(state.random)
+	switch op {
+	case "TRANSFER":
+		return self.DoTransactionTransfer(db, state)
+	default:
+		keyName := self.buildKeyName(self.nextAccount(state))
+		db.Read(self.table, keyName, []string{self.balanceField})
+	}
+	return true
+}
+
+// Transfer a random amount of money from one random record to another,
+// by reading both the balances and writing them back.
+// The transfer is done in one database transaction if "transactional"
+// is set, otherwise it's subject to the lost updates by other routines,
+// which are expected to be caught by the validation.
+func (self *ClosedEconomyWorkload) DoTransactionTransfer(db DB, state *coreRoutineState) bool {
+	fromKey := self.buildKeyName(self.nextAccount(state))
+	toKey := self.buildKeyName(self.nextAccount(state))
+	if fromKey == toKey {
+		return true
+	}
+	var txDB TransactionalDB
+	if self.transactional {
+		var ok bool
+		txDB, ok = db.(TransactionalDB)
+		if !ok {
+			Errorf("database doesn't support transactions")
+			return false
+		}
+		status := txDB.Begin()
+		if status != StatusOK {
+			self.measurements.ReportStatus("TRANSFER", status)
+			if status == StatusNotImplemented {
+				Errorf("database doesn't support transactions")
+				return false
+			}
+			return true
+		}
+	}
+	startTime := NowNS()
+	status := self.transfer(db, state, fromKey, toKey)
+	if txDB != nil {
+		if status == StatusOK {
+			status = txDB.Commit()
+		} else {
+			txDB.Abort()
+		}
+	}
+	endTime := NowNS()
+	self.measurements.Measure("TRANSFER", NanosecondToMicrosecond(endTime-startTime))
+	self.measurements.ReportStatus("TRANSFER", status)
+	return true
+}
+
+// Return the key number of a record in the range, which is chosen by
+// the request distribution and folded into the range.
+func (self *ClosedEconomyWorkload) nextAccount(state *coreRoutineState) int64 {
+	return self.keyStart + self.nextKeyNumber(state)%self.keyCount
+}
+
+func (self *ClosedEconomyWorkload) transfer(db DB, state *coreRoutineState, fromKey, toKey string) StatusType {
+	fields := []string{self.balanceField}
+	fromValues, status := db.Read(self.table, fromKey, fields)
+	if status != StatusOK {
+		return status
+	}
+	toValues, status := db.Read(self.table, toKey, fields)
+	if status != StatusOK {
+		return status
+	}
+	fromBalance, ok1 := self.decodeBalance(fromValues)
+	toBalance, ok2 := self.decodeBalance(toValues)
+	if !ok1 || !ok2 {
+		return StatusUnexpectedState
+	}
+	if fromBalance <= 0 {
+		// nothing to transfer
+		return StatusOK
+	}
+	amount := state.random.Int63n(fromBalance) + 1
+	status = db.Update(self.table, fromKey, self.encodeBalance(fromBalance-amount))
+	if status != StatusOK {
+		if !self.transactional && !isNotApplied(status) {
+			// the money may be taken from the record after all
+			atomic.AddInt64(&self.uncertainTotal, amount)
+		}
+		return status
+	}
+	status = db.Update(self.table, toKey, self.encodeBalance(toBalance+amount))
+	if (status != StatusOK) && !self.transactional {
+		// The money is lost because of the failed write rather than
+		// any isolation anomaly, so don't count it in the validation.
+		// The write which may be applied after all, e.g. the one timed out,
+		// may lose the money or not.
+		if isNotApplied(status) {
+			atomic.AddInt64(&self.expectedTotal, -amount)
+		} else {
+			atomic.AddInt64(&self.uncertainTotal, amount)
+		}
+	}
+	return status
+}
+
+// Return whether the write which fails with status is definitely not
+// applied by the database.
+func isNotApplied(status StatusType) bool {
+	switch status {
+	case StatusNotFound, StatusNotImplemented, StatusBadRequest, StatusForbidden:
+		return true
+	default:
+		return false
+	}
+}
+
+// Validate that the total of all the balances is the expected one after
+// the transaction phase. The load phase is not validated since it may
+// insert only a part of the records.
+func (self *ClosedEconomyWorkload) Cleanup() error {
+	if self.doTransactions {
+		err := self.validate()
+		if err != nil {
+			return err
+		}
+	}
+	return self.CoreWorkload.Cleanup()
+}
+
+// Read all the records of the range back and check the invariant.
+// The records which are missing or malformed are counted as anomalies.
+// An error is returned if the invariant is broken.
+func (self *ClosedEconomyWorkload) validate() error {
+	dbName := self.props.GetDefault(PropertyDB, PropertyDBDefault)
+	f, ok := Databases[dbName]
+	if !ok {
+		return g.NewErrorf("unsupported database: %s", dbName)
+	}
+	// use the database directly so that the reads for validation
+	// are not measured as the ones of the workload
+	db := f()
+	db.SetProperties(self.props)
+	if err := db.Init(); err != nil {
+		return err
+	}
+	defer db.Cleanup()
+	// read from the binding delegated to, e.g. the one under FaultyDB, so
+	// that the injected faults don't fail the validation
+	for {
+		d, ok := db.(delegatingDB)
+		if !ok || (d.delegate() == nil) {
+			break
+		}
+		db = d.delegate()
+	}
+
+	startTime := NowNS()
+	fields := []string{self.balanceField}
+	total := int64(0)
+	anomalies := int64(0)
+	for i := self.keyStart; i < self.keyStart+self.keyCount; i++ {
+		keyName := self.buildKeyName(i)
+		values, status := db.Read(self.table, keyName, fields)
+		if status != StatusOK {
+			anomalies++
+			continue
+		}
+		balance, ok := self.decodeBalance(values)
+		if !ok || (balance < 0) {
+			anomalies++
+			continue
+		}
+		total += balance
+	}
+	endTime := NowNS()
+	expectedTotal := atomic.LoadInt64(&self.expectedTotal)
+	uncertainTotal := atomic.LoadInt64(&self.uncertainTotal)
+	status := StatusOK
+	if (anomalies > 0) || (total > expectedTotal) || (total < expectedTotal-uncertainTotal) {
+		status = StatusUnexpectedState
+	}
+	self.measurements.Measure("VALIDATION", NanosecondToMicrosecond(endTime-startTime))
+	self.measurements.ReportStatus("VALIDATION", status)
+	self.measurements.Count("VALIDATION", "Anomalies", anomalies)
+	self.measurements.Count("VALIDATION", "Total", total)
+	self.measurements.Count("VALIDATION", "ExpectedTotal", expectedTotal)
+	self.measurements.Count("VALIDATION", "UncertainTotal", uncertainTotal)
+	if status != StatusOK {
+		return g.NewErrorf("validation failed, total: %d, expected total: %d, uncertain total: %d, anomalous records: %d",
+			total, expectedTotal, uncertainTotal, anomalies)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package yabf
+
+import (
+	"github.com/hhkbp2/testify/require"
+	"testing"
+)
+
+func newTestClosedEconomyProps(db string) Properties {
+	props := NewProperties()
+	props.Add(PropertyWorkload, "ClosedEconomyWorkload")
+	props.Add(PropertyDB, db)
+	props.Add(PropertyRecordCount, "20")
+	props.Add(PropertyOperationCount, "400")
+	// the transfers of concurrent routines may break the invariant
+	// since the memory binding doesn't isolate them
+	props.Add(PropertyThreadCount, "1")
+	props.Add(PropertyTotalCash, "2000")
+	props.Add(PropertyReadProportion, "0.5")
+	props.Add(PropertyTransferProportion, "0.5")
+	return props
+}
+
+// Load the workload on the memory binding.
+func loadClosedEconomy(t *testing.T, props Properties) {
+	resetMemoryTables()
+	ResetMeasurements()
+	_, err := NewLoader(&Arguemnts{Command: "load", Properties: props}).run(props)
+	require.Nil(t, err)
+}
+
+// Run the workload, and return the return codes of the validation and
+// the error of the run.
+func runClosedEconomy(t *testing.T, props Properties) (map[StatusType]uint32, error) {
+	ResetMeasurements()
+	_, err := NewRunner(&Arguemnts{Command: "run", Properties: props}).run(props)
+	// the properties of the caller are not changed by the run
+	_, ok := props[PropertyTransactions]
+	require.False(t, ok)
+	return GetMeasurements().Lookup("VALIDATION").GetReturnCodes(), err
+}
+
+func TestClosedEconomyWorkload(t *testing.T) {
+	defer ResetMeasurements()
+	props := newTestClosedEconomyProps("memory")
+	loadClosedEconomy(t, props)
+	codes, err := runClosedEconomy(t, props)
+	require.Nil(t, err)
+	require.Equal(t, map[StatusType]uint32{StatusOK: 1}, codes)
+	require.Equal(t, int64(2000), GetMeasurements().GetCount("VALIDATION", "Total"))
+
+	// the failed writes of the transfers are taken into account, whether
+	// they are applied or not, and the faults are not injected into
+	// the reads of the validation
+	props = newTestClosedEconomyProps("faulty")
+	props.Add(PropertyFaultyDB, "memory")
+	props.Add(PropertyFaultyErrors, "READ:TIMEOUT:0.1,UPDATE:NOT_FOUND:0.1,UPDATE:TIMEOUT:0.1")
+	loadClosedEconomy(t, newTestClosedEconomyProps("memory"))
+	codes, err = runClosedEconomy(t, props)
+	require.Nil(t, err)
+	require.Equal(t, map[StatusType]uint32{StatusOK: 1}, codes)
+	measurements := GetMeasurements()
+	require.Equal(t, int64(0), measurements.GetCount("VALIDATION", "Anomalies"))
+	require.True(t, measurements.GetCount("VALIDATION", "ExpectedTotal") < 2000)
+	require.True(t, measurements.GetCount("VALIDATION", "UncertainTotal") > 0)
+
+	// the money is moved and validated only in the range of the client
+	props = newTestClosedEconomyProps("memory")
+	loadClosedEconomy(t, props)
+	workload := NewClosedEconomyWorkload()
+	require.Nil(t, workload.Init(props))
+	db := NewMemoryDB()
+	require.Equal(t, StatusOK, db.Update(workload.table, workload.buildKeyName(0), workload.encodeBalance(1000)))
+	props.Add(PropertyInsertStart, "10")
+	props.Add(PropertyInsertCount, "10")
+	codes, err = runClosedEconomy(t, props)
+	require.Nil(t, err)
+	require.Equal(t, map[StatusType]uint32{StatusOK: 1}, codes)
+	require.Equal(t, int64(1000), GetMeasurements().GetCount("VALIDATION", "Total"))
+	for i := int64(1); i < 10; i++ {
+		values, status := db.Read(workload.table, workload.buildKeyName(i), nil)
+		require.Equal(t, StatusOK, status)
+		require.Equal(t, workload.encodeBalance(100), values)
+	}
+
+	// the run fails if the invariant is broken, which it is by the record
+	// out of the range above
+	props = newTestClosedEconomyProps("memory")
+	codes, err = runClosedEconomy(t, props)
+	require.NotNil(t, err)
+	require.Equal(t, uint32(1), codes[StatusUnexpectedState])
+
+	// the range should be in the table
+	props.Add(PropertyInsertStart, "10")
+	props.Add(PropertyInsertCount, "11")
+	workload = NewClosedEconomyWorkload()
+	require.NotNil(t, workload.Init(props))
+}
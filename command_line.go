@@ -9,10 +9,19 @@ import (
 type MakeDBFunc func() DB
 
 var (
+	// The supported commands, and whether or not each of them runs against
+	// a database. The ones without database take the positional arguments
+	// after the command as input files.
 	Commands = map[string]bool{
-		"load":  true,
-		"run":   true,
-		"shell": true,
+		"load":        true,
+		"run":         true,
+		"shell":       true,
+		"search":      true,
+		"plan":        true,
+		"agent":       true,
+		"coordinator": true,
+		"report":      false,
+		"compare":     false,
 	}
 	Databases = map[string]MakeDBFunc{
 		"basic": func() DB {
@@ -21,6 +30,12 @@ var (
 		"simple": func() DB {
 			return NewGoodBadUglyDB()
 		},
+		"memory": func() DB {
+			return NewMemoryDB()
+		},
+		"faulty": func() DB {
+			return NewFaultyDB()
+		},
 	}
 	OptionPrefixes = []string{"--", "-"}
 	OptionList     = []*Option{
@@ -162,22 +177,40 @@ type Option struct {
 type Arguemnts struct {
 	Command  string
 	Database string
-	Options  map[string]string
+	// the input files of the commands without database
+	Inputs  []string
+	Options map[string]string
 	Properties
+	// the properties specified by -p, which take precedence over the ones
+	// of the workload files and the plan
+	CommandLineProperties Properties
 }
 
 func Usage() {
 	usageFormat := `usage: %s command database [options]
+       %s report file... [options]
+       %s compare file... [options]
 
 Commands:
   load               Execute the load phase
   run                Execute the transaction phase
   shell              Interactive mode
+  search             Search for the highest sustainable target throughput
+  plan               Execute the phases in the plan file of the "plan" property
+  agent              Serve the coordinator to run the workload on this machine
+  coordinator        Run the workload on the agents of "coordinator.agents"
+  report             Report on the HdrHistogram interval logs
+  compare            Compare the exported measurements with the first file
 
 Databases:
   simple             A demo database that does nothing
   basic              A demo database that does nothing but echo the operations
   mysql              Mysql server
+  memory             An in-memory database shared by the whole process
+  faulty             A wrapper injecting latencies and errors into the database of "faulty.db"
+  postgres           PostgreSQL server
+  sqlite             Embedded SQLite database file
+  bolt               Embedded bbolt key-value database file
 
 Options:
   -db classname      use a specified DB class(can also set the "db" property)
@@ -192,13 +225,15 @@ Workload Files:
   There are various predefined workloads under workloads/ directory.
 
 positional arguments:
-  {load,run,shell}   Command to run.
+  {load,run,shell,search,plan,agent,coordinator,report,compare}
+                     Command to run.
   {mysql}            Database to test.
+  file               Input file of report or compare.
 
 optional arguments:
   -h, --help         show this help message and exit
   -v, --version      show the version number and exit`
-	Printf(usageFormat, ProgramName, PropertyTableNameDefault)
+	Printf(usageFormat, ProgramName, ProgramName, ProgramName, PropertyTableNameDefault)
 }
 
 func Version() {
@@ -239,7 +274,7 @@ func ParseArgs() *Arguemnts {
 	index++
 
 	command := firstArg
-	_, ok := Commands[command]
+	needDatabase, ok := Commands[command]
 	if !ok {
 		ExitOnError("unsupported command: %s", command)
 	}
@@ -248,16 +283,18 @@ func ParseArgs() *Arguemnts {
 		ExitOnError("no enough argument")
 	}
 
-	database := os.Args[index]
-	_, ok = Databases[database]
-	if !ok {
-		ExitOnError("unsupported database: %s", database)
-	}
-	index++
-
 	// init property to be returned
 	props := NewProperties()
-	props[PropertyDB] = database
+	var database string
+	if needDatabase {
+		database = os.Args[index]
+		_, ok = Databases[database]
+		if !ok {
+			ExitOnError("unsupported database: %s", database)
+		}
+		index++
+		props[PropertyDB] = database
+	}
 
 	// init options to be returned with default values
 	options := make(map[string]string)
@@ -269,14 +306,22 @@ func ParseArgs() *Arguemnts {
 			}
 		}
 	}
+	commandLineProps := NewProperties()
+	inputs := make([]string, 0)
 	for i := index; i < len(os.Args); i++ {
 		a := os.Args[i]
+		hasPrefix := false
 		for _, p := range OptionPrefixes {
 			if strings.HasPrefix(a, p) {
 				a = strings.TrimPrefix(a, p)
+				hasPrefix = true
 				break
 			}
 		}
+		if !hasPrefix && !needDatabase {
+			inputs = append(inputs, a)
+			continue
+		}
 		opt, ok := Options[a]
 		if !ok {
 			ExitOnError("unknown option: %s", os.Args[i])
@@ -290,6 +335,9 @@ func ParseArgs() *Arguemnts {
 			if opt.Operation != nil {
 				// invoke option specified operation
 				opt.Operation(props, arg)
+				if opt.Name == "p" {
+					opt.Operation(commandLineProps, arg)
+				}
 			} else {
 				// default operation is to add it into option list for further process
 				options[opt.Name] = arg
@@ -303,11 +351,16 @@ func ParseArgs() *Arguemnts {
 			}
 		}
 	}
+	// the properties specified by -p override the ones loaded by -P
+	// whichever comes first
+	props.Merge(commandLineProps)
 	return &Arguemnts{
-		Command:    command,
-		Database:   database,
-		Options:    options,
-		Properties: props,
+		Command:               command,
+		Database:              database,
+		Inputs:                inputs,
+		Options:               options,
+		Properties:            props,
+		CommandLineProperties: commandLineProps,
 	}
 }
 
@@ -321,6 +374,18 @@ func Main() {
 		client = NewLoader(args)
 	case "run":
 		client = NewRunner(args)
+	case "search":
+		client = NewSearcher(args)
+	case "plan":
+		client = NewPlanRunner(args)
+	case "agent":
+		client = NewAgent(args)
+	case "coordinator":
+		client = NewCoordinator(args)
+	case "report":
+		client = NewReporter(args)
+	case "compare":
+		client = NewComparer(args)
 	default:
 		ExitOnError("invalid command: %s", args.Command)
 	}
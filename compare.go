@@ -0,0 +1,452 @@
+package yabf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// A client which compares the measurements exported by the runs, e.g.
+// before and after a database upgrade. The first file is the baseline,
+// and the others are compared with it metric by metric. It exits with
+// non-zero code when any of the thresholds is exceeded, or the measurement
+// with a threshold is missing from the baseline or a run, so it could be
+// used as a gate in a pipeline.
+type Comparer struct {
+	args *Arguemnts
+}
+
+func NewComparer(args *Arguemnts) *Comparer {
+	return &Comparer{
+		args: args,
+	}
+}
+
+func (self *Comparer) Main() {
+	if len(self.args.Inputs) < 2 {
+		ExitOnError("need a baseline file and at least one file to compare")
+	}
+	thresholds, err := parseCompareThresholds(self.args.Properties.Get(PropertyCompareThresholds))
+	if err != nil {
+		ExitOnError("%s", err)
+	}
+	results := make([]*measurementResult, 0, len(self.args.Inputs))
+	for _, fileName := range self.args.Inputs {
+		result, err := loadMeasurementResult(fileName)
+		if err != nil {
+			ExitOnError("fail to load %s, error: %s", fileName, err)
+		}
+		results = append(results, result)
+	}
+	comparison := compareResults(results, thresholds)
+	if err = comparison.WriteText(os.Stdout); err != nil {
+		ExitOnError("fail to write comparison, error: %s", err)
+	}
+	if comparison.failures > 0 {
+		ExitOnError("%d threshold check(s) failed", comparison.failures)
+	}
+}
+
+type resultKey struct {
+	Metric      string
+	Measurement string
+}
+
+// The numeric measurements exported by a run.
+type measurementResult struct {
+	fileName string
+	keys     []resultKey
+	values   map[resultKey]float64
+}
+
+func newMeasurementResult(fileName string) *measurementResult {
+	return &measurementResult{
+		fileName: fileName,
+		keys:     make([]resultKey, 0),
+		values:   make(map[resultKey]float64),
+	}
+}
+
+func (self *measurementResult) add(metric, measurement string, v interface{}) {
+	var value float64
+	switch x := v.(type) {
+	case float64:
+		value = x
+	case string:
+		var err error
+		if value, err = strconv.ParseFloat(x, 64); err != nil {
+			return
+		}
+	default:
+		return
+	}
+	key := resultKey{Metric: metric, Measurement: measurement}
+	if _, ok := self.values[key]; !ok {
+		self.keys = append(self.keys, key)
+	}
+	self.values[key] = value
+}
+
+var (
+	regexTextMeasurement  = regexp.MustCompile(`^\[(.+)\], (.+), (.+)$`)
+	lineProtocolUnescaper = strings.NewReplacer(`\,`, ",", `\=`, "=", `\ `, " ")
+)
+
+// Split the line in the InfluxDB line protocol by the separator which is
+// neither escaped nor quoted.
+func splitLineProtocol(s string, sep byte) []string {
+	parts := make([]string, 0)
+	quoted := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case (s[i] == sep) && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Add the measurements in the line of the InfluxDB line protocol, which
+// are the numeric fields of the point tagged with the operation.
+func (self *measurementResult) addLineProtocol(line string) error {
+	sections := splitLineProtocol(line, ' ')
+	if len(sections) != 3 {
+		return g.NewErrorf("invalid line: %s", line)
+	}
+	var metric string
+	for _, tag := range splitLineProtocol(sections[0], ',')[1:] {
+		kv := splitLineProtocol(tag, '=')
+		if (len(kv) == 2) && (kv[0] == "operation") {
+			metric = lineProtocolUnescaper.Replace(kv[1])
+		}
+	}
+	for _, field := range splitLineProtocol(sections[1], ',') {
+		kv := splitLineProtocol(field, '=')
+		if len(kv) != 2 {
+			return g.NewErrorf("invalid line: %s", line)
+		}
+		// the integers are suffixed with "i"
+		self.add(metric, lineProtocolUnescaper.Replace(kv[0]), strings.TrimSuffix(kv[1], "i"))
+	}
+	return nil
+}
+
+// Load the measurements exported in text, JSON, JSON array, CSV or
+// the InfluxDB line protocol. For the CSV or line protocol file of many
+// runs, the measurements of the last run win.
+func loadMeasurementResult(fileName string) (*measurementResult, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	result := newMeasurementResult(fileName)
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte(strings.Join(CSVMeasurementHeader, ",")+"\n")) {
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, record := range records[1:] {
+			n := len(record)
+			result.add(record[n-3], record[n-2], record[n-1])
+		}
+		return result, nil
+	}
+	if bytes.HasPrefix(data, []byte("yabf,")) {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if len(line) == 0 {
+				continue
+			}
+			if err = result.addLineProtocol(line); err != nil {
+				return nil, err
+			}
+		}
+		return result, scanner.Err()
+	}
+	isJSON := bytes.HasPrefix(data, []byte("{"))
+	if bytes.HasPrefix(data, []byte("[")) {
+		rest := bytes.TrimSpace(data[1:])
+		isJSON = bytes.HasPrefix(rest, []byte("{")) || bytes.HasPrefix(rest, []byte("]"))
+	}
+	if isJSON {
+		var measurements []innerJSONMeasurement
+		if data[0] == '[' {
+			if err = json.Unmarshal(data, &measurements); err != nil {
+				return nil, err
+			}
+		} else {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			for {
+				var m innerJSONMeasurement
+				if err = decoder.Decode(&m); err == io.EOF {
+					break
+				} else if err != nil {
+					return nil, err
+				}
+				measurements = append(measurements, m)
+			}
+		}
+		for _, m := range measurements {
+			result.add(m.Metric, m.Measurement, m.Value)
+		}
+		return result, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		matches := regexTextMeasurement.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, g.NewErrorf("invalid line: %s", line)
+		}
+		result.add(matches[1], matches[2], matches[3])
+	}
+	return result, scanner.Err()
+}
+
+// The max relative delta(in percent) allowed for a measurement.
+type compareThreshold struct {
+	// the empty metric matches all the metrics
+	metric      string
+	measurement string
+	percent     float64
+}
+
+func (self *compareThreshold) match(key resultKey) bool {
+	return ((len(self.metric) == 0) || (self.metric == key.Metric)) &&
+		(self.measurement == key.Measurement)
+}
+
+func (self *compareThreshold) exceeded(percent float64) bool {
+	if self.percent >= 0 {
+		return percent > self.percent
+	}
+	return percent < self.percent
+}
+
+func (self *compareThreshold) String() string {
+	return fmt.Sprintf("%+.2f%%", self.percent)
+}
+
+var (
+	regexPercentileAbbr = regexp.MustCompile(`^p(\d+)$`)
+)
+
+func expandMeasurementAbbr(abbr string) string {
+	switch abbr {
+	case "throughput":
+		return "Throughput(ops/sec)"
+	case "avg":
+		return "AverageLatency(us)"
+	case "min":
+		return "MinLatency(us)"
+	case "max":
+		return "MaxLatency(us)"
+	}
+	if matches := regexPercentileAbbr.FindStringSubmatch(abbr); matches != nil {
+		p, _ := strconv.ParseInt(matches[1], 10, 64)
+		return ordinal(p) + "PercentileLatency(us)"
+	}
+	return abbr
+}
+
+func parseCompareThresholds(propStr string) ([]*compareThreshold, error) {
+	thresholds := make([]*compareThreshold, 0)
+	if len(strings.TrimSpace(propStr)) == 0 {
+		return thresholds, nil
+	}
+	for _, part := range strings.Split(propStr, ",") {
+		part = strings.TrimSpace(part)
+		index := strings.LastIndex(part, ":")
+		if index <= 0 {
+			return nil, g.NewErrorf("invalid threshold: %s", part)
+		}
+		percent, err := strconv.ParseFloat(part[index+1:], 64)
+		if err != nil {
+			return nil, g.NewErrorf("invalid threshold: %s", part)
+		}
+		threshold := &compareThreshold{
+			percent: percent,
+		}
+		name := part[:index]
+		if strings.HasPrefix(name, "[") {
+			end := strings.Index(name, "]")
+			if end < 0 {
+				return nil, g.NewErrorf("invalid threshold: %s", part)
+			}
+			threshold.metric = name[1:end]
+			name = name[end+1:]
+		}
+		if len(name) == 0 {
+			return nil, g.NewErrorf("invalid threshold: %s", part)
+		}
+		threshold.measurement = expandMeasurementAbbr(name)
+		thresholds = append(thresholds, threshold)
+	}
+	return thresholds, nil
+}
+
+// The deltas of a measurement of a run from the baseline.
+type compareDelta struct {
+	ok       bool
+	value    float64
+	delta    float64
+	percent  float64
+	exceeded bool
+	// whether the measurement has a threshold but it's missing from
+	// the run or the baseline
+	missing bool
+}
+
+type compareRow struct {
+	key       resultKey
+	baseline  float64
+	hasBase   bool
+	deltas    []compareDelta
+	threshold *compareThreshold
+}
+
+type comparison struct {
+	fileNames []string
+	rows      []*compareRow
+	// the number of the deltas exceeding the thresholds or missing
+	failures int
+}
+
+// Compare the results with the first one, aligning the measurements by
+// metric and measurement. The first matching threshold applies. The change
+// from a zero baseline is an infinite percent unless the value is zero too.
+func compareResults(results []*measurementResult, thresholds []*compareThreshold) *comparison {
+	c := &comparison{
+		fileNames: make([]string, 0, len(results)),
+		rows:      make([]*compareRow, 0),
+	}
+	keys := make([]resultKey, 0)
+	seen := make(map[resultKey]bool)
+	for _, result := range results {
+		c.fileNames = append(c.fileNames, result.fileName)
+		for _, key := range result.keys {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	base := results[0]
+	for _, key := range keys {
+		row := &compareRow{
+			key:    key,
+			deltas: make([]compareDelta, 0, len(results)-1),
+		}
+		for _, t := range thresholds {
+			if t.match(key) {
+				row.threshold = t
+				break
+			}
+		}
+		row.baseline, row.hasBase = base.values[key]
+		for _, result := range results[1:] {
+			var d compareDelta
+			d.value, d.ok = result.values[key]
+			if d.ok && row.hasBase {
+				d.delta = d.value - row.baseline
+				switch {
+				case row.baseline != 0:
+					d.percent = d.delta * 100.0 / row.baseline
+				case d.delta > 0:
+					d.percent = math.Inf(1)
+				case d.delta < 0:
+					d.percent = math.Inf(-1)
+				}
+				if row.threshold != nil && row.threshold.exceeded(d.percent) {
+					d.exceeded = true
+					c.failures++
+				}
+			} else if row.threshold != nil {
+				d.missing = true
+				c.failures++
+			}
+			row.deltas = append(row.deltas, d)
+		}
+		c.rows = append(c.rows, row)
+	}
+	return c
+}
+
+func formatCompareValue(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+func (self *comparison) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Baseline: %s\n", self.fileNames[0])
+	for i, fileName := range self.fileNames[1:] {
+		fmt.Fprintf(w, "Run %d: %s\n", i+1, fileName)
+	}
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"Metric", "Measurement", "Baseline"}
+	for i := range self.fileNames[1:] {
+		header = append(header, fmt.Sprintf("Run %d", i+1), "Delta", "Delta(%)")
+	}
+	header = append(header, "Threshold", "Result")
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range self.rows {
+		fields := []string{row.key.Metric, row.key.Measurement, "-"}
+		if row.hasBase {
+			fields[2] = formatCompareValue(row.baseline)
+		}
+		result := ""
+		if row.threshold != nil {
+			result = "PASS"
+		}
+		for _, d := range row.deltas {
+			switch {
+			case !d.ok:
+				fields = append(fields, "-", "-", "-")
+			case !row.hasBase:
+				fields = append(fields, formatCompareValue(d.value), "-", "-")
+			default:
+				percent := fmt.Sprintf("%+.2f", d.percent)
+				delta := formatCompareValue(d.delta)
+				if d.delta > 0 {
+					delta = "+" + delta
+				}
+				fields = append(fields, formatCompareValue(d.value), delta, percent)
+			}
+			if d.exceeded {
+				result = "FAIL"
+			} else if d.missing && (result != "FAIL") {
+				result = "MISSING"
+			}
+		}
+		threshold := ""
+		if row.threshold != nil {
+			threshold = row.threshold.String()
+		}
+		fields = append(fields, threshold, result)
+		fmt.Fprintln(tw, strings.Join(fields, "\t"))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,109 @@
+package yabf
+
+import (
+	"bytes"
+	"github.com/hhkbp2/testify/require"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Export the measurements with the exporter into a file, and return the file name.
+func writeTestMeasurements(t *testing.T, dir, className string, throughput float64, p99 int64) string {
+	fileName := filepath.Join(dir, className)
+	f, err := os.Create(fileName)
+	require.Nil(t, err)
+	exporter, err := NewMeasurementExporter(className, f, NewProperties(), "")
+	require.Nil(t, err)
+	require.Nil(t, exporter.Write("OVERALL", "Throughput(ops/sec)", throughput))
+	require.Nil(t, exporter.Write("READ", "99thPercentileLatency(us)", p99))
+	require.Nil(t, exporter.Write("READ", "Return=OK", 1000))
+	require.Nil(t, exporter.Close())
+	return fileName
+}
+
+func TestLoadMeasurementResult(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compare")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for className, _ := range MeasurementExporters {
+		result, err := loadMeasurementResult(writeTestMeasurements(t, dir, className, 1000.5, 200))
+		require.Nil(t, err, className)
+		require.Equal(t, []resultKey{
+			{"OVERALL", "Throughput(ops/sec)"},
+			{"READ", "99thPercentileLatency(us)"},
+			{"READ", "Return=OK"},
+		}, result.keys, className)
+		require.Equal(t, 1000.5, result.values[resultKey{"OVERALL", "Throughput(ops/sec)"}])
+		require.Equal(t, float64(200), result.values[resultKey{"READ", "99thPercentileLatency(us)"}])
+	}
+}
+
+func TestCompareResults(t *testing.T) {
+	thresholds, err := parseCompareThresholds("p99:10, [OVERALL]throughput:-5")
+	require.Nil(t, err)
+	require.Equal(t, 2, len(thresholds))
+	require.Equal(t, "", thresholds[0].metric)
+	require.Equal(t, "99thPercentileLatency(us)", thresholds[0].measurement)
+	require.Equal(t, float64(10), thresholds[0].percent)
+	require.Equal(t, "OVERALL", thresholds[1].metric)
+	require.Equal(t, "Throughput(ops/sec)", thresholds[1].measurement)
+	require.Equal(t, float64(-5), thresholds[1].percent)
+	for _, v := range []string{"p99", "p99:x", ":10", "[READ:10", "[READ]:10"} {
+		_, err = parseCompareThresholds(v)
+		require.NotNil(t, err, v)
+	}
+
+	newResult := func(fileName string, throughput, p99 float64) *measurementResult {
+		result := newMeasurementResult(fileName)
+		result.add("OVERALL", "Throughput(ops/sec)", throughput)
+		result.add("READ", "99thPercentileLatency(us)", p99)
+		return result
+	}
+	base := newResult("base", 1000, 200)
+	// p99 +5% and throughput -10%
+	c := compareResults([]*measurementResult{base, newResult("run1", 900, 210)}, thresholds)
+	require.Equal(t, 1, c.failures)
+	// p99 +20% and throughput +10%
+	c = compareResults([]*measurementResult{base, newResult("run1", 900, 210), newResult("run2", 1100, 240)}, thresholds)
+	require.Equal(t, 2, c.failures)
+	require.Equal(t, float64(-100), c.rows[0].deltas[0].delta)
+	require.Equal(t, float64(20), c.rows[1].deltas[1].percent)
+
+	var buf bytes.Buffer
+	require.Nil(t, c.WriteText(&buf))
+	lines := strings.Split(buf.String(), "\n")
+	require.Equal(t, "Baseline: base", lines[0])
+	require.Equal(t, []string{"OVERALL", "Throughput(ops/sec)", "1000", "900", "-100", "-10.00", "1100", "+100", "+10.00", "-5.00%", "FAIL"},
+		strings.Fields(lines[5]))
+	require.Equal(t, []string{"READ", "99thPercentileLatency(us)", "200", "210", "+10", "+5.00", "240", "+40", "+20.00", "+10.00%", "FAIL"},
+		strings.Fields(lines[6]))
+
+	c = compareResults([]*measurementResult{base, newResult("run1", 1000, 200)}, thresholds)
+	require.Equal(t, 0, c.failures)
+
+	// the increase from a zero baseline exceeds any threshold
+	c = compareResults([]*measurementResult{newResult("base", 1000, 0), newResult("run1", 1000, 10)}, thresholds)
+	require.Equal(t, 1, c.failures)
+	require.True(t, math.IsInf(c.rows[1].deltas[0].percent, 1))
+	c = compareResults([]*measurementResult{newResult("base", 1000, 0), newResult("run1", 1000, 0)}, thresholds)
+	require.Equal(t, 0, c.failures)
+
+	// the measurements with thresholds missing from the baseline or a run
+	// fail the comparison
+	partial := newMeasurementResult("partial")
+	partial.add("OVERALL", "Throughput(ops/sec)", float64(1000))
+	c = compareResults([]*measurementResult{partial, newResult("run1", 1000, 200)}, thresholds)
+	require.Equal(t, 1, c.failures)
+	require.True(t, c.rows[1].deltas[0].missing)
+	c = compareResults([]*measurementResult{base, partial}, thresholds)
+	require.Equal(t, 1, c.failures)
+	buf.Reset()
+	require.Nil(t, c.WriteText(&buf))
+	lines = strings.Split(buf.String(), "\n")
+	require.Equal(t, []string{"READ", "99thPercentileLatency(us)", "200", "-", "-", "-", "+10.00%", "MISSING"},
+		strings.Fields(lines[5]))
+}
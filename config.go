@@ -5,6 +5,11 @@ const (
 	PropertyReportLatencyForEachError        = "reportlatencyforeacherror"
 	PropertyReportLatencyForEachErrorDefault = "false"
 	PropertyLatencyTrackedErrors             = "latencytrackederrors"
+	// The maximum amount of time (in milliseconds) for a single operation.
+	// Operations exceed it are abandoned and reported with status TIMEOUT.
+	// 0 means no limit.
+	PropertyOperationTimeout        = "operation.timeout"
+	PropertyOperationTimeoutDefault = "0"
 
 	// GoodBadUglyDB
 	SimulateDelay        = "gbudb.delays"
@@ -16,6 +21,35 @@ const (
 	ConfigRandomizeDelay        = "basicdb.randomizedelay"
 	ConfigRandomizeDelayDefault = "true"
 
+	// FaultyDB
+	// The name of the binding which the operations are delegated to.
+	PropertyFaultyDB        = "faulty.db"
+	PropertyFaultyDBDefault = "basic"
+	// The distribution of the latency(in microseconds) added to every
+	// operation, which is one of:
+	//   constant:LATENCY
+	//   uniform:MIN:MAX
+	//   exponential:MEAN
+	// It could be overridden for one operation by the property suffixed
+	// with the lowercase operation name, e.g. "faulty.latency.read".
+	PropertyFaultyLatency        = "faulty.latency"
+	PropertyFaultyLatencyDefault = "constant:0"
+	// The comma separated list of "OPERATION:STATUS:PROBABILITY", e.g.
+	// "READ:NOT_FOUND:0.01,*:SERVICE_UNAVAILABLE:0.001", which fails
+	// the operations with the status at the probability. "*" matches
+	// all the operations.
+	PropertyFaultyErrors = "faulty.errors"
+	// The interval(in milliseconds) between the global stalls, in which all
+	// the operations are blocked. 0 means no stall.
+	PropertyFaultyStallInterval        = "faulty.stall.interval"
+	PropertyFaultyStallIntervalDefault = "0"
+	// The duration(in milliseconds) of every global stall.
+	PropertyFaultyStallDuration        = "faulty.stall.duration"
+	PropertyFaultyStallDurationDefault = "0"
+	// The probability that a scan returns only a part of the records.
+	PropertyFaultyPartialScan        = "faulty.scan.partial"
+	PropertyFaultyPartialScanDefault = "0"
+
 	// Client
 	// The number of records to load into the database initially.
 	PropertyRecordCount = "recordcount"
@@ -34,6 +68,14 @@ const (
 	PropertyExporterDefault = "TextMeasurementExporter"
 	// If set to the path of a file, this file will be written instead of stdout.
 	PropertyExportFile = "exportfile"
+	// Whether to append to the export file instead of overwriting it, e.g. to
+	// collect the results of many runs in one file.
+	PropertyExportFileAppend        = "exportfile.append"
+	PropertyExportFileAppendDefault = "false"
+	// If set to the path of a file, the result document in JSON is written
+	// into it, which has the properties, the environment, the timings and
+	// the measurements of every phase of the command.
+	PropertyResultFile = "result.file"
 	// The number of client goroutines to run.
 	PropertyThreadCount        = "threadcount"
 	PropertyThreadCountDefault = "1"
@@ -45,15 +87,140 @@ const (
 	// Target number of operations per second
 	PropertyTarget        = "target"
 	PropertyTargetDefault = "0"
+	// The schedule of the target number of operations per second which
+	// varies over time, instead of the constant "target". See NewTargetSchedule.
+	PropertyTargetSchedule = "target.schedule"
+	// How the operations are issued: "closed" for every client goroutine to
+	// issue the next operation after the former one completes, or "open" for
+	// a dispatcher to issue the operations at the target rate regardless
+	// of their completion. The "threadcount" is ignored in open loop mode,
+	// the concurrency of which is bounded by "openloop.maxinflight".
+	PropertyLoadMode        = "loadmode"
+	PropertyLoadModeDefault = "closed"
+	// The distribution of the inter-arrival times of the operations
+	// in open loop mode: "constant" or "poisson".
+	PropertyArrivalDistribution        = "arrivaldistribution"
+	PropertyArrivalDistributionDefault = "constant"
+	// The maximum number of operations in flight in open loop mode.
+	// The operations which arrive when it's reached are dropped.
+	PropertyOpenLoopMaxInFlight        = "openloop.maxinflight"
+	PropertyOpenLoopMaxInFlightDefault = "1000"
+	// The operations which start later than their arrival times by more than
+	// this amount of time (in milliseconds) are counted as late in open loop mode.
+	PropertyOpenLoopLateThreshold        = "openloop.latethreshold"
+	PropertyOpenLoopLateThresholdDefault = "10"
 	// The maximum amount of time (in seconds) for which the benchmark will be run.
 	PropertyMaxExecutionTime        = "maxexecutiontime"
 	PropertyMaxExecutionTimeDefault = "0"
+	// The warm-up period at the beginning of a run, in seconds and in
+	// operations. The measurements during warm-up are discarded. If both of
+	// them are set, the warm-up lasts until both are reached.
+	PropertyWarmupTime              = "warmup.time"
+	PropertyWarmupTimeDefault       = "0"
+	PropertyWarmupOperations        = "warmup.operations"
+	PropertyWarmupOperationsDefault = "0"
+	// The seed of the random streams, which is an integer. Every client
+	// goroutine draws its keys, values and operations from its own stream
+	// derived from the seed, so that a run could be replayed exactly.
+	// The streams are seeded by the time if it's not set.
+	PropertySeed = "seed"
 	// Whether or not this is the transaction phase (run) or not (load).
 	PropertyTransactions          = "dotransactions"
 	PropertyStatusInterval        = "status.interval"
 	PropertyStatusIntervalDefault = "10"
 
+	// search
+	// The lower and upper bounds of the target throughput(ops/sec) to search.
+	PropertySearchMin        = "search.min"
+	PropertySearchMinDefault = "100"
+	PropertySearchMax        = "search.max"
+	PropertySearchMaxDefault = "100000"
+	// The search stops when the bounds are closer than this(ops/sec).
+	PropertySearchResolution        = "search.resolution"
+	PropertySearchResolutionDefault = "100"
+	// The time(in seconds) to run the workload at each target.
+	PropertySearchStepTime        = "search.steptime"
+	PropertySearchStepTimeDefault = "10"
+	// The percentile of latency the SLO is defined on.
+	PropertySearchPercentile        = "search.percentile"
+	PropertySearchPercentileDefault = "99"
+	// The SLO of latency(in microseconds) at the percentile.
+	PropertySearchLatency        = "search.latency"
+	PropertySearchLatencyDefault = "10000"
+	// The operations the SLO applies to, separated by commas.
+	// All the operations measured are checked if it's empty.
+	PropertySearchOperations        = "search.operations"
+	PropertySearchOperationsDefault = ""
+	// A target is sustainable only if the achieved throughput is not lower
+	// than it by more than this fraction.
+	PropertySearchTolerance        = "search.tolerance"
+	PropertySearchToleranceDefault = "0.05"
+
+	// plan
+	// The plan file listing the phases to run in order. See LoadPlan.
+	PropertyPlan = "plan"
+
+	// distributed
+	// The address for the agent to listen on.
+	PropertyAgentListen        = "agent.listen"
+	PropertyAgentListenDefault = ":6060"
+	// The addresses of the agents for the coordinator, separated by commas.
+	PropertyCoordinatorAgents = "coordinator.agents"
+	// The command for the agents to run, "load" or "run".
+	PropertyCoordinatorCommand        = "coordinator.command"
+	PropertyCoordinatorCommandDefault = "run"
+	// The delay(in milliseconds) from the time the coordinator pushes the
+	// run to the agents, to the instant they all start at.
+	PropertyCoordinatorStartDelay        = "coordinator.startdelay"
+	PropertyCoordinatorStartDelayDefault = "2000"
+
+	// prometheus
+	// The address to serve the metrics of the runs in progress on, in the
+	// Prometheus text format at the path "/metrics", e.g. ":9100". The empty
+	// value disables it.
+	PropertyPrometheusListen = "prometheus.listen"
+	// The quantiles of the latencies to serve, separated by commas.
+	PropertyPrometheusQuantiles        = "prometheus.quantiles"
+	PropertyPrometheusQuantilesDefault = "0.5,0.9,0.95,0.99,0.999"
+
+	// report
+	// The time window to report, in seconds since the start of the earliest
+	// log. The end of 0 means the end of the logs.
+	PropertyReportStart        = "report.start"
+	PropertyReportStartDefault = "0"
+	PropertyReportEnd          = "report.end"
+	PropertyReportEndDefault   = "0"
+	// The length(in seconds) of the intervals in the percentile time series.
+	PropertyReportInterval        = "report.interval"
+	PropertyReportIntervalDefault = "10"
+	// The percentiles to report, separated by commas.
+	PropertyReportPercentiles        = "report.percentiles"
+	PropertyReportPercentilesDefault = "50,90,95,99,99.9,99.99"
+	// The format of report: "text", "csv" or "json".
+	PropertyReportFormat        = "report.format"
+	PropertyReportFormatDefault = "text"
+	// How to merge the logs: "all" to merge all of them into one, or
+	// "operation" to merge the ones of the same operation(e.g. the logs of
+	// READ from all the clients), which is the tag of the log or the file
+	// name without ".hdr".
+	PropertyReportGroupBy        = "report.groupby"
+	PropertyReportGroupByDefault = "all"
+
+	// compare
+	// The thresholds of the relative deltas(in percent) from the baseline,
+	// separated by commas, in the form "[metric]measurement:percent" where
+	// "[metric]" is optional, e.g. "p99:10,[READ]throughput:-5". A positive
+	// threshold is the max increase allowed, and a negative one is the max
+	// decrease allowed. The measurement could be abbreviated as "pN"(e.g.
+	// "p99" for "99thPercentileLatency(us)"), "avg", "min", "max" or
+	// "throughput".
+	PropertyCompareThresholds = "compare.thresholds"
+
 	// workload
+	// The number of records to insert in one operation during the load phase,
+	// and to read in one multi-get operation during the transaction phase.
+	PropertyBatchSize          = "batchsize"
+	PropertyBatchSizeDefault   = "1"
 	PropertyInsertStart        = "insertstart"
 	PropertyInsertStartDefault = "0"
 
@@ -130,6 +297,34 @@ const (
 	PropertyReadModifyWriteProportion = "readmodifywriteproportion"
 	// The default value of `PropertyReadModifyWriteProportion`
 	PropertyReadModifyWriteProportionDefault = "0.0"
+	// The name of the property for proportion of transactions
+	// that are multi-gets of batchsize records.
+	PropertyMultiReadProportion = "multireadproportion"
+	// The default value of `PropertyMultiReadProportion`
+	PropertyMultiReadProportionDefault = "0.0"
+	// The name of the property for whether or not every transaction should
+	// bundle a number of reads and writes in one database transaction.
+	PropertyTransactional = "transactional"
+	// The default value of `PropertyTransactional`
+	PropertyTransactionalDefault = "false"
+	// The name of the property for the number of reads in one transaction.
+	PropertyTransactionReads = "transactionreads"
+	// The default value of `PropertyTransactionReads`
+	PropertyTransactionReadsDefault = "1"
+	// The name of the property for the number of writes in one transaction.
+	PropertyTransactionWrites = "transactionwrites"
+	// The default value of `PropertyTransactionWrites`
+	PropertyTransactionWritesDefault = "1"
+	// The name of the property for proportion of transactions
+	// that are transfers between two records, for ClosedEconomyWorkload.
+	PropertyTransferProportion = "transferproportion"
+	// The default value of `PropertyTransferProportion`
+	PropertyTransferProportionDefault = "0.05"
+	// The name of the property for the total amount of money in all
+	// the records, for ClosedEconomyWorkload.
+	PropertyTotalCash = "totalcash"
+	// The default value of `PropertyTotalCash`
+	PropertyTotalCashDefault = "1000000"
 	// The name of the property for the distribution of requests
 	// across the keyspace. Options are "uniform", "zipfian" and "latest"
 	PropertyRequestDistribution = "requestdistribution"
@@ -174,8 +369,13 @@ const (
 	PropertyOccupancyDefault  = "0.9"
 
 	// measurement
-	PropertyMeasurementType            = "measurementtype"
-	PropertyMeasurementTypeDefault     = "hdrhistogram"
+	PropertyMeasurementType        = "measurementtype"
+	PropertyMeasurementTypeDefault = "hdrhistogram"
+	// Which latencies of the DB operations to record: "op" for the ones from
+	// the actual start time of the operations, "intended" for the ones from
+	// the intended start time in the schedule of the target throughput, or
+	// "both". The latencies of the workload, e.g. transactions, are always
+	// recorded.
 	PropertyMeasurementInterval        = "measurement.interval"
 	PropertyMeasurementIntervalDefault = "op"
 
@@ -183,6 +383,10 @@ const (
 	// this granularity. Units are milliseconds.
 	PropertyGranularity        = "timeseries.granularity"
 	PropertyGranularityDefault = "1000"
+	// The file to stream the time series of "hdrtimeseries" measurement type
+	// to, one row per operation every `timeseries.granularity`.
+	PropertyTimeSeriesFile        = "timeseries.file"
+	PropertyTimeSeriesFileDefault = "timeseries.csv"
 
 	// Optionally, user can configure an output file to save the raw
 	// data points. Default is none, raw results will be written to stdout.
@@ -205,13 +409,22 @@ const (
 	PropertyPercentiles = "hdrhistogram.percentiles"
 	// The default value of `PropertyPercentiles`
 	PropertyPercentilesDefault = "95,99"
-	// The name of the property that specifies the output filename of hdrhistogram
+	// The name of the property for whether or not to log the interval
+	// histograms of every operation, in the standard HdrHistogram log format.
 	PropertyHdrHistogramOutput = "hdrhistogram.fileoutput"
 	// The default value of `PropertyHdrHistogramOutput`
 	PropertyHdrHistogramOutputDefault = "false"
-	PropertyHdrHistogramOutputPath    = "hdrhistogram.output.path"
+	// The prefix of the log files, which are named after the operations with
+	// the suffix ".hdr", e.g. "READ.hdr".
+	PropertyHdrHistogramOutputPath = "hdrhistogram.output.path"
 	// The default value of `PropertyHdrHistogramOutputPath`
 	PropertyHdrHistogramOutputPathDefault = ""
+	// The log file shared by all the operations, in which the interval
+	// histograms are tagged with the operations. If it's set, it's used
+	// instead of the separate files under `PropertyHdrHistogramOutputPath`.
+	PropertyHdrHistogramOutputFile = "hdrhistogram.output.file"
+	// The default value of `PropertyHdrHistogramOutputFile`
+	PropertyHdrHistogramOutputFileDefault = ""
 	// The max value of hdrhistogram
 	PropertyHdrHistogramMax = "hdrhistogram.max"
 	// The default value of `PropertyHdrHistogramMax`, which is 2 seconds in unit ms.
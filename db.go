@@ -1,6 +1,7 @@
 package yabf
 
 import (
+	"context"
 	"database/sql/driver"
 	"errors"
 	g "github.com/hhkbp2/yabf/generator"
@@ -19,6 +20,8 @@ var (
 	BadRequest         = errors.New("The request was not valid.")
 	Forbidden          = errors.New("The request was not valid.")
 	ServiceUnavailable = errors.New("Dependant service for the current binding is not available.")
+	Timeout            = errors.New("The operation did not complete before its deadline.")
+	Canceled           = errors.New("The operation was canceled.")
 )
 
 // Binary represents arbitrary binary value(byte array).
@@ -86,12 +89,294 @@ type DB interface {
 	Delete(table string, key string) StatusType
 }
 
+// ContextDB is the context-carrying variant of DB.
+// Every operation takes a context.Context which carries the deadline and
+// the cancellation of that operation, so a binding could abort a hung request
+// instead of blocking its client routine forever.
+// Bindings which are able to honor the context natively should implement
+// this interface. Any other binding is adapted by ContextDBAdapter.
+type ContextDB interface {
+	DB
+
+	// Read a record from the database, honoring the deadline and
+	// cancellation of ctx.
+	ReadContext(ctx context.Context, table string, key string, fields []string) (KVMap, StatusType)
+
+	// Perform a range scan for a set of records in the database, honoring
+	// the deadline and cancellation of ctx.
+	ScanContext(ctx context.Context, table string, startKey string, recordCount int64, fields []string) ([]KVMap, StatusType)
+
+	// Update a record in the database, honoring the deadline and
+	// cancellation of ctx.
+	UpdateContext(ctx context.Context, table string, key string, values KVMap) StatusType
+
+	// Insert a record in the database, honoring the deadline and
+	// cancellation of ctx.
+	InsertContext(ctx context.Context, table string, key string, values KVMap) StatusType
+
+	// Delete a record from the database, honoring the deadline and
+	// cancellation of ctx.
+	DeleteContext(ctx context.Context, table string, key string) StatusType
+}
+
+// Return the status for an operation whose context is done.
+func StatusFromContext(ctx context.Context) StatusType {
+	if ctx.Err() == context.DeadlineExceeded {
+		return StatusTimeout
+	}
+	return StatusCanceled
+}
+
+// Return db as a ContextDB, adapting it when it doesn't support
+// context natively.
+func AsContextDB(db DB) ContextDB {
+	if c, ok := db.(ContextDB); ok {
+		return c
+	}
+	return NewContextDBAdapter(db)
+}
+
+// ContextDBAdapter adapts a DB which knows nothing about context to ContextDB.
+// When the context of an operation could be done, the operation is run in
+// a separate routine and abandoned as soon as the context is done. The
+// abandoned operation keeps running until the binding returns, so bindings
+// which are not safe for concurrent use should implement ContextDB natively.
+// Note that it costs a routine and a channel per operation when
+// "operation.timeout" is set, which may show up in the latencies of
+// the fast bindings.
+type ContextDBAdapter struct {
+	DB
+}
+
+func NewContextDBAdapter(db DB) *ContextDBAdapter {
+	return &ContextDBAdapter{
+		DB: db,
+	}
+}
+
+// Run the operation and wait for it until ctx is done.
+// Return the status and whether the operation is completed.
+func callWithContext(ctx context.Context, op func() StatusType) (StatusType, bool) {
+	if ctx.Done() == nil {
+		// the context is never done, no need for another routine
+		return op(), true
+	}
+	if ctx.Err() != nil {
+		return StatusFromContext(ctx), false
+	}
+	ch := make(chan StatusType, 1)
+	go func() {
+		ch <- op()
+	}()
+	select {
+	case status := <-ch:
+		return status, true
+	case <-ctx.Done():
+		return StatusFromContext(ctx), false
+	}
+}
+
+func (self *ContextDBAdapter) ReadContext(ctx context.Context, table string, key string, fields []string) (KVMap, StatusType) {
+	var ret KVMap
+	status, ok := callWithContext(ctx, func() (status StatusType) {
+		ret, status = self.DB.Read(table, key, fields)
+		return
+	})
+	if !ok {
+		return nil, status
+	}
+	return ret, status
+}
+
+func (self *ContextDBAdapter) ScanContext(ctx context.Context, table string, startKey string, recordCount int64, fields []string) ([]KVMap, StatusType) {
+	var ret []KVMap
+	status, ok := callWithContext(ctx, func() (status StatusType) {
+		ret, status = self.DB.Scan(table, startKey, recordCount, fields)
+		return
+	})
+	if !ok {
+		return nil, status
+	}
+	return ret, status
+}
+
+func (self *ContextDBAdapter) UpdateContext(ctx context.Context, table string, key string, values KVMap) StatusType {
+	status, _ := callWithContext(ctx, func() StatusType {
+		return self.DB.Update(table, key, values)
+	})
+	return status
+}
+
+func (self *ContextDBAdapter) InsertContext(ctx context.Context, table string, key string, values KVMap) StatusType {
+	status, _ := callWithContext(ctx, func() StatusType {
+		return self.DB.Insert(table, key, values)
+	})
+	return status
+}
+
+func (self *ContextDBAdapter) DeleteContext(ctx context.Context, table string, key string) StatusType {
+	status, _ := callWithContext(ctx, func() StatusType {
+		return self.DB.Delete(table, key)
+	})
+	return status
+}
+
+// BatchDB is an optional extension of DB for the databases which could
+// process a batch of records in one operation.
+// Bindings don't have to implement it, DBWrapper falls back to
+// process the records one by one for them.
+type BatchDB interface {
+	// Insert a batch of records in the database. values[i] is written into
+	// the record with key keys[i].
+	BatchInsert(table string, keys []string, values []KVMap) StatusType
+
+	// Read a batch of records from the database.
+	// The records are returned in the order of keys, with nil for
+	// the keys which are not found.
+	MultiRead(table string, keys []string, fields []string) ([]KVMap, StatusType)
+}
+
+// ContextBatchDB is the context-carrying variant of BatchDB.
+type ContextBatchDB interface {
+	// Insert a batch of records in the database, honoring the deadline and
+	// cancellation of ctx.
+	BatchInsertContext(ctx context.Context, table string, keys []string, values []KVMap) StatusType
+
+	// Read a batch of records from the database, honoring the deadline and
+	// cancellation of ctx.
+	MultiReadContext(ctx context.Context, table string, keys []string, fields []string) ([]KVMap, StatusType)
+}
+
+// delegatingDB is implemented by the databases which delegate
+// the operations to another DB, e.g. FaultyDB. They support the optional
+// extensions of DB only if the DB delegated to does, which is known after
+// they are initialized.
+type delegatingDB interface {
+	// Return the DB delegated to, or nil before it's initialized.
+	delegate() DB
+}
+
+// Return whether db delegates to a DB which fails the check.
+func delegatesToUnsupported(db DB, supported func(DB) bool) bool {
+	if d, ok := db.(delegatingDB); ok && (d.delegate() != nil) {
+		return !supported(d.delegate())
+	}
+	return false
+}
+
+// Return db as a ContextBatchDB, or nil when it doesn't support batches.
+func AsContextBatchDB(db DB) ContextBatchDB {
+	if delegatesToUnsupported(db, func(d DB) bool { return AsContextBatchDB(d) != nil }) {
+		return nil
+	}
+	if c, ok := db.(ContextBatchDB); ok {
+		return c
+	}
+	if b, ok := db.(BatchDB); ok {
+		return NewContextBatchDBAdapter(b)
+	}
+	return nil
+}
+
+// Return db as a BatchDB if it handles a batch in one operation. A DBWrapper
+// around a DB which doesn't support batches is not, although it falls back
+// to handle the records one by one.
+func asNativeBatchDB(db DB) (BatchDB, bool) {
+	if w, ok := db.(*DBWrapper); ok && (w.batchDB == nil) {
+		return nil, false
+	}
+	if delegatesToUnsupported(db, func(d DB) bool {
+		_, ok := asNativeBatchDB(d)
+		return ok
+	}) {
+		return nil, false
+	}
+	b, ok := db.(BatchDB)
+	return b, ok
+}
+
+// ContextBatchDBAdapter adapts a BatchDB to ContextBatchDB, the same way
+// ContextDBAdapter does.
+type ContextBatchDBAdapter struct {
+	BatchDB
+}
+
+func NewContextBatchDBAdapter(db BatchDB) *ContextBatchDBAdapter {
+	return &ContextBatchDBAdapter{
+		BatchDB: db,
+	}
+}
+
+func (self *ContextBatchDBAdapter) BatchInsertContext(ctx context.Context, table string, keys []string, values []KVMap) StatusType {
+	status, _ := callWithContext(ctx, func() StatusType {
+		return self.BatchDB.BatchInsert(table, keys, values)
+	})
+	return status
+}
+
+func (self *ContextBatchDBAdapter) MultiReadContext(ctx context.Context, table string, keys []string, fields []string) ([]KVMap, StatusType) {
+	var ret []KVMap
+	status, ok := callWithContext(ctx, func() (status StatusType) {
+		ret, status = self.BatchDB.MultiRead(table, keys, fields)
+		return
+	})
+	if !ok {
+		return nil, status
+	}
+	return ret, status
+}
+
+// TransactionalDB is an optional extension of DB for the databases which
+// support transactions. Every client routine has its own DB instance, so
+// the transaction is kept in the instance: all the operations issued
+// between Begin() and Commit() or Abort() are done in the transaction.
+type TransactionalDB interface {
+	// Start a transaction.
+	Begin() StatusType
+
+	// Commit the current transaction.
+	Commit() StatusType
+
+	// Abort(roll back) the current transaction.
+	Abort() StatusType
+}
+
+// ContextTransactionalDB is the context-carrying variant of TransactionalDB.
+// The transaction is bound to the context passed to BeginContext(), and is
+// rolled back if the context is done before it's committed.
+type ContextTransactionalDB interface {
+	TransactionalDB
+
+	// Start a transaction bound to ctx.
+	BeginContext(ctx context.Context) StatusType
+}
+
+// RandomDB is an optional extension of DB for the databases which draw
+// random numbers, e.g. to simulate delays. It's implemented by DBBase.
+type RandomDB interface {
+	// Set the random source of this DB, which is owned by its client routine.
+	SetRandom(r *rand.Rand)
+}
+
 type DBBase struct {
-	p Properties
+	p      Properties
+	random *rand.Rand
 }
 
 func NewDBBase() *DBBase {
-	return &DBBase{}
+	return &DBBase{
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (self *DBBase) SetRandom(r *rand.Rand) {
+	self.random = r
+}
+
+// Get the random source of this DB, which is seeded by the time unless
+// it's set by the client routine.
+func (self *DBBase) GetRandom() *rand.Rand {
+	return self.random
 }
 
 func (self *DBBase) SetProperties(p Properties) {
@@ -103,39 +388,77 @@ func (self *DBBase) GetProperties() Properties {
 }
 
 func NewDB(database string, props Properties) (DB, error) {
+	db, err := NewDBWithContext(context.Background(), database, props)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Create the specified DB, all the operations of which are bound to ctx.
+func NewDBWithContext(ctx context.Context, database string, props Properties) (*DBWrapper, error) {
 	f, ok := Databases[database]
 	if !ok {
 		return nil, g.NewErrorf("unsupported database: %s", database)
 	}
 	db := f()
 	db.SetProperties(props)
-	return NewDBWrapper(db), nil
+	return NewContextDBWrapper(ctx, db), nil
 }
 
 // Wrapper around a "real" DB that measures latencies and counts return codes.
 // Also reports latency separately between OK and false operations.
+// Operations which time out are always reported separately.
 type DBWrapper struct {
 	DB
+	db           ContextDB
+	batchDB      ContextBatchDB
+	txDB         TransactionalDB
+	ctx          context.Context
 	measurements Measurements
+	timeout      time.Duration
+	// the start time of the current operation in the schedule of client,
+	// in nanoseconds, or 0 when there is no schedule.
+	intendedStartTime int64
+	// which latencies to record, by "measurement.interval"
+	measurementInterval int
 
 	reportLatencyForEachError bool
 	latencyTrackedErrors      map[string]bool
 }
 
 func NewDBWrapper(db DB) *DBWrapper {
+	return NewContextDBWrapper(context.Background(), db)
+}
+
+func NewContextDBWrapper(ctx context.Context, db DB) *DBWrapper {
 	return &DBWrapper{
 		DB:           db,
+		db:           AsContextDB(db),
+		batchDB:      AsContextBatchDB(db),
+		txDB:         asTransactionalDB(db),
+		ctx:          ctx,
 		measurements: GetMeasurements(),
+
+		measurementInterval: measureOpInterval,
 	}
 }
 
 func (self *DBWrapper) Init() (err error) {
 	defer catch(&err)
 	try(self.DB.Init())
+	// the extensions supported by a delegating DB are known by now
+	self.batchDB = AsContextBatchDB(self.DB)
+	self.txDB = asTransactionalDB(self.DB)
 	p := self.GetProperties()
 	propStr := p.GetDefault(PropertyReportLatencyForEachError, PropertyReportLatencyForEachErrorDefault)
 	reportLatencyForEachError, err := strconv.ParseBool(propStr)
 	try(err)
+	propStr = p.GetDefault(PropertyOperationTimeout, PropertyOperationTimeoutDefault)
+	timeout, err := strconv.ParseInt(propStr, 0, 64)
+	try(err)
+	measurementInterval, err := parseMeasurementInterval(p)
+	try(err)
 	latencyTrackedErrors := make(map[string]bool)
 	var ok bool
 	if !self.reportLatencyForEachError {
@@ -149,12 +472,21 @@ func (self *DBWrapper) Init() (err error) {
 	}
 	self.reportLatencyForEachError = reportLatencyForEachError
 	self.latencyTrackedErrors = latencyTrackedErrors
+	self.timeout = time.Duration(MillisecondToNanosecond(timeout))
+	self.measurementInterval = measurementInterval
 
 	Debugf("DBWrapper: report latency for each error is %t and specific error codes to track for latency are: %s",
 		reportLatencyForEachError, propStr)
 	return
 }
 
+// Set the random source of the wrapped DB, if it draws random numbers.
+func (self *DBWrapper) SetRandom(r *rand.Rand) {
+	if db, ok := self.DB.(RandomDB); ok {
+		db.SetRandom(r)
+	}
+}
+
 // Cleanup any state for this DB.
 func (self *DBWrapper) Cleanup() error {
 	startTime := NowNS()
@@ -167,10 +499,26 @@ func (self *DBWrapper) Cleanup() error {
 	return err
 }
 
+// Derive the context for one operation, which is limited by
+// the per-operation timeout if it's configured.
+func (self *DBWrapper) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if self.timeout > 0 {
+		return context.WithTimeout(ctx, self.timeout)
+	}
+	return ctx, func() {}
+}
+
 // Read a record from the database.
 func (self *DBWrapper) Read(table string, key string, fields []string) (KVMap, StatusType) {
+	return self.ReadContext(self.ctx, table, key, fields)
+}
+
+// Read a record from the database, honoring the deadline and cancellation of ctx.
+func (self *DBWrapper) ReadContext(ctx context.Context, table string, key string, fields []string) (KVMap, StatusType) {
+	ctx, cancel := self.withTimeout(ctx)
+	defer cancel()
 	startTime := NowNS()
-	ret, status := self.DB.Read(table, key, fields)
+	ret, status := self.db.ReadContext(ctx, table, key, fields)
 	endTime := NowNS()
 	self.measure("READ", status, startTime, endTime)
 	self.measurements.ReportStatus("READ", status)
@@ -179,8 +527,16 @@ func (self *DBWrapper) Read(table string, key string, fields []string) (KVMap, S
 
 // Perform a range scan for a set of records in the databases.
 func (self *DBWrapper) Scan(table string, startKey string, recordCount int64, fields []string) ([]KVMap, StatusType) {
+	return self.ScanContext(self.ctx, table, startKey, recordCount, fields)
+}
+
+// Perform a range scan for a set of records in the databases,
+// honoring the deadline and cancellation of ctx.
+func (self *DBWrapper) ScanContext(ctx context.Context, table string, startKey string, recordCount int64, fields []string) ([]KVMap, StatusType) {
+	ctx, cancel := self.withTimeout(ctx)
+	defer cancel()
 	startTime := NowNS()
-	ret, status := self.DB.Scan(table, startKey, recordCount, fields)
+	ret, status := self.db.ScanContext(ctx, table, startKey, recordCount, fields)
 	endTime := NowNS()
 	self.measure("SCAN", status, startTime, endTime)
 	self.measurements.ReportStatus("SCAN", status)
@@ -189,8 +545,15 @@ func (self *DBWrapper) Scan(table string, startKey string, recordCount int64, fi
 
 // Update a recerd in the database.
 func (self *DBWrapper) Update(table string, key string, values KVMap) StatusType {
+	return self.UpdateContext(self.ctx, table, key, values)
+}
+
+// Update a recerd in the database, honoring the deadline and cancellation of ctx.
+func (self *DBWrapper) UpdateContext(ctx context.Context, table string, key string, values KVMap) StatusType {
+	ctx, cancel := self.withTimeout(ctx)
+	defer cancel()
 	startTime := NowNS()
-	status := self.DB.Update(table, key, values)
+	status := self.db.UpdateContext(ctx, table, key, values)
 	endTime := NowNS()
 	self.measure("UPDATE", status, startTime, endTime)
 	self.measurements.ReportStatus("UPDATE", status)
@@ -199,8 +562,15 @@ func (self *DBWrapper) Update(table string, key string, values KVMap) StatusType
 
 // Insert a record in the database.
 func (self *DBWrapper) Insert(table string, key string, values KVMap) StatusType {
+	return self.InsertContext(self.ctx, table, key, values)
+}
+
+// Insert a record in the database, honoring the deadline and cancellation of ctx.
+func (self *DBWrapper) InsertContext(ctx context.Context, table string, key string, values KVMap) StatusType {
+	ctx, cancel := self.withTimeout(ctx)
+	defer cancel()
 	startTime := NowNS()
-	status := self.DB.Insert(table, key, values)
+	status := self.db.InsertContext(ctx, table, key, values)
 	endTime := NowNS()
 	self.measure("INSERT", status, startTime, endTime)
 	self.measurements.ReportStatus("INSERT", status)
@@ -209,30 +579,177 @@ func (self *DBWrapper) Insert(table string, key string, values KVMap) StatusType
 
 // Delete a record from the database.
 func (self *DBWrapper) Delete(table string, key string) StatusType {
+	return self.DeleteContext(self.ctx, table, key)
+}
+
+// Delete a record from the database, honoring the deadline and cancellation of ctx.
+func (self *DBWrapper) DeleteContext(ctx context.Context, table string, key string) StatusType {
+	ctx, cancel := self.withTimeout(ctx)
+	defer cancel()
 	startTime := NowNS()
-	status := self.DB.Delete(table, key)
+	status := self.db.DeleteContext(ctx, table, key)
 	endTime := NowNS()
 	self.measure("DELETE", status, startTime, endTime)
 	self.measurements.ReportStatus("DELETE", status)
 	return status
 }
 
+// Insert a batch of records in the database.
+func (self *DBWrapper) BatchInsert(table string, keys []string, values []KVMap) StatusType {
+	return self.BatchInsertContext(self.ctx, table, keys, values)
+}
+
+// Insert a batch of records in the database, honoring the deadline and
+// cancellation of ctx. The latency is measured per batch, and the number of
+// records is counted for the per-record throughput.
+func (self *DBWrapper) BatchInsertContext(ctx context.Context, table string, keys []string, values []KVMap) StatusType {
+	if self.batchDB == nil {
+		// fall back to insert the records one by one
+		for i, key := range keys {
+			status := self.InsertContext(ctx, table, key, values[i])
+			if status != StatusOK {
+				return status
+			}
+		}
+		return StatusOK
+	}
+	ctx, cancel := self.withTimeout(ctx)
+	defer cancel()
+	startTime := NowNS()
+	status := self.batchDB.BatchInsertContext(ctx, table, keys, values)
+	endTime := NowNS()
+	self.measure("BATCH-INSERT", status, startTime, endTime)
+	self.measurements.ReportStatus("BATCH-INSERT", status)
+	if status == StatusOK {
+		self.measurements.Count("BATCH-INSERT", "Records", int64(len(keys)))
+	}
+	return status
+}
+
+// Read a batch of records from the database.
+func (self *DBWrapper) MultiRead(table string, keys []string, fields []string) ([]KVMap, StatusType) {
+	return self.MultiReadContext(self.ctx, table, keys, fields)
+}
+
+// Read a batch of records from the database, honoring the deadline and
+// cancellation of ctx. The latency is measured per batch, and the number of
+// records is counted for the per-record throughput.
+func (self *DBWrapper) MultiReadContext(ctx context.Context, table string, keys []string, fields []string) ([]KVMap, StatusType) {
+	if self.batchDB == nil {
+		// fall back to read the records one by one
+		ret := make([]KVMap, 0, len(keys))
+		for _, key := range keys {
+			values, status := self.ReadContext(ctx, table, key, fields)
+			if (status != StatusOK) && (status != StatusNotFound) {
+				return nil, status
+			}
+			ret = append(ret, values)
+		}
+		return ret, StatusOK
+	}
+	ctx, cancel := self.withTimeout(ctx)
+	defer cancel()
+	startTime := NowNS()
+	ret, status := self.batchDB.MultiReadContext(ctx, table, keys, fields)
+	endTime := NowNS()
+	self.measure("MULTI-READ", status, startTime, endTime)
+	self.measurements.ReportStatus("MULTI-READ", status)
+	if status == StatusOK {
+		self.measurements.Count("MULTI-READ", "Records", int64(len(keys)))
+	}
+	return ret, status
+}
+
+// Return db as a TransactionalDB, or nil when it doesn't support transactions.
+func asTransactionalDB(db DB) TransactionalDB {
+	if delegatesToUnsupported(db, func(d DB) bool { return asTransactionalDB(d) != nil }) {
+		return nil
+	}
+	if t, ok := db.(TransactionalDB); ok {
+		return t
+	}
+	return nil
+}
+
+// Start a transaction.
+func (self *DBWrapper) Begin() StatusType {
+	return self.doTransactionOp("BEGIN", func(db TransactionalDB) StatusType {
+		if c, ok := db.(ContextTransactionalDB); ok {
+			// the transaction spans several operations, so it's bound to
+			// the context of the client routine rather than the timeout
+			// of one operation
+			return c.BeginContext(self.ctx)
+		}
+		return db.Begin()
+	})
+}
+
+// Commit the current transaction.
+func (self *DBWrapper) Commit() StatusType {
+	return self.doTransactionOp("COMMIT", func(db TransactionalDB) StatusType {
+		return db.Commit()
+	})
+}
+
+// Abort(roll back) the current transaction.
+func (self *DBWrapper) Abort() StatusType {
+	return self.doTransactionOp("ABORT", func(db TransactionalDB) StatusType {
+		return db.Abort()
+	})
+}
+
+func (self *DBWrapper) doTransactionOp(op string, f func(TransactionalDB) StatusType) StatusType {
+	if self.txDB == nil {
+		return StatusNotImplemented
+	}
+	startTime := NowNS()
+	status := f(self.txDB)
+	endTime := NowNS()
+	self.measure(op, status, startTime, endTime)
+	self.measurements.ReportStatus(op, status)
+	return status
+}
+
+// Set the intended start time in nanoseconds of the next operation,
+// which is the time it's scheduled at by the target throughput.
+// Its latency is also measured from it to correct the coordinated omission,
+// if it's enabled by the "measurement.interval" property. The time is taken
+// by the next operation only: the following operations of the same
+// transaction, e.g. the update of a read-modify-write, are intended to start
+// right after the former ones, so they are measured from their actual start
+// times.
+func (self *DBWrapper) SetIntendedStartTime(t int64) {
+	self.intendedStartTime = t
+}
+
 func (self *DBWrapper) measure(op string, status StatusType, startTime, endTime int64) {
 	measurementName := op
 	if status != StatusOK {
 		statusStr := status.String()
 		_, ok := self.latencyTrackedErrors[statusStr]
-		if self.reportLatencyForEachError || ok {
+		if self.reportLatencyForEachError || ok || (status == StatusTimeout) {
 			measurementName = op + "-" + statusStr
 		} else {
 			measurementName = op + "-FAILED"
 		}
 	}
-	self.measurements.Measure(measurementName, NanosecondToMicrosecond(endTime-startTime))
+	if self.measurementInterval&measureOpInterval != 0 {
+		self.measurements.Measure(measurementName, NanosecondToMicrosecond(endTime-startTime))
+	}
+	intendedStartTime := self.intendedStartTime
+	if intendedStartTime == 0 {
+		intendedStartTime = startTime
+	}
+	self.intendedStartTime = 0
+	if self.measurementInterval&measureIntendedInterval != 0 {
+		self.measurements.MeasureIntended(measurementName, NanosecondToMicrosecond(endTime-intendedStartTime))
+	}
 }
 
-// A simple DB implementation that just prints out the requested operations,
-// instead of doing them against a database.
+// A simple DB implementation that does nothing but delays the operations.
+// Most of the delays are good, some are bad, and a few are ugly ones which
+// pause all the instances. The delays are specified by the property
+// "gbudb.delays" in microseconds.
 type GoodBadUglyDB struct {
 	*DBBase
 	delays []int64
@@ -243,13 +760,16 @@ func NewGoodBadUglyDB() *GoodBadUglyDB {
 	return &GoodBadUglyDB{
 		DBBase: NewDBBase(),
 		delays: []int64{200, 1000, 10000, 50000, 100000},
-		lock:   &sync.RWMutex{},
+		lock:   goodBadUglyLock,
 	}
 }
 
+// The lock shared by all the GoodBadUglyDB instances, which is held
+// exclusively by the ugly delays to pause all of them.
+var goodBadUglyLock = &sync.RWMutex{}
+
 func (self *GoodBadUglyDB) delay() {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	p := r.Float64()
+	p := self.GetRandom().Float64()
 	var mod int64
 	if p < 0.9 {
 		mod = 0
@@ -263,14 +783,28 @@ func (self *GoodBadUglyDB) delay() {
 	// this will make mod 3 pauses global
 	if mod == 3 {
 		EPrintf("OUCH")
+		self.lock.Lock()
+		defer self.lock.Unlock()
+	} else {
+		self.lock.RLock()
+		defer self.lock.RUnlock()
 	}
-	// TODO
+	// sleep for a time between the delays of mod and mod + 1 in microseconds
+	baseDelay := self.delays[mod]
+	delay := baseDelay
+	if delayRange := self.delays[mod+1] - baseDelay; delayRange > 0 {
+		delay += self.GetRandom().Int63n(delayRange)
+	}
+	time.Sleep(time.Duration(MicrosecondToNanosecond(delay)))
 }
 
 // Initialize any state for this DB.
 func (self *GoodBadUglyDB) Init() error {
 	propStr := self.GetProperties().GetDefault(SimulateDelay, SimulateDelayDefault)
 	parts := strings.Split(propStr, ",")
+	if len(parts) != len(self.delays) {
+		return g.NewErrorf("invalid property %s=%s, should be %d delays", SimulateDelay, propStr, len(self.delays))
+	}
 	i := 0
 	for _, p := range parts {
 		d, err := strconv.ParseInt(p, 0, 64)
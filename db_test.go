@@ -0,0 +1,96 @@
+package yabf
+
+import (
+	"context"
+	"github.com/codahale/hdrhistogram"
+	"github.com/hhkbp2/testify/require"
+	"testing"
+	"time"
+)
+
+// A DB which sleeps for a while in every operation.
+type slowDB struct {
+	*BasicDB
+	sleep time.Duration
+}
+
+func (self *slowDB) Read(table string, key string, fields []string) (KVMap, StatusType) {
+	time.Sleep(self.sleep)
+	return KVMap{"field0": Binary("value")}, StatusOK
+}
+
+func TestContextDBAdapter(t *testing.T) {
+	db := AsContextDB(&slowDB{BasicDB: NewBasicDB(), sleep: 50 * time.Millisecond})
+	ret, status := db.ReadContext(context.Background(), "table", "key", nil)
+	require.Equal(t, StatusOK, status)
+	require.Equal(t, Binary("value"), ret["field0"])
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	startTime := time.Now()
+	ret, status = db.ReadContext(ctx, "table", "key", nil)
+	require.Equal(t, StatusTimeout, status)
+	require.Nil(t, ret)
+	require.True(t, time.Since(startTime) < 50*time.Millisecond)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, status = db.ReadContext(ctx, "table", "key", nil)
+	require.Equal(t, StatusCanceled, status)
+}
+
+func TestNewDB(t *testing.T) {
+	db, err := NewDB("no-such-db", NewProperties())
+	require.NotNil(t, err)
+	require.True(t, db == nil)
+	db, err = NewDB("basic", NewProperties())
+	require.Nil(t, err)
+	require.NotNil(t, db)
+}
+
+func TestDBWrapperMeasurementInterval(t *testing.T) {
+	resetMemoryTables()
+	defer func() {
+		SetMeasurementProperties(NewProperties())
+		ResetMeasurements()
+	}()
+	props := NewProperties()
+	props.Add(PropertyMeasurementInterval, "intended")
+	SetMeasurementProperties(props)
+	ResetMeasurements()
+	db := NewDBWrapper(NewMemoryDB())
+	db.SetProperties(props)
+	require.Nil(t, db.Init())
+
+	// only the first operation after the intended start time is measured
+	// from it, and the following ones of the same transaction are not
+	db.SetIntendedStartTime(NowNS() - SecondToNanosecond(1))
+	db.Read("usertable", "key", nil)
+	db.Insert("usertable", "key", KVMap{"field0": Binary("value")})
+	measurements := GetMeasurements().(*DefaultMeasurements)
+	// the latencies of the workload are always measured
+	measurements.Measure("TRANSACTION", 1)
+	histogram := func(m Measurements, op string) *hdrhistogram.Histogram {
+		return m.Lookup(op).(*OneMeasurementHdrHistogram).histogram
+	}
+	require.Equal(t, int64(1), histogram(measurements, "TRANSACTION").TotalCount())
+	// the operations are there only for their return codes
+	require.Equal(t, int64(0), histogram(measurements, "READ").TotalCount())
+	require.Equal(t, int64(0), histogram(measurements, "INSERT").TotalCount())
+	require.True(t, histogram(measurements, "Intended-READ-FAILED").Max() >= 1000000)
+	require.True(t, histogram(measurements, "Intended-INSERT").Max() < 1000000)
+
+	props.Add(PropertyMeasurementInterval, "op")
+	ResetMeasurements()
+	db = NewDBWrapper(NewMemoryDB())
+	db.SetProperties(props)
+	require.Nil(t, db.Init())
+	db.SetIntendedStartTime(NowNS() - SecondToNanosecond(1))
+	db.Read("usertable", "key", nil)
+	require.Equal(t, []string{"READ"}, GetMeasurements().(*DefaultMeasurements).Operations())
+
+	props.Add(PropertyMeasurementInterval, "invalid")
+	db = NewDBWrapper(NewMemoryDB())
+	db.SetProperties(props)
+	require.NotNil(t, db.Init())
+}
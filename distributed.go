@@ -0,0 +1,497 @@
+package yabf
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// The states of an agent.
+const (
+	agentIdle    = "idle"
+	agentWaiting = "waiting"
+	agentRunning = "running"
+	agentDone    = "done"
+	agentFailed  = "failed"
+)
+
+// The request from the coordinator to run the workload on an agent.
+type agentRunRequest struct {
+	// "load" or "run"
+	Command    string
+	Properties Properties
+	// the instant for all the agents to start at, in nanoseconds since epoch
+	StartTime int64
+}
+
+type agentStatus struct {
+	State string
+	// the operations done so far
+	Operations int64
+	Error      string
+}
+
+type agentResult struct {
+	Operations int64
+	// the run time in milliseconds
+	RunTime      int64
+	Measurements *MeasurementsSnapshot
+}
+
+// A process which runs the workload on behalf of the coordinator.
+// It serves a simple HTTP protocol:
+//
+//	POST /run      start a run at the instant specified, with a JSON
+//	               agentRunRequest
+//	GET  /status   return the state and the progress of the run in JSON
+//	GET  /result   return the result and the HdrHistogram snapshots of
+//	               the run in JSON, after it's done
+//
+// The properties from the command line of the agent, e.g. the ones to
+// connect to the database, override the ones pushed by the coordinator,
+// except the share of the agent partitioned by the coordinator. A run which
+// fails is reported by the state "failed" with the error, instead of
+// stopping the agent.
+type Agent struct {
+	args   *Arguemnts
+	lock   sync.Mutex
+	state  string
+	client *ClientBase
+	result *agentResult
+	err    string
+}
+
+func NewAgent(args *Arguemnts) *Agent {
+	return &Agent{
+		args:  args,
+		state: agentIdle,
+	}
+}
+
+func (self *Agent) Main() {
+	addr := self.args.Properties.GetDefault(PropertyAgentListen, PropertyAgentListenDefault)
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		ExitOnError("fail to listen on %s, error: %s", addr, err)
+	}
+	Printf("Agent listening on %s", listener.Addr())
+	err = http.Serve(listener, self.Handler())
+	ExitOnError("agent stops, error: %s", err)
+}
+
+func (self *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/run", self.handleRun)
+	mux.HandleFunc("/status", self.handleStatus)
+	mux.HandleFunc("/result", self.handleResult)
+	return mux
+}
+
+func (self *Agent) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req agentRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, err := self.newClient(&req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if (self.state == agentWaiting) || (self.state == agentRunning) {
+		http.Error(w, "agent is busy", http.StatusConflict)
+		return
+	}
+	self.state = agentWaiting
+	self.client = client
+	self.result = nil
+	self.err = ""
+	go self.run(client, req.StartTime)
+}
+
+func (self *Agent) newClient(req *agentRunRequest) (*ClientBase, error) {
+	if (req.Command != "load") && (req.Command != "run") {
+		return nil, g.NewErrorf("invalid command %s, should be load or run", req.Command)
+	}
+	props := NewProperties().Merge(req.Properties).Merge(self.args.Properties)
+	for _, name := range partitionedProperties {
+		if v, ok := req.Properties[name]; ok {
+			props.Add(name, v)
+		}
+	}
+	// the HdrHistograms are shipped to the coordinator to merge
+	props.Add(PropertyMeasurementType, "hdrhistogram")
+	if !checkRequiredProperties(props) {
+		return nil, g.NewErrorf("missing property: %s", PropertyWorkload)
+	}
+	client := NewClientBase(&Arguemnts{
+		Command:    req.Command,
+		Database:   self.args.Database,
+		Options:    self.args.Options,
+		Properties: props,
+	})
+	client.DoTransactions = (req.Command == "run")
+	return client, nil
+}
+
+func (self *Agent) run(client *ClientBase, startTime int64) {
+	waitUtil(startTime)
+	self.lock.Lock()
+	self.state = agentRunning
+	self.lock.Unlock()
+
+	ResetMeasurements()
+	result, err := client.run(client.Args.Properties)
+	var snapshot *MeasurementsSnapshot
+	if err == nil {
+		snapshot, err = GetMeasurements().Snapshot()
+	}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if err != nil {
+		self.state = agentFailed
+		self.err = err.Error()
+		return
+	}
+	self.state = agentDone
+	self.result = &agentResult{
+		Operations:   result.Operations,
+		RunTime:      result.RunTime,
+		Measurements: snapshot,
+	}
+}
+
+func (self *Agent) handleStatus(w http.ResponseWriter, r *http.Request) {
+	self.lock.Lock()
+	status := &agentStatus{
+		State: self.state,
+		Error: self.err,
+	}
+	client := self.client
+	self.lock.Unlock()
+	if client != nil {
+		status.Operations = client.OpsDone()
+	}
+	writeJSON(w, status)
+}
+
+func (self *Agent) handleResult(w http.ResponseWriter, r *http.Request) {
+	self.lock.Lock()
+	state := self.state
+	result := self.result
+	errStr := self.err
+	self.lock.Unlock()
+	if state == agentFailed {
+		http.Error(w, "run fails, error: "+errStr, http.StatusInternalServerError)
+		return
+	}
+	if result == nil {
+		http.Error(w, "no result", http.StatusConflict)
+		return
+	}
+	writeJSON(w, result)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		EPrintf("fail to write response, error: %s", err)
+	}
+}
+
+// The interval to poll the status of the agents.
+var coordinatorPollInterval = 200 * time.Millisecond
+
+// A client which runs the workload on a number of agents at a synchronized
+// instant, and merges their measurements into one global report.
+// The operations(or the records to insert in the load phase) and the target
+// throughput are partitioned evenly among the agents, while the thread count
+// applies to every agent. The clocks of the agents are assumed synchronized,
+// e.g. by NTP.
+type Coordinator struct {
+	*ClientBase
+	httpClient *http.Client
+}
+
+func NewCoordinator(args *Arguemnts) *Coordinator {
+	object := &Coordinator{
+		ClientBase: NewClientBase(args),
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+	command := args.Properties.GetDefault(PropertyCoordinatorCommand, PropertyCoordinatorCommandDefault)
+	object.DoTransactions = (command == "run")
+	return object
+}
+
+func (self *Coordinator) Main() {
+	self.CheckProperties()
+
+	props := self.Args.Properties
+	document := NewResultDocument(self.Args)
+	result, err := self.Coordinate(props)
+	if err != nil {
+		ExitOnError("%s", err)
+	}
+	err = self.exportMeasurements(props, document, result)
+	if err != nil {
+		ExitOnError("could not export measurements, error: %s", err)
+	}
+}
+
+// Run the workload on all the agents, and return the overall result.
+// The merged measurements of the agents are left in GetMeasurements().
+func (self *Coordinator) Coordinate(props Properties) (*RunResult, error) {
+	command := props.GetDefault(PropertyCoordinatorCommand, PropertyCoordinatorCommandDefault)
+	if (command != "load") && (command != "run") {
+		return nil, g.NewErrorf("invalid property %s=%s, should be load or run", PropertyCoordinatorCommand, command)
+	}
+	agents := make([]string, 0)
+	for _, agent := range strings.Split(props.Get(PropertyCoordinatorAgents), ",") {
+		if agent = strings.TrimSpace(agent); len(agent) > 0 {
+			agents = append(agents, agent)
+		}
+	}
+	if len(agents) == 0 {
+		return nil, g.NewErrorf("Missing property: %s", PropertyCoordinatorAgents)
+	}
+	partitions, err := partitionProperties(props, len(agents), command == "run")
+	if err != nil {
+		return nil, err
+	}
+	propStr := props.GetDefault(PropertyCoordinatorStartDelay, PropertyCoordinatorStartDelayDefault)
+	delay, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return nil, g.NewErrorf("invalid property %s=%s, should be integer", PropertyCoordinatorStartDelay, propStr)
+	}
+
+	startTime := NowNS() + MillisecondToNanosecond(delay)
+	for i, agent := range agents {
+		req := &agentRunRequest{
+			Command:    command,
+			Properties: partitions[i],
+			StartTime:  startTime,
+		}
+		if err = self.call(http.MethodPost, agent, "/run", req, nil); err != nil {
+			return nil, g.NewErrorf("fail to start agent %s, error: %s", agent, err)
+		}
+	}
+	Printf("Starting test on %d agents.", len(agents))
+	if err = self.waitForAgents(agents, startTime); err != nil {
+		return nil, err
+	}
+
+	measurementProps := NewProperties().Merge(props)
+	measurementProps.Add(PropertyMeasurementType, "hdrhistogram")
+	SetMeasurementProperties(measurementProps)
+	ResetMeasurements()
+	measurements := GetMeasurements()
+	result := &RunResult{
+		StartTime: NanosecondToMillisecond(startTime),
+	}
+	for _, agent := range agents {
+		var r agentResult
+		if err = self.call(http.MethodGet, agent, "/result", nil, &r); err != nil {
+			return nil, g.NewErrorf("fail to get result of agent %s, error: %s", agent, err)
+		}
+		if r.Measurements != nil {
+			if err = measurements.Merge(r.Measurements); err != nil {
+				return nil, err
+			}
+		}
+		result.Operations += r.Operations
+		// the agents start at the same instant, the run ends with the last one
+		if r.RunTime > result.RunTime {
+			result.RunTime = r.RunTime
+		}
+	}
+	return result, nil
+}
+
+// Poll the status of the agents until all of them are done, and report the
+// overall progress periodically if the status is shown.
+func (self *Coordinator) waitForAgents(agents []string, startTime int64) error {
+	_, status := self.Args.Options["s"]
+	label := self.Args.Options["l"]
+	propStr := self.Args.Properties.GetDefault(PropertyStatusInterval, PropertyStatusIntervalDefault)
+	intervalSeconds, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return g.NewErrorf("invalid property %s=%s, should be integer", PropertyStatusInterval, propStr)
+	}
+	lastReportTime := startTime
+	lastOps := int64(0)
+	for {
+		time.Sleep(coordinatorPollInterval)
+		doneCount := 0
+		ops := int64(0)
+		for _, agent := range agents {
+			var s agentStatus
+			if err = self.call(http.MethodGet, agent, "/status", nil, &s); err != nil {
+				return g.NewErrorf("fail to get status of agent %s, error: %s", agent, err)
+			}
+			switch s.State {
+			case agentWaiting, agentRunning:
+			case agentDone:
+				doneCount++
+			case agentFailed:
+				return g.NewErrorf("agent %s fails, error: %s", agent, s.Error)
+			default:
+				return g.NewErrorf("agent %s is in unexpected state: %s", agent, s.State)
+			}
+			ops += s.Operations
+		}
+		if doneCount == len(agents) {
+			return nil
+		}
+		now := NowNS()
+		if status && (now-lastReportTime >= SecondToNanosecond(intervalSeconds)) {
+			throughput := float64(ops-lastOps) / (float64(now-lastReportTime) / float64(SecondToNanosecond(1)))
+			Printf("%s %d sec: %d operations; %.2f current ops/sec; %d of %d agents done",
+				label, NanosecondToMillisecond(now-startTime)/1000, ops, throughput, doneCount, len(agents))
+			lastReportTime = now
+			lastOps = ops
+		}
+	}
+}
+
+// Send a request with the JSON body of req to the agent, and decode the JSON
+// response into resp if it's not nil.
+func (self *Coordinator) call(method, agent, path string, req interface{}, resp interface{}) error {
+	var body bytes.Buffer
+	if req != nil {
+		if err := json.NewEncoder(&body).Encode(req); err != nil {
+			return err
+		}
+	}
+	url := agent + path
+	if !strings.Contains(agent, "://") {
+		url = "http://" + url
+	}
+	request, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := self.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		var msg bytes.Buffer
+		msg.ReadFrom(response.Body)
+		return g.NewErrorf("%s %s: %s, %s", method, url, response.Status, strings.TrimSpace(msg.String()))
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(resp)
+}
+
+// The properties of the share of every agent set by partitionProperties,
+// which are not overridden by the properties of the agent.
+var partitionedProperties = []string{
+	PropertyOperationCount,
+	PropertyInsertStart,
+	PropertyInsertCount,
+	PropertyTarget,
+	PropertySeed,
+}
+
+// Return the properties for each of the n agents. The operations and the
+// target throughput are split evenly among them. The range of records is
+// split into consecutive partitions by "insertstart" and "insertcount",
+// which are the records to insert in the load phase, and the ones to work on
+// in the run phase for the workloads keeping to them, e.g.
+// ClosedEconomyWorkload. Every agent gets a seed of its own if "seed" is set.
+func partitionProperties(props Properties, n int, doTransactions bool) ([]Properties, error) {
+	if propStr, ok := props[PropertyTargetSchedule]; ok && (len(propStr) > 0) {
+		return nil, g.NewErrorf("property %s is not supported by coordinator", PropertyTargetSchedule)
+	}
+	parseInt := func(name, defaultValue string) (int64, error) {
+		propStr := props.GetDefault(name, defaultValue)
+		v, err := strconv.ParseInt(propStr, 0, 64)
+		if err != nil {
+			return 0, g.NewErrorf("invalid property %s=%s, should be integer", name, propStr)
+		}
+		return v, nil
+	}
+	target, err := parseInt(PropertyTarget, PropertyTargetDefault)
+	if err != nil {
+		return nil, err
+	}
+	seed, hasSeed, err := parseSeed(props)
+	if err != nil {
+		return nil, err
+	}
+	var opCount int64
+	if doTransactions {
+		opCount, err = parseInt(PropertyOperationCount, PropertyOperationCountDefault)
+		if err != nil {
+			return nil, err
+		}
+	}
+	start, err := parseInt(PropertyInsertStart, PropertyInsertStartDefault)
+	if err != nil {
+		return nil, err
+	}
+	var count int64
+	if _, ok := props[PropertyInsertCount]; ok {
+		count, err = parseInt(PropertyInsertCount, "0")
+	} else {
+		count, err = parseInt(PropertyRecordCount, PropertyRecordCountDefault)
+		count -= start
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]Properties, 0, n)
+	for i := 0; i < n; i++ {
+		// the share of the i-th agent, in which the remainder is spread
+		share := func(total int64) int64 {
+			v := total / int64(n)
+			if int64(i) < total%int64(n) {
+				v++
+			}
+			return v
+		}
+		p := NewProperties().Merge(props)
+		if doTransactions {
+			p.Add(PropertyOperationCount, strconv.FormatInt(share(opCount), 10))
+		}
+		c := share(count)
+		p.Add(PropertyInsertStart, strconv.FormatInt(start, 10))
+		p.Add(PropertyInsertCount, strconv.FormatInt(c, 10))
+		start += c
+		if target > 0 {
+			t := share(target)
+			if t == 0 {
+				t = 1
+			}
+			p.Add(PropertyTarget, strconv.FormatInt(t, 10))
+		}
+		if hasSeed {
+			// the agents derive their streams from seeds of their own,
+			// otherwise they would issue the same operations
+			p.Add(PropertySeed, strconv.FormatInt(deriveSeed(seed, int64(i)), 10))
+		}
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
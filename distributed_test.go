@@ -0,0 +1,213 @@
+package yabf
+
+import (
+	"bufio"
+	"github.com/codahale/hdrhistogram"
+	"github.com/hhkbp2/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Not a real test, but the agent process started by TestCoordinator.
+func TestAgentProcess(t *testing.T) {
+	if os.Getenv("YABF_TEST_AGENT") != "1" {
+		return
+	}
+	props := NewProperties()
+	props.Add(PropertyDB, "basic")
+	props.Add(PropertyAgentListen, "127.0.0.1:0")
+	NewAgent(&Arguemnts{
+		Command:    "agent",
+		Database:   "basic",
+		Options:    make(map[string]string),
+		Properties: props,
+	}).Main()
+}
+
+// Start an agent process on localhost, and return its address.
+func startAgent(t *testing.T) (*exec.Cmd, string) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAgentProcess$")
+	cmd.Env = append(os.Environ(), "YABF_TEST_AGENT=1")
+	stdout, err := cmd.StdoutPipe()
+	require.Nil(t, err)
+	require.Nil(t, cmd.Start())
+	scanner := bufio.NewScanner(stdout)
+	prefix := "Agent listening on "
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, prefix) {
+			// drain the output of the agent
+			go func() {
+				for scanner.Scan() {
+				}
+			}()
+			return cmd, strings.TrimPrefix(line, prefix)
+		}
+	}
+	cmd.Process.Kill()
+	t.Fatalf("agent exits before listening")
+	return nil, ""
+}
+
+func TestCoordinator(t *testing.T) {
+	agents := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		cmd, addr := startAgent(t)
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+		agents = append(agents, addr)
+	}
+
+	newProps := func(command string) Properties {
+		props := NewProperties()
+		props.Add(PropertyDB, "basic")
+		props.Add(PropertyWorkload, "CoreWorkload")
+		props.Add(PropertyRecordCount, "1000")
+		props.Add(PropertyOperationCount, "2000")
+		props.Add(PropertyReadProportion, "0.5")
+		props.Add(PropertyUpdateProportion, "0.5")
+		props.Add(PropertyThreadCount, "2")
+		props.Add(PropertyCoordinatorAgents, strings.Join(agents, ","))
+		props.Add(PropertyCoordinatorCommand, command)
+		props.Add(PropertyCoordinatorStartDelay, "100")
+		return props
+	}
+	newCoordinator := func(props Properties) *Coordinator {
+		return NewCoordinator(&Arguemnts{
+			Command:    "coordinator",
+			Database:   "basic",
+			Options:    make(map[string]string),
+			Properties: props,
+		})
+	}
+
+	props := newProps("load")
+	result, err := newCoordinator(props).Coordinate(props)
+	require.Nil(t, err)
+	require.Equal(t, int64(1000), result.Operations)
+	m, ok := GetMeasurements().Lookup("INSERT").(*OneMeasurementHdrHistogram)
+	require.True(t, ok)
+	snapshot := m.Snapshot()
+	require.Equal(t, int64(1000), hdrhistogram.Import(snapshot.Histogram).TotalCount())
+	require.Equal(t, uint32(1000), snapshot.ReturnCodes[StatusOK])
+
+	props = newProps("run")
+	result, err = newCoordinator(props).Coordinate(props)
+	require.Nil(t, err)
+	require.Equal(t, int64(2000), result.Operations)
+	var total uint32
+	for _, op := range []string{"READ", "UPDATE"} {
+		if m, ok := GetMeasurements().Lookup(op).(*OneMeasurementHdrHistogram); ok {
+			total += m.Snapshot().ReturnCodes[StatusOK]
+		}
+	}
+	require.Equal(t, uint32(2000), total)
+}
+
+func TestPartitionProperties(t *testing.T) {
+	props := NewProperties()
+	props.Add(PropertyRecordCount, "10")
+	props.Add(PropertyTarget, "100")
+	partitions, err := partitionProperties(props, 3, false)
+	require.Nil(t, err)
+	require.Equal(t, 3, len(partitions))
+	expected := [][]string{{"0", "4", "34"}, {"4", "3", "33"}, {"7", "3", "33"}}
+	for i, p := range partitions {
+		require.Equal(t, expected[i][0], p.Get(PropertyInsertStart))
+		require.Equal(t, expected[i][1], p.Get(PropertyInsertCount))
+		require.Equal(t, expected[i][2], p.Get(PropertyTarget))
+		require.Equal(t, "10", p.Get(PropertyRecordCount))
+	}
+
+	props.Add(PropertyOperationCount, "5")
+	partitions, err = partitionProperties(props, 2, true)
+	require.Nil(t, err)
+	require.Equal(t, "3", partitions[0].Get(PropertyOperationCount))
+	require.Equal(t, "2", partitions[1].Get(PropertyOperationCount))
+	// the records are partitioned in the run phase as well
+	require.Equal(t, "5", partitions[1].Get(PropertyInsertStart))
+	require.Equal(t, "5", partitions[1].Get(PropertyInsertCount))
+	require.Equal(t, "", partitions[0].Get(PropertySeed))
+
+	props.Add(PropertySeed, "42")
+	partitions, err = partitionProperties(props, 2, true)
+	require.Nil(t, err)
+	require.NotEqual(t, partitions[0].Get(PropertySeed), partitions[1].Get(PropertySeed))
+	again, err := partitionProperties(props, 2, true)
+	require.Nil(t, err)
+	require.Equal(t, partitions[1].Get(PropertySeed), again[1].Get(PropertySeed))
+	props.Add(PropertySeed, "abc")
+	_, err = partitionProperties(props, 2, true)
+	require.NotNil(t, err)
+	props.Add(PropertySeed, "42")
+
+	props.Add(PropertyTargetSchedule, "ramp:0:100:10")
+	_, err = partitionProperties(props, 2, true)
+	require.NotNil(t, err)
+}
+
+// Run the request on the agent, and return its final status.
+func runAgent(t *testing.T, coordinator *Coordinator, addr string, req *agentRunRequest) *agentStatus {
+	require.Nil(t, coordinator.call(http.MethodPost, addr, "/run", req, nil))
+	for {
+		var s agentStatus
+		require.Nil(t, coordinator.call(http.MethodGet, addr, "/status", nil, &s))
+		if (s.State == agentDone) || (s.State == agentFailed) {
+			return &s
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgent(t *testing.T) {
+	defer ResetMeasurements()
+	props := NewProperties()
+	props.Add(PropertyDB, "basic")
+	props.Add(PropertyOperationCount, "1000")
+	props.Add(PropertyThreadCount, "2")
+	agent := NewAgent(&Arguemnts{
+		Command:    "agent",
+		Database:   "basic",
+		Options:    make(map[string]string),
+		Properties: props,
+	})
+	server := httptest.NewServer(agent.Handler())
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "http://")
+	coordinator := NewCoordinator(&Arguemnts{Options: make(map[string]string), Properties: NewProperties()})
+
+	// the share of the agent overrides the properties of the agent
+	req := &agentRunRequest{
+		Command: "run",
+		Properties: Properties{
+			PropertyWorkload:       "CoreWorkload",
+			PropertyDB:             "memory",
+			PropertyOperationCount: "10",
+			PropertyThreadCount:    "1",
+		},
+		StartTime: NowNS(),
+	}
+	s := runAgent(t, coordinator, addr, req)
+	require.Equal(t, agentDone, s.State)
+	var r agentResult
+	require.Nil(t, coordinator.call(http.MethodGet, addr, "/result", nil, &r))
+	require.Equal(t, int64(10), r.Operations)
+	require.Equal(t, "basic", agent.client.Args.Properties.Get(PropertyDB))
+	require.Equal(t, "2", agent.client.Args.Properties.Get(PropertyThreadCount))
+
+	// a run which fails is reported instead of stopping the agent
+	req.Properties[PropertyWarmupTime] = "abc"
+	s = runAgent(t, coordinator, addr, req)
+	require.Equal(t, agentFailed, s.State)
+	require.True(t, strings.Contains(s.Error, PropertyWarmupTime), s.Error)
+	err := coordinator.call(http.MethodGet, addr, "/result", nil, &r)
+	require.NotNil(t, err)
+	require.True(t, strings.Contains(err.Error(), PropertyWarmupTime), err)
+}
@@ -0,0 +1,359 @@
+package yabf
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+var (
+	faultyOperations = []string{"READ", "SCAN", "UPDATE", "INSERT", "DELETE"}
+	// the time the global stalls are counted from, which is shared by all
+	// the FaultyDB instances so that they stall at the same time
+	faultyEpoch = time.Now()
+)
+
+// An error to inject into an operation.
+type faultyError struct {
+	status      StatusType
+	probability float64
+}
+
+// A DB implementation which delegates the operations to another binding,
+// and injects faults into them to test the harness, e.g. the measurements
+// of the errors and the dashboards. The faults are drawn from the random
+// source of the client routine, so they are reproducible with the "seed"
+// property. The operations failed by the injected errors are not delegated.
+// The batches, transactions and the deadlines of the operations are
+// delegated as well, and the batches and transactions are not implemented
+// if the binding delegated to doesn't support them.
+// Properties to control the faults:
+//
+//	faulty.db: the binding to delegate to (default: basic)
+//	faulty.latency: the distribution of the latency added to every
+//	                operation (default: constant:0)
+//	faulty.errors: the errors to inject per operation (default: none)
+//	faulty.stall.interval: the interval between the global stalls
+//	                       (default: 0, no stall)
+//	faulty.stall.duration: the duration of every global stall (default: 0)
+//	faulty.scan.partial: the probability that a scan returns only a part
+//	                     of the records (default: 0)
+type FaultyDB struct {
+	*DBBase
+	db            DB
+	contextDB     ContextDB
+	batchDB       ContextBatchDB
+	txDB          TransactionalDB
+	latencies     map[string]g.IntegerGenerator
+	errors        map[string][]faultyError
+	stallInterval time.Duration
+	stallDuration time.Duration
+	partialScan   float64
+}
+
+func NewFaultyDB() *FaultyDB {
+	return &FaultyDB{
+		DBBase: NewDBBase(),
+	}
+}
+
+// Create the latency generator of the distribution in the form of
+// "constant:LATENCY", "uniform:MIN:MAX" or "exponential:MEAN".
+func newFaultyLatencyGenerator(name, propStr string) (g.IntegerGenerator, error) {
+	parts := strings.Split(propStr, ":")
+	args := make([]int64, 0, len(parts)-1)
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseInt(p, 0, 64)
+		if (err != nil) || (v < 0) {
+			return nil, g.NewErrorf("invalid property %s=%s", name, propStr)
+		}
+		args = append(args, v)
+	}
+	switch {
+	case (parts[0] == "constant") && (len(args) == 1):
+		return g.NewConstantIntegerGenerator(args[0]), nil
+	case (parts[0] == "uniform") && (len(args) == 2) && (args[0] < args[1]):
+		return g.NewUniformIntegerGenerator(args[0], args[1]), nil
+	case (parts[0] == "exponential") && (len(args) == 1) && (args[0] > 0):
+		return g.NewExponentialGeneratorByMean(float64(args[0])), nil
+	}
+	return nil, g.NewErrorf("invalid property %s=%s", name, propStr)
+}
+
+// Parse the errors to inject in the form of "OPERATION:STATUS:PROBABILITY,..."
+func parseFaultyErrors(propStr string) (map[string][]faultyError, error) {
+	ret := make(map[string][]faultyError)
+	if len(propStr) == 0 {
+		return ret, nil
+	}
+	for _, item := range strings.Split(propStr, ",") {
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 {
+			return nil, g.NewErrorf("invalid error %s in property %s", item, PropertyFaultyErrors)
+		}
+		status, ok := ParseStatus(parts[1])
+		if !ok || (status == StatusOK) {
+			return nil, g.NewErrorf("invalid status %s in property %s", parts[1], PropertyFaultyErrors)
+		}
+		probability, err := strconv.ParseFloat(parts[2], 64)
+		if (err != nil) || (probability < 0) || (probability > 1) {
+			return nil, g.NewErrorf("invalid probability %s in property %s", parts[2], PropertyFaultyErrors)
+		}
+		operations := []string{parts[0]}
+		if parts[0] == "*" {
+			operations = faultyOperations
+		} else if _, ok := indexOfString(faultyOperations, parts[0]); !ok {
+			return nil, g.NewErrorf("invalid operation %s in property %s", parts[0], PropertyFaultyErrors)
+		}
+		for _, op := range operations {
+			ret[op] = append(ret[op], faultyError{status: status, probability: probability})
+		}
+	}
+	return ret, nil
+}
+
+func indexOfString(list []string, s string) (int, bool) {
+	for i, v := range list {
+		if v == s {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (self *FaultyDB) Init() (err error) {
+	defer catch(&err)
+	p := self.GetProperties()
+	dbName := p.GetDefault(PropertyFaultyDB, PropertyFaultyDBDefault)
+	f, ok := Databases[dbName]
+	if !ok || (dbName == "faulty") {
+		try(g.NewErrorf("unsupported database to delegate to: %s", dbName))
+	}
+	defaultLatency := p.GetDefault(PropertyFaultyLatency, PropertyFaultyLatencyDefault)
+	latencies := make(map[string]g.IntegerGenerator)
+	for _, op := range faultyOperations {
+		name := PropertyFaultyLatency + "." + strings.ToLower(op)
+		latency, err := newFaultyLatencyGenerator(name, p.GetDefault(name, defaultLatency))
+		try(err)
+		latencies[op] = latency
+	}
+	errors, err := parseFaultyErrors(p.Get(PropertyFaultyErrors))
+	try(err)
+	propStr := p.GetDefault(PropertyFaultyStallInterval, PropertyFaultyStallIntervalDefault)
+	stallInterval, err := strconv.ParseInt(propStr, 0, 64)
+	try(err)
+	propStr = p.GetDefault(PropertyFaultyStallDuration, PropertyFaultyStallDurationDefault)
+	stallDuration, err := strconv.ParseInt(propStr, 0, 64)
+	try(err)
+	if stallInterval < 0 {
+		try(g.NewErrorf("invalid %s=%d, should not be negative", PropertyFaultyStallInterval, stallInterval))
+	}
+	if (stallInterval > 0) && ((stallDuration < 0) || (stallDuration >= stallInterval)) {
+		try(g.NewErrorf("invalid %s=%d, should be less than %s=%d",
+			PropertyFaultyStallDuration, stallDuration, PropertyFaultyStallInterval, stallInterval))
+	}
+	propStr = p.GetDefault(PropertyFaultyPartialScan, PropertyFaultyPartialScanDefault)
+	partialScan, err := strconv.ParseFloat(propStr, 64)
+	try(err)
+
+	db := f()
+	db.SetProperties(p)
+	if r, ok := db.(RandomDB); ok {
+		r.SetRandom(newChildRandom(self.GetRandom()))
+	}
+	try(db.Init())
+	self.db = db
+	self.contextDB = AsContextDB(db)
+	self.batchDB = AsContextBatchDB(db)
+	self.txDB = asTransactionalDB(db)
+	self.latencies = latencies
+	self.errors = errors
+	self.stallInterval = time.Duration(MillisecondToNanosecond(stallInterval))
+	self.stallDuration = time.Duration(MillisecondToNanosecond(stallDuration))
+	self.partialScan = partialScan
+	return
+}
+
+func (self *FaultyDB) Cleanup() error {
+	return self.db.Cleanup()
+}
+
+// Wait for the end of the current stall if it's in one, and then the latency
+// to add to the operation. Return the status to fail the operation with,
+// or StatusOK to delegate it.
+func (self *FaultyDB) inject(ctx context.Context, op string) StatusType {
+	var delay time.Duration
+	if self.stallInterval > 0 {
+		elapsed := time.Since(faultyEpoch) % self.stallInterval
+		if elapsed < self.stallDuration {
+			delay = self.stallDuration - elapsed
+		}
+	}
+	random := self.GetRandom()
+	delay += time.Duration(MicrosecondToNanosecond(self.latencies[op].NextIntFrom(random)))
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return StatusFromContext(ctx)
+		}
+	}
+	for _, e := range self.errors[op] {
+		if random.Float64() < e.probability {
+			return e.status
+		}
+	}
+	return StatusOK
+}
+
+// Return the DB the operations are delegated to.
+func (self *FaultyDB) delegate() DB {
+	return self.db
+}
+
+// Read a record from the database.
+func (self *FaultyDB) Read(table string, key string, fields []string) (KVMap, StatusType) {
+	return self.ReadContext(context.Background(), table, key, fields)
+}
+
+// Read a record from the database, honoring the deadline and cancellation
+// of ctx.
+func (self *FaultyDB) ReadContext(ctx context.Context, table string, key string, fields []string) (KVMap, StatusType) {
+	if status := self.inject(ctx, "READ"); status != StatusOK {
+		return nil, status
+	}
+	return self.contextDB.ReadContext(ctx, table, key, fields)
+}
+
+// Perform a range scan for a set of records in the database.
+func (self *FaultyDB) Scan(table string, startKey string, recordCount int64, fields []string) ([]KVMap, StatusType) {
+	return self.ScanContext(context.Background(), table, startKey, recordCount, fields)
+}
+
+// Perform a range scan for a set of records in the database, honoring
+// the deadline and cancellation of ctx.
+func (self *FaultyDB) ScanContext(ctx context.Context, table string, startKey string, recordCount int64, fields []string) ([]KVMap, StatusType) {
+	if status := self.inject(ctx, "SCAN"); status != StatusOK {
+		return nil, status
+	}
+	ret, status := self.contextDB.ScanContext(ctx, table, startKey, recordCount, fields)
+	if (status == StatusOK) && (len(ret) > 0) && (self.GetRandom().Float64() < self.partialScan) {
+		ret = ret[:self.GetRandom().Intn(len(ret))]
+	}
+	return ret, status
+}
+
+// Update a record in the database.
+func (self *FaultyDB) Update(table string, key string, values KVMap) StatusType {
+	return self.UpdateContext(context.Background(), table, key, values)
+}
+
+// Update a record in the database, honoring the deadline and cancellation
+// of ctx.
+func (self *FaultyDB) UpdateContext(ctx context.Context, table string, key string, values KVMap) StatusType {
+	if status := self.inject(ctx, "UPDATE"); status != StatusOK {
+		return status
+	}
+	return self.contextDB.UpdateContext(ctx, table, key, values)
+}
+
+// Insert a record in the database.
+func (self *FaultyDB) Insert(table string, key string, values KVMap) StatusType {
+	return self.InsertContext(context.Background(), table, key, values)
+}
+
+// Insert a record in the database, honoring the deadline and cancellation
+// of ctx.
+func (self *FaultyDB) InsertContext(ctx context.Context, table string, key string, values KVMap) StatusType {
+	if status := self.inject(ctx, "INSERT"); status != StatusOK {
+		return status
+	}
+	return self.contextDB.InsertContext(ctx, table, key, values)
+}
+
+// Delete a record from the database.
+func (self *FaultyDB) Delete(table string, key string) StatusType {
+	return self.DeleteContext(context.Background(), table, key)
+}
+
+// Delete a record from the database, honoring the deadline and cancellation
+// of ctx.
+func (self *FaultyDB) DeleteContext(ctx context.Context, table string, key string) StatusType {
+	if status := self.inject(ctx, "DELETE"); status != StatusOK {
+		return status
+	}
+	return self.contextDB.DeleteContext(ctx, table, key)
+}
+
+// Insert a batch of records in the database. The faults of INSERT are
+// injected into the batch as a whole.
+func (self *FaultyDB) BatchInsert(table string, keys []string, values []KVMap) StatusType {
+	return self.BatchInsertContext(context.Background(), table, keys, values)
+}
+
+// Insert a batch of records in the database, honoring the deadline and
+// cancellation of ctx.
+func (self *FaultyDB) BatchInsertContext(ctx context.Context, table string, keys []string, values []KVMap) StatusType {
+	if self.batchDB == nil {
+		return StatusNotImplemented
+	}
+	if status := self.inject(ctx, "INSERT"); status != StatusOK {
+		return status
+	}
+	return self.batchDB.BatchInsertContext(ctx, table, keys, values)
+}
+
+// Read a batch of records from the database. The faults of READ are
+// injected into the batch as a whole.
+func (self *FaultyDB) MultiRead(table string, keys []string, fields []string) ([]KVMap, StatusType) {
+	return self.MultiReadContext(context.Background(), table, keys, fields)
+}
+
+// Read a batch of records from the database, honoring the deadline and
+// cancellation of ctx.
+func (self *FaultyDB) MultiReadContext(ctx context.Context, table string, keys []string, fields []string) ([]KVMap, StatusType) {
+	if self.batchDB == nil {
+		return nil, StatusNotImplemented
+	}
+	if status := self.inject(ctx, "READ"); status != StatusOK {
+		return nil, status
+	}
+	return self.batchDB.MultiReadContext(ctx, table, keys, fields)
+}
+
+// Start a transaction.
+func (self *FaultyDB) Begin() StatusType {
+	return self.BeginContext(context.Background())
+}
+
+// Start a transaction bound to ctx.
+func (self *FaultyDB) BeginContext(ctx context.Context) StatusType {
+	if self.txDB == nil {
+		return StatusNotImplemented
+	}
+	if c, ok := self.txDB.(ContextTransactionalDB); ok {
+		return c.BeginContext(ctx)
+	}
+	return self.txDB.Begin()
+}
+
+// Commit the current transaction.
+func (self *FaultyDB) Commit() StatusType {
+	if self.txDB == nil {
+		return StatusNotImplemented
+	}
+	return self.txDB.Commit()
+}
+
+// Abort(roll back) the current transaction.
+func (self *FaultyDB) Abort() StatusType {
+	if self.txDB == nil {
+		return StatusNotImplemented
+	}
+	return self.txDB.Abort()
+}
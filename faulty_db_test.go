@@ -0,0 +1,183 @@
+package yabf
+
+import (
+	"context"
+	"github.com/hhkbp2/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseFaultyErrors(t *testing.T) {
+	errors, err := parseFaultyErrors("READ:NOT_FOUND:0.5,*:SERVICE_UNAVAILABLE:0.01")
+	require.Nil(t, err)
+	require.Equal(t, 5, len(errors))
+	require.Equal(t, []faultyError{{StatusNotFound, 0.5}, {StatusServiceUnavailable, 0.01}}, errors["READ"])
+	require.Equal(t, []faultyError{{StatusServiceUnavailable, 0.01}}, errors["SCAN"])
+
+	for _, propStr := range []string{"READ:NOT_FOUND", "READ:OK:0.1", "READ:UNKNOWN:0.1", "GET:ERROR:0.1", "READ:ERROR:2"} {
+		_, err = parseFaultyErrors(propStr)
+		require.NotNil(t, err, propStr)
+	}
+}
+
+func newTestFaultyDB(t *testing.T, props Properties) *FaultyDB {
+	props.Add(PropertyFaultyDB, "memory")
+	db := NewFaultyDB()
+	db.SetProperties(props)
+	require.Nil(t, db.Init())
+	return db
+}
+
+func TestFaultyDB(t *testing.T) {
+	resetMemoryTables()
+	props := NewProperties()
+	props.Add(PropertyFaultyErrors, "READ:NOT_FOUND:1,DELETE:SERVICE_UNAVAILABLE:1")
+	props.Add(PropertyFaultyPartialScan, "1")
+	props.Add(PropertyFaultyLatency+".update", "constant:2000")
+	db := newTestFaultyDB(t, props)
+	defer db.Cleanup()
+
+	for _, key := range []string{"k0", "k1", "k2"} {
+		require.Equal(t, StatusOK, db.Insert("t", key, KVMap{"f0": Binary(key)}))
+	}
+	_, status := db.Read("t", "k0", nil)
+	require.Equal(t, StatusNotFound, status)
+	require.Equal(t, StatusServiceUnavailable, db.Delete("t", "k0"))
+	rets, status := db.Scan("t", "k0", 3, nil)
+	require.Equal(t, StatusOK, status)
+	require.True(t, len(rets) < 3)
+	startTime := time.Now()
+	require.Equal(t, StatusOK, db.Update("t", "k0", KVMap{"f0": Binary("v")}))
+	require.True(t, time.Since(startTime) >= 2*time.Millisecond)
+	// the failed operations are not delegated
+	ret, status := NewMemoryDB().Read("t", "k0", nil)
+	require.Equal(t, StatusOK, status)
+	require.Equal(t, Binary("v"), ret["f0"])
+
+	for _, p := range []Properties{
+		{PropertyFaultyDB: "faulty"},
+		{PropertyFaultyDB: "unknown"},
+		{PropertyFaultyLatency: "uniform:10:10"},
+		{PropertyFaultyLatency + ".read": "normal:10"},
+		{PropertyFaultyStallInterval: "100", PropertyFaultyStallDuration: "100"},
+		{PropertyFaultyStallInterval: "-1"},
+	} {
+		db := NewFaultyDB()
+		db.SetProperties(p)
+		require.NotNil(t, db.Init(), "%v", p)
+	}
+}
+
+func TestFaultyDBStall(t *testing.T) {
+	props := NewProperties()
+	props.Add(PropertyFaultyStallInterval, "40")
+	props.Add(PropertyFaultyStallDuration, "20")
+	db := newTestFaultyDB(t, props)
+	defer db.Cleanup()
+	// no operation is done in the first half of every interval
+	for i := 0; i < 20; i++ {
+		db.Read("t", "k0", nil)
+		elapsed := time.Since(faultyEpoch) % (40 * time.Millisecond)
+		require.True(t, elapsed >= 20*time.Millisecond)
+		time.Sleep(7 * time.Millisecond)
+	}
+}
+
+// The injected errors are measured by DBWrapper as configured.
+func TestFaultyDBMeasurements(t *testing.T) {
+	resetMemoryTables()
+	ResetMeasurements()
+	defer ResetMeasurements()
+	props := NewProperties()
+	props.Add(PropertyFaultyDB, "memory")
+	props.Add(PropertyFaultyErrors, "READ:NOT_FOUND:1,UPDATE:ERROR:1")
+	props.Add(PropertyLatencyTrackedErrors, "NOT_FOUND")
+	db, err := NewDB("faulty", props)
+	require.Nil(t, err)
+	require.Nil(t, db.Init())
+	db.Read("t", "k0", nil)
+	db.Update("t", "k0", KVMap{"f0": Binary("v")})
+	measurements := GetMeasurements()
+	require.NotNil(t, measurements.Lookup("READ-NOT_FOUND"))
+	require.NotNil(t, measurements.Lookup("UPDATE-FAILED"))
+	require.Equal(t, uint32(1), measurements.Lookup("UPDATE").GetReturnCodes()[StatusError])
+
+	props.Add(PropertyReportLatencyForEachError, "true")
+	db, err = NewDB("faulty", props)
+	require.Nil(t, err)
+	require.Nil(t, db.Init())
+	db.Update("t", "k0", KVMap{"f0": Binary("v")})
+	require.NotNil(t, measurements.Lookup("UPDATE-ERROR"))
+}
+
+// A transactional MemoryDB without batches, which records whether
+// the reads have a deadline.
+type contextTestDB struct {
+	*ContextDBAdapter
+	deadlines []bool
+}
+
+func (self *contextTestDB) ReadContext(ctx context.Context, table string, key string, fields []string) (KVMap, StatusType) {
+	_, ok := ctx.Deadline()
+	self.deadlines = append(self.deadlines, ok)
+	return self.ContextDBAdapter.ReadContext(ctx, table, key, fields)
+}
+
+func (self *contextTestDB) Begin() StatusType {
+	return StatusOK
+}
+
+func (self *contextTestDB) Commit() StatusType {
+	return StatusOK
+}
+
+func (self *contextTestDB) Abort() StatusType {
+	return StatusOK
+}
+
+func TestFaultyDBDelegation(t *testing.T) {
+	resetMemoryTables()
+	ResetMeasurements()
+	defer ResetMeasurements()
+	Databases["contexttest"] = func() DB {
+		return &contextTestDB{ContextDBAdapter: NewContextDBAdapter(NewMemoryDB())}
+	}
+	defer delete(Databases, "contexttest")
+	props := NewProperties()
+	props.Add(PropertyFaultyDB, "contexttest")
+	props.Add(PropertyOperationTimeout, "1000")
+	db, err := NewDBWithContext(context.Background(), "faulty", props)
+	require.Nil(t, err)
+	require.Nil(t, db.Init())
+	defer db.Cleanup()
+	inner := db.DB.(*FaultyDB).db.(*contextTestDB)
+	// the deadlines of the operations reach the binding
+	db.Read("t", "k0", nil)
+	require.Equal(t, []bool{true}, inner.deadlines)
+	require.Equal(t, StatusOK, db.Begin())
+	require.Equal(t, StatusOK, db.Commit())
+	// the batches are inserted record by record as the binding doesn't
+	// support them
+	_, ok := asNativeBatchDB(db)
+	require.False(t, ok)
+	require.Equal(t, StatusNotImplemented, db.DB.(*FaultyDB).BatchInsert("t", []string{"k0"}, []KVMap{{"f0": Binary("v")}}))
+	require.Equal(t, StatusOK, db.BatchInsert("t", []string{"k0", "k1"}, []KVMap{{"f0": Binary("v")}, {"f0": Binary("v")}}))
+	require.Equal(t, int64(2), getMemoryTable("t").length)
+
+	// the transactions are not implemented as the binding doesn't support
+	// them, unlike the batches
+	props = NewProperties()
+	props.Add(PropertyFaultyLatency, "constant:1000000")
+	faulty := newTestFaultyDB(t, props)
+	defer faulty.Cleanup()
+	_, ok = asNativeBatchDB(faulty)
+	require.True(t, ok)
+	require.Equal(t, StatusNotImplemented, faulty.Begin())
+	// the injected latency is cut by the deadline
+	wrapper := NewDBWrapper(faulty)
+	wrapper.timeout = 20 * time.Millisecond
+	startTime := time.Now()
+	_, status := wrapper.MultiRead("t", []string{"k0", "k1"}, nil)
+	require.Equal(t, StatusTimeout, status)
+	require.True(t, time.Since(startTime) < time.Second)
+}
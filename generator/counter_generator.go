@@ -1,6 +1,7 @@
 package generator
 
 import (
+	"math/rand"
 	"sync"
 	"sync/atomic"
 )
@@ -24,9 +25,22 @@ func NewCounterGenerator(startCount int64) *CounterGenerator {
 // as an int. Default is to return -1, which is appropriate for generators
 // that do not return numeric values.
 func (self *CounterGenerator) NextInt() int64 {
-	ret := atomic.AddInt64(&self.count, 1)
-	self.SetLastInt(ret)
-	return ret
+	return atomic.AddInt64(&self.count, 1)
+}
+
+// The last value is read atomically, since the counter is shared by
+// all the routines.
+func (self *CounterGenerator) LastInt() int64 {
+	return atomic.LoadInt64(&self.count)
+}
+
+func (self *CounterGenerator) LastString() string {
+	return self.lastStringFrom(self)
+}
+
+// The sequence is not random, so it's the same as NextInt().
+func (self *CounterGenerator) NextIntFrom(r *rand.Rand) int64 {
+	return self.NextInt()
 }
 
 func (self *CounterGenerator) NextString() string {
@@ -37,6 +51,11 @@ func (self *CounterGenerator) Mean() float64 {
 	panic("unsupported operation")
 }
 
+// The sequence is shared by all the routines, so it's not cloned.
+func (self *CounterGenerator) Clone() IntegerGenerator {
+	return self
+}
+
 const (
 	// The size of the window of pending id ack.
 	AcknowledgedWindowSize = int64(1 << 20)
@@ -66,19 +85,23 @@ func NewAcknowledgedCounterGenerator(startCount int64) *AcknowledgedCounterGener
 // In this generator, the highest acknowledged counter value
 // (as opposed to the highest generated counter value).
 func (self *AcknowledgedCounterGenerator) LastInt() int64 {
-	return self.limit
+	return atomic.LoadInt64(&self.limit)
 }
 
 func (self *AcknowledgedCounterGenerator) LastString() string {
 	return self.lastStringFrom(self)
 }
 
+func (self *AcknowledgedCounterGenerator) Clone() IntegerGenerator {
+	return self
+}
+
 // Make a generated counter value available via LastInt().
 func (self *AcknowledgedCounterGenerator) Acknowledge(value int64) {
 	currentSlot := value & AcknowledgedWindowMask
-	self.window[currentSlot] = true
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
+	self.window[currentSlot] = true
 	beforeFirstSlot := self.limit & AcknowledgedWindowMask
 	var index int64
 	for index = self.limit + 1; index != beforeFirstSlot; index++ {
@@ -88,5 +111,6 @@ func (self *AcknowledgedCounterGenerator) Acknowledge(value int64) {
 		}
 		self.window[slot] = false
 	}
-	self.limit = index - 1
+	// it's read by LastInt() without the lock
+	atomic.StoreInt64(&self.limit, index-1)
 }
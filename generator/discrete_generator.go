@@ -1,5 +1,9 @@
 package generator
 
+import (
+	"math/rand"
+)
+
 type Pair struct {
 	Weight float64
 	Value  string
@@ -20,13 +24,22 @@ func NewDiscreteGenerator() *DiscreteGenerator {
 
 // Generate the next string in the distribution.
 func (self *DiscreteGenerator) NextString() string {
+	return self.choose(NextFloat64())
+}
+
+// Generate the next string in the distribution, drawing from the random
+// source r.
+func (self *DiscreteGenerator) NextStringFrom(r *rand.Rand) string {
+	return self.choose(r.Float64())
+}
+
+// Return the value which value in [0.0, 1.0) falls into, by weight.
+func (self *DiscreteGenerator) choose(value float64) string {
 	var sum float64
 	for _, p := range self.values {
 		sum += p.Weight
 	}
 
-	value := NextFloat64()
-
 	for _, p := range self.values {
 		v := p.Weight / sum
 		if value < v {
@@ -57,3 +70,13 @@ func (self *DiscreteGenerator) AddValue(weight float64, value string) {
 		Value:  value,
 	})
 }
+
+// Return a generator of the same distribution with a state of its own,
+// which shares the weighted values with this one. No value should be
+// added to either of them after that.
+func (self *DiscreteGenerator) Clone() *DiscreteGenerator {
+	return &DiscreteGenerator{
+		values:    self.values,
+		lastValue: self.lastValue,
+	}
+}
@@ -3,10 +3,16 @@ package generator
 import (
 	"math"
 	"math/rand"
+	"sync"
 )
 
 var (
-	random *rand.Rand
+	// the random source shared by all the callers of this package, which
+	// is locked since *rand.Rand is not routine safe. The callers which
+	// draw a lot concurrently should own their random sources instead,
+	// see IntegerGenerator.NextIntFrom().
+	random     *rand.Rand
+	randomLock sync.Mutex
 )
 
 func init() {
@@ -15,11 +21,15 @@ func init() {
 
 // Return a random int64 value.
 func NextInt64(n int64) int64 {
+	randomLock.Lock()
+	defer randomLock.Unlock()
 	return random.Int63n(n)
 }
 
 // Return a random float64 value.
 func NextFloat64() float64 {
+	randomLock.Lock()
+	defer randomLock.Unlock()
 	return math.Abs(random.Float64() / math.MaxFloat64)
 }
 
@@ -60,6 +70,14 @@ func (self *ExponentialGenerator) NextInt() int64 {
 	return next
 }
 
+// Generate the next item with the random source r, for the callers
+// which own their random sources.
+func (self *ExponentialGenerator) NextIntFrom(r *rand.Rand) int64 {
+	next := int64(-math.Log(1.0-r.Float64()) / self.gamma)
+	self.SetLastInt(next)
+	return next
+}
+
 func (self *ExponentialGenerator) NextString() string {
 	return self.IntegerGeneratorBase.NextString(self)
 }
@@ -67,3 +85,9 @@ func (self *ExponentialGenerator) NextString() string {
 func (self *ExponentialGenerator) Mean() float64 {
 	return 1.0 / self.gamma
 }
+
+func (self *ExponentialGenerator) Clone() IntegerGenerator {
+	object := *self
+	object.IntegerGeneratorBase = NewIntegerGeneratorBase(self.LastInt())
+	return &object
+}
@@ -2,6 +2,8 @@ package generator
 
 import (
 	"github.com/hhkbp2/testify/require"
+	"math"
+	"math/rand"
 	"strconv"
 	"testing"
 )
@@ -25,3 +27,18 @@ func TestExponentGenerator(t *testing.T) {
 		require.Equal(t, g.LastString(), str)
 	}
 }
+
+func TestExponentGeneratorNextIntFrom(t *testing.T) {
+	total := 100000
+	mean := float64(1000)
+	g := NewExponentialGeneratorByMean(mean)
+	r := rand.New(rand.NewSource(1))
+	sum := int64(0)
+	for i := 0; i < total; i++ {
+		v := g.NextIntFrom(r)
+		require.True(t, v >= 0)
+		require.Equal(t, g.LastInt(), v)
+		sum += v
+	}
+	require.True(t, math.Abs(float64(sum)/float64(total)-mean) < mean*0.05)
+}
@@ -5,6 +5,7 @@ import (
 	"container/list"
 	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"strconv"
 	"strings"
@@ -109,7 +110,15 @@ func (self *HistogramGenerator) init() {
 }
 
 func (self *HistogramGenerator) NextInt() int64 {
-	number := NextInt64(self.area)
+	return self.next(NextInt64(self.area))
+}
+
+func (self *HistogramGenerator) NextIntFrom(r *rand.Rand) int64 {
+	return self.next(r.Int63n(self.area))
+}
+
+// Return the size of the bucket which number in [0, area) falls into.
+func (self *HistogramGenerator) next(number int64) int64 {
 	var i int
 	for i = 0; i < len(self.buckets)-1; i++ {
 		number -= self.buckets[i]
@@ -131,3 +140,10 @@ func (self *HistogramGenerator) NextString() string {
 func (self *HistogramGenerator) Mean() float64 {
 	return self.meanSize
 }
+
+// The clone shares the buckets with this one.
+func (self *HistogramGenerator) Clone() IntegerGenerator {
+	object := *self
+	object.IntegerGeneratorBase = NewIntegerGeneratorBase(self.LastInt())
+	return &object
+}
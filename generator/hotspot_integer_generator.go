@@ -1,5 +1,9 @@
 package generator
 
+import (
+	"math/rand"
+)
+
 // Generate integers resembling a hotspot distribution where x% of operations
 // access y% of data items. The parameters specify the bounds for the numbers,
 // the percentage of the interval which comprises the hot set and
@@ -64,6 +68,19 @@ func (self *HotspotIntegerGenerator) NextInt() int64 {
 	return value
 }
 
+func (self *HotspotIntegerGenerator) NextIntFrom(r *rand.Rand) int64 {
+	var value int64
+	if r.Float64() < self.hotOpnFraction {
+		// Choose a value from the hot set.
+		value = self.lowerBound + r.Int63n(self.hotInterval)
+	} else {
+		// Choose a value from the cold set.
+		value = self.lowerBound + self.hotInterval + r.Int63n(self.coldInterval)
+	}
+	self.SetLastInt(value)
+	return value
+}
+
 func (self *HotspotIntegerGenerator) NextString() string {
 	return self.IntegerGeneratorBase.NextString(self)
 }
@@ -73,6 +90,12 @@ func (self *HotspotIntegerGenerator) Mean() float64 {
 		(1-self.hotOpnFraction)*float64(self.lowerBound+self.hotInterval+self.coldInterval/2.0)
 }
 
+func (self *HotspotIntegerGenerator) Clone() IntegerGenerator {
+	object := *self
+	object.IntegerGeneratorBase = NewIntegerGeneratorBase(self.LastInt())
+	return &object
+}
+
 func (self *HotspotIntegerGenerator) GetLowerBound() int64 {
 	return self.lowerBound
 }
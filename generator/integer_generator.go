@@ -2,6 +2,7 @@ package generator
 
 import (
 	"fmt"
+	"math/rand"
 )
 
 // IntegerGenerator is a generator capable of generating integers and strings.
@@ -12,6 +13,11 @@ type IntegerGenerator interface {
 	// won't work.
 	NextInt() int64
 
+	// NextIntFrom returns the next value as NextInt() does, but draws from
+	// the random source r instead of the one shared in this package, for
+	// the callers which own their random sources, e.g. one per routine.
+	NextIntFrom(r *rand.Rand) int64
+
 	// LastInt returns the previous int generated by the distribution.
 	// This call is unique to IntegerGenerator implementation struct, and
 	// assumes all implementation of this interface always return ints for
@@ -21,6 +27,14 @@ type IntegerGenerator interface {
 	// Mean returns the expected value(mean) of the values this generator will
 	// return.
 	Mean() float64
+
+	// Clone returns a generator of the same distribution with a state of its
+	// own(e.g. the last value), which shares the parameters computed by this
+	// one(e.g. the zeta constants of zipfian) instead of computing them again,
+	// so that every routine could draw from its own clone without
+	// synchronization. The generators of the sequences shared by all
+	// the routines(e.g. counters) and the stateless ones return themselves.
+	Clone() IntegerGenerator
 }
 
 // IntegerGeneratorBase is a parent class for all IntegerGenerator subclasses.
@@ -76,6 +90,10 @@ func (self *ConstantIntegerGenerator) NextInt() int64 {
 	return self.value
 }
 
+func (self *ConstantIntegerGenerator) NextIntFrom(r *rand.Rand) int64 {
+	return self.value
+}
+
 func (self *ConstantIntegerGenerator) NextString() string {
 	return self.IntegerGeneratorBase.NextString(self)
 }
@@ -84,6 +102,10 @@ func (self *ConstantIntegerGenerator) Mean() float64 {
 	return float64(self.NextInt())
 }
 
+func (self *ConstantIntegerGenerator) Clone() IntegerGenerator {
+	return self
+}
+
 // Generate a popularity distribution of items, skewed to favor recent items
 // significantly more than older items.
 type SkewedLatestGenerator struct {
@@ -112,6 +134,13 @@ func (self *SkewedLatestGenerator) NextInt() int64 {
 	return nextInt
 }
 
+func (self *SkewedLatestGenerator) NextIntFrom(r *rand.Rand) int64 {
+	max := self.basis.LastInt()
+	nextInt := max - self.zipfian.NextFrom(r, max)
+	self.SetLastInt(nextInt)
+	return nextInt
+}
+
 func (self *SkewedLatestGenerator) NextString() string {
 	return self.IntegerGeneratorBase.NextString(self)
 }
@@ -119,3 +148,12 @@ func (self *SkewedLatestGenerator) NextString() string {
 func (self *SkewedLatestGenerator) Mean() float64 {
 	panic("can't compute mean of non-stationary distribution")
 }
+
+// The clone shares the basis with this one.
+func (self *SkewedLatestGenerator) Clone() IntegerGenerator {
+	return &SkewedLatestGenerator{
+		IntegerGeneratorBase: NewIntegerGeneratorBase(self.LastInt()),
+		basis:                self.basis,
+		zipfian:              self.zipfian.Clone().(*ZipfianGenerator),
+	}
+}
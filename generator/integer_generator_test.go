@@ -3,6 +3,7 @@ package generator
 import (
 	"fmt"
 	"github.com/hhkbp2/testify/require"
+	"math/rand"
 	"testing"
 )
 
@@ -23,3 +24,71 @@ func TestConstantIntegerGenerator(t *testing.T) {
 func TestSkewedLatestGenerator(_ *testing.T) {
 	// TODO add impl
 }
+
+func TestIntegerGeneratorNextIntFrom(t *testing.T) {
+	total := 1000
+	makeGenerators := func() map[string]IntegerGenerator {
+		return map[string]IntegerGenerator{
+			"uniform":          NewUniformIntegerGenerator(0, 1000),
+			"zipfian":          NewZipfianGeneratorByInterval(0, 1000),
+			"scrambledzipfian": NewScrambledZipfianGeneratorByItems(1000),
+			"hotspot":          NewHotspotIntegerGenerator(0, 1000, 0.2, 0.8),
+			"exponential":      NewExponentialGeneratorByMean(100),
+			"histogram":        NewHistogramGenerator([]int64{1, 2, 3, 4}, 10),
+			"latest":           NewSkewedLatestGenerator(NewCounterGenerator(1000)),
+		}
+	}
+	gens1 := makeGenerators()
+	gens2 := makeGenerators()
+	for name, g1 := range gens1 {
+		g2 := gens2[name]
+		// the same seed gives the same sequence
+		r1 := rand.New(rand.NewSource(42))
+		r2 := rand.New(rand.NewSource(42))
+		values := make(map[int64]bool)
+		for i := 0; i < total; i++ {
+			v := g1.NextIntFrom(r1)
+			require.Equal(t, v, g2.NextIntFrom(r2), name)
+			require.Equal(t, v, g1.LastInt(), name)
+			values[v] = true
+		}
+		require.True(t, len(values) > 1, name)
+	}
+}
+
+func TestIntegerGeneratorClone(t *testing.T) {
+	total := 1000
+	counter := NewCounterGenerator(1000)
+	gens := map[string]IntegerGenerator{
+		"constant":         NewConstantIntegerGenerator(10),
+		"uniform":          NewUniformIntegerGenerator(0, 1000),
+		"zipfian":          NewZipfianGeneratorByInterval(0, 1000),
+		"scrambledzipfian": NewScrambledZipfianGeneratorByItems(1000),
+		"hotspot":          NewHotspotIntegerGenerator(0, 1000, 0.2, 0.8),
+		"exponential":      NewExponentialGeneratorByMean(100),
+		"histogram":        NewHistogramGenerator([]int64{1, 2, 3, 4}, 10),
+		"latest":           NewSkewedLatestGenerator(counter),
+	}
+	for name, g := range gens {
+		clone := g.Clone()
+		require.Equal(t, g.LastInt(), clone.LastInt(), name)
+		// the clone draws the same sequence with a state of its own
+		r1 := rand.New(rand.NewSource(42))
+		r2 := rand.New(rand.NewSource(42))
+		for i := 0; i < total; i++ {
+			require.Equal(t, g.NextIntFrom(r1), clone.NextIntFrom(r2), name)
+		}
+		last := g.LastInt()
+		for i := 0; i < total; i++ {
+			v := clone.NextIntFrom(r2)
+			if name != "constant" {
+				require.Equal(t, v, clone.LastInt(), name)
+			}
+			require.Equal(t, last, g.LastInt(), name)
+		}
+	}
+	// the shared sequences are not cloned
+	require.True(t, counter == counter.Clone())
+	acknowledged := NewAcknowledgedCounterGenerator(0)
+	require.True(t, acknowledged == acknowledged.Clone())
+}
@@ -1,5 +1,9 @@
 package generator
 
+import (
+	"math/rand"
+)
+
 // Generate integers randomly uniform from an interval.
 type UniformIntegerGenerator struct {
 	*IntegerGeneratorBase
@@ -26,6 +30,12 @@ func (self *UniformIntegerGenerator) NextInt() int64 {
 	return ret
 }
 
+func (self *UniformIntegerGenerator) NextIntFrom(r *rand.Rand) int64 {
+	ret := r.Int63n(self.interval) + self.lowerBound
+	self.SetLastInt(ret)
+	return ret
+}
+
 func (self *UniformIntegerGenerator) NextString() string {
 	return self.IntegerGeneratorBase.NextString(self)
 }
@@ -34,6 +44,12 @@ func (self *UniformIntegerGenerator) Mean() float64 {
 	return float64(self.lowerBound+self.upperBound) / 2.0
 }
 
+func (self *UniformIntegerGenerator) Clone() IntegerGenerator {
+	object := *self
+	object.IntegerGeneratorBase = NewIntegerGeneratorBase(self.LastInt())
+	return &object
+}
+
 // An expression that generates a random integer in the specified range.
 type UniformGenerator struct {
 	values     []string
@@ -56,6 +72,13 @@ func (self *UniformGenerator) NextString() string {
 	return self.lastString
 }
 
+// Generate the next string in the distribution, drawing from the random
+// source r.
+func (self *UniformGenerator) NextStringFrom(r *rand.Rand) string {
+	self.lastString = self.values[self.gen.NextIntFrom(r)]
+	return self.lastString
+}
+
 // Return the previous string generated by the distribution;
 // e.g., returned from the last NextString() call.
 // Calling LastString() should not advance the distribution or have any
@@ -67,3 +90,13 @@ func (self *UniformGenerator) LastString() string {
 	}
 	return self.lastString
 }
+
+// Return a generator of the same values with a state of its own, which
+// shares the values with this one.
+func (self *UniformGenerator) Clone() *UniformGenerator {
+	return &UniformGenerator{
+		values:     self.values,
+		lastString: self.lastString,
+		gen:        self.gen.Clone().(*UniformIntegerGenerator),
+	}
+}
@@ -2,6 +2,7 @@ package generator
 
 import (
 	"math"
+	"math/rand"
 )
 
 const (
@@ -144,9 +145,24 @@ func (self *ZipfianGenerator) NextLong() int64 {
 	return self.Next(self.items)
 }
 
+// Return the next value as NextInt() does, drawing from the random source r.
+func (self *ZipfianGenerator) NextIntFrom(r *rand.Rand) int64 {
+	return self.NextFrom(r, self.items)
+}
+
 // Generate the next item. this distribution will be skewed toward
 // lower itegers; e.g. 0 will be the most popular, 1 the next most popular, etc.
 func (self *ZipfianGenerator) Next(itemCount int64) int64 {
+	return self.next(itemCount, NextFloat64())
+}
+
+// Generate the next item as Next() does, drawing from the random source r.
+func (self *ZipfianGenerator) NextFrom(r *rand.Rand, itemCount int64) int64 {
+	return self.next(itemCount, r.Float64())
+}
+
+// Return the item at the point u in [0.0, 1.0) of the distribution.
+func (self *ZipfianGenerator) next(itemCount int64, u float64) int64 {
 	var ret int64
 	defer func(r *int64) {
 		self.IntegerGeneratorBase.SetLastInt(*r)
@@ -161,7 +177,6 @@ func (self *ZipfianGenerator) Next(itemCount int64) int64 {
 		}
 	}
 
-	u := NextFloat64()
 	uz := u * self.zetan
 	if uz < 1.0 {
 		ret = self.base
@@ -183,6 +198,14 @@ func (self *ZipfianGenerator) Mean() float64 {
 	panic("unsupported operation")
 }
 
+// The clone starts with the zeta constants computed by this one, and keeps
+// them up to date for the item count of its own.
+func (self *ZipfianGenerator) Clone() IntegerGenerator {
+	object := *self
+	object.IntegerGeneratorBase = NewIntegerGeneratorBase(self.LastInt())
+	return &object
+}
+
 var (
 	Zetan               = float64(26.46902820178302)
 	UsedZipfianConstant = float64(0.99)
@@ -253,6 +276,13 @@ func (self *ScrambledZipfianGenerator) Next() int64 {
 	return ret
 }
 
+func (self *ScrambledZipfianGenerator) NextIntFrom(r *rand.Rand) int64 {
+	ret := self.gen.NextIntFrom(r)
+	ret = self.min + int64(FNVHash64(uint64(ret))%uint64(self.itemCount))
+	self.SetLastInt(ret)
+	return ret
+}
+
 func (self *ScrambledZipfianGenerator) NextString() string {
 	return self.IntegerGeneratorBase.NextString(self)
 }
@@ -263,6 +293,13 @@ func (self *ScrambledZipfianGenerator) Mean() float64 {
 	return float64(self.min+self.max) / 2.0
 }
 
+func (self *ScrambledZipfianGenerator) Clone() IntegerGenerator {
+	object := *self
+	object.IntegerGeneratorBase = NewIntegerGeneratorBase(self.LastInt())
+	object.gen = self.gen.Clone().(*ZipfianGenerator)
+	return &object
+}
+
 // Hash a integer value.
 func Hash(value int64) uint64 {
 	return FNVHash64(uint64(value))
@@ -2,7 +2,9 @@ package generator
 
 import (
 	"github.com/hhkbp2/testify/require"
+	"math/rand"
 	"strconv"
+	"sync/atomic"
 	"testing"
 )
 
@@ -33,3 +35,28 @@ func runTestZipfianGenerator(t *testing.T, f func(min, max int64) IntegerGenerat
 		require.True(t, v >= min && v <= max)
 	}
 }
+
+// Draw from one generator shared by all the routines, which serializes
+// them on the random source of this package.
+func BenchmarkScrambledZipfianGeneratorShared(b *testing.B) {
+	g := NewScrambledZipfianGeneratorByItems(1000000)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			g.NextInt()
+		}
+	})
+}
+
+// Draw from a clone and a random source of every routine, which scales with
+// the number of routines(see the -cpu flag of go test).
+func BenchmarkScrambledZipfianGeneratorCloned(b *testing.B) {
+	g := NewScrambledZipfianGeneratorByItems(1000000)
+	var seed int64
+	b.RunParallel(func(pb *testing.PB) {
+		clone := g.Clone()
+		r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+		for pb.Next() {
+			clone.NextIntFrom(r)
+		}
+	})
+}
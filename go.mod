@@ -7,7 +7,10 @@ require (
 	github.com/go-sql-driver/mysql v1.5.0
 	github.com/hhkbp2/go-strftime v0.0.0-20150709091403-d82166ec6782
 	github.com/hhkbp2/testify v0.0.0-20150512090439-112845ebc045
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/stretchr/testify v1.5.1 // indirect
+	go.etcd.io/bbolt v1.3.6
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
 
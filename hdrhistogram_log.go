@@ -0,0 +1,403 @@
+package yabf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// The cookies of the V2 encoding of HdrHistogram. The word size byte 0x10
+// indicates the ZigZag LEB128 encoding of counts.
+const (
+	hdrEncodingCookieBase           = 0x1c849303
+	hdrCompressedEncodingCookieBase = 0x1c849304
+	hdrEncodingCookie               = hdrEncodingCookieBase | 0x10
+	hdrCompressedEncodingCookie     = hdrCompressedEncodingCookieBase | 0x10
+	hdrMaxZigZagSize                = 9
+)
+
+// The header of the V2 encoding of HdrHistogram, all in big endian.
+// The counts are encoded in the logical order, so the normalizing index
+// offset is ignored in decoding.
+type hdrEncodingHeader struct {
+	Cookie                 int32
+	PayloadLength          int32
+	NormalizingIndexOffset int32
+	SignificantFigures     int32
+	LowestTrackableValue   int64
+	HighestTrackableValue  int64
+	ConversionRatio        float64
+}
+
+// Put the ZigZag LEB128 encoding of the value into buf, and return the number
+// of bytes written. It takes up to 9 bytes, the last of which has all
+// the 8 bits for value.
+func putZigZag(buf []byte, value int64) int {
+	v := uint64((value << 1) ^ (value >> 63))
+	for i := 0; i < hdrMaxZigZagSize-1; i++ {
+		if v < 0x80 {
+			buf[i] = byte(v)
+			return i + 1
+		}
+		buf[i] = byte(v&0x7f) | 0x80
+		v >>= 7
+	}
+	buf[hdrMaxZigZagSize-1] = byte(v)
+	return hdrMaxZigZagSize
+}
+
+// Return the value of ZigZag LEB128 encoding at the beginning of data,
+// and the number of bytes it takes.
+func getZigZag(data []byte) (int64, int, error) {
+	var v uint64
+	for i := 0; i < hdrMaxZigZagSize; i++ {
+		if i >= len(data) {
+			return 0, 0, g.NewErrorf("truncated ZigZag encoding")
+		}
+		b := data[i]
+		if i == hdrMaxZigZagSize-1 {
+			v |= uint64(b) << 56
+			return int64(v>>1) ^ -int64(v&1), i + 1, nil
+		}
+		v |= uint64(b&0x7f) << uint(7*i)
+		if b&0x80 == 0 {
+			return int64(v>>1) ^ -int64(v&1), i + 1, nil
+		}
+	}
+	panic("impossible to be here. Dead code reached. Bugs?")
+}
+
+// Encode the histogram in the compressed V2 encoding of HdrHistogram, which
+// is compatible with the Java and other implementations.
+func EncodeCompressedHdrHistogram(h *hdrhistogram.Histogram) ([]byte, error) {
+	snapshot := h.Export()
+	counts := snapshot.Counts
+	// only the counts up to the last non-zero one are encoded
+	countsLimit := len(counts)
+	for (countsLimit > 0) && (counts[countsLimit-1] == 0) {
+		countsLimit--
+	}
+	var payload bytes.Buffer
+	buf := make([]byte, hdrMaxZigZagSize)
+	for i := 0; i < countsLimit; {
+		count := counts[i]
+		i++
+		if count == 0 {
+			// a run of zeros is encoded as the negative length of it
+			zeros := int64(1)
+			for (i < countsLimit) && (counts[i] == 0) {
+				zeros++
+				i++
+			}
+			if zeros > 1 {
+				count = -zeros
+			}
+		}
+		n := putZigZag(buf, count)
+		payload.Write(buf[:n])
+	}
+	lowest := snapshot.LowestTrackableValue
+	if lowest < 1 {
+		// the other implementations require it to be at least 1, which
+		// is equivalent to 0 for the layout of counts
+		lowest = 1
+	}
+	header := &hdrEncodingHeader{
+		Cookie:                hdrEncodingCookie,
+		PayloadLength:         int32(payload.Len()),
+		SignificantFigures:    int32(snapshot.SignificantFigures),
+		LowestTrackableValue:  lowest,
+		HighestTrackableValue: snapshot.HighestTrackableValue,
+		ConversionRatio:       1.0,
+	}
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if err := binary.Write(zw, binary.BigEndian, header); err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(payload.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	ret := make([]byte, 8, 8+compressed.Len())
+	binary.BigEndian.PutUint32(ret[0:4], hdrCompressedEncodingCookie)
+	binary.BigEndian.PutUint32(ret[4:8], uint32(compressed.Len()))
+	return append(ret, compressed.Bytes()...), nil
+}
+
+// Decode the histogram from the compressed V2 encoding of HdrHistogram.
+func DecodeCompressedHdrHistogram(data []byte) (*hdrhistogram.Histogram, error) {
+	if len(data) < 8 {
+		return nil, g.NewErrorf("truncated compressed histogram")
+	}
+	if cookie := binary.BigEndian.Uint32(data[0:4]); cookie&^0xf0 != hdrCompressedEncodingCookieBase {
+		return nil, g.NewErrorf("unsupported compressed histogram cookie: 0x%x", cookie)
+	}
+	length := int(binary.BigEndian.Uint32(data[4:8]))
+	if len(data) < 8+length {
+		return nil, g.NewErrorf("truncated compressed histogram")
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data[8 : 8+length]))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	raw, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+	var header hdrEncodingHeader
+	if err = binary.Read(bytes.NewReader(raw), binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Cookie&^0xf0 != hdrEncodingCookieBase {
+		return nil, g.NewErrorf("unsupported histogram cookie: 0x%x", header.Cookie)
+	}
+	if (header.SignificantFigures < 1) || (header.SignificantFigures > 5) {
+		return nil, g.NewErrorf("invalid significant figures: %d", header.SignificantFigures)
+	}
+	headerSize := binary.Size(&header)
+	if len(raw) < headerSize+int(header.PayloadLength) {
+		return nil, g.NewErrorf("truncated histogram payload")
+	}
+	payload := raw[headerSize : headerSize+int(header.PayloadLength)]
+
+	snapshot := hdrhistogram.New(header.LowestTrackableValue, header.HighestTrackableValue,
+		int(header.SignificantFigures)).Export()
+	counts := snapshot.Counts
+	index := 0
+	for offset := 0; offset < len(payload); {
+		count, n, err := getZigZag(payload[offset:])
+		if err != nil {
+			return nil, err
+		}
+		offset += n
+		if count < 0 {
+			index += int(-count)
+			continue
+		}
+		if index >= len(counts) {
+			return nil, g.NewErrorf("histogram count out of range")
+		}
+		counts[index] = count
+		index++
+	}
+	return hdrhistogram.Import(snapshot), nil
+}
+
+const (
+	HdrHistogramLogFormatVersion = "1.3"
+	HdrHistogramLogLegend        = `"StartTimestamp","Interval_Length","Interval_Max","Interval_Compressed_Histogram"`
+	// The ratio of the latencies in microseconds to the max values in
+	// the log, which are in milliseconds.
+	HdrHistogramLogMaxValueUnitRatio = 1000.0
+)
+
+func formatLogSeconds(ms int64) string {
+	return strconv.FormatFloat(float64(ms)/1000.0, 'f', 3, 64)
+}
+
+// Write interval histograms in the standard HdrHistogram log format, which
+// could be consumed by HistogramLogAnalyzer, the HdrHistogram plotter and
+// other tools, e.g.
+//
+//	#[Histogram log format version 1.3]
+//	#[StartTime: 1441812279.474 (seconds since epoch), Wed Sep 09 08:24:39 PDT 2015]
+//	#[BaseTime: 1441812279.474 (seconds since epoch)]
+//	"StartTimestamp","Interval_Length","Interval_Max","Interval_Compressed_Histogram"
+//	0.127,1.007,2.769,HISTFAAAAEV42pNpmSzMwMCgyAABTBDKT4GBgk3ajNIE...
+//
+// The start timestamps are in seconds relative to the base time, and
+// the max values are in milliseconds.
+type HdrHistogramLogWriter struct {
+	w io.Writer
+	// the base time in milliseconds since epoch
+	baseTime int64
+	// the tag of the interval histograms, if any
+	tag string
+}
+
+func NewHdrHistogramLogWriter(w io.Writer) *HdrHistogramLogWriter {
+	return &HdrHistogramLogWriter{
+		w: w,
+	}
+}
+
+// Tag the interval histograms written from now on, e.g. with
+// the operation, so that the ones of several operations could be told
+// apart in one log.
+func (self *HdrHistogramLogWriter) SetTag(tag string) {
+	self.tag = tag
+}
+
+// Write the header of log with the start time in milliseconds since epoch,
+// which is also the base time of the intervals.
+func (self *HdrHistogramLogWriter) OutputHeader(startTime int64) error {
+	self.baseTime = startTime
+	t := time.Unix(0, MillisecondToNanosecond(startTime))
+	_, err := fmt.Fprintf(self.w, "#[Histogram log format version %s]\n#[StartTime: %s (seconds since epoch), %s]\n#[BaseTime: %s (seconds since epoch)]\n%s\n",
+		HdrHistogramLogFormatVersion,
+		formatLogSeconds(startTime), t.Format("Mon Jan 02 15:04:05 MST 2006"),
+		formatLogSeconds(startTime),
+		HdrHistogramLogLegend)
+	return err
+}
+
+// Write the histogram of the interval from startTime to endTime, both in
+// milliseconds since epoch.
+func (self *HdrHistogramLogWriter) OutputIntervalHistogram(startTime, endTime int64, h *hdrhistogram.Histogram) error {
+	data, err := EncodeCompressedHdrHistogram(h)
+	if err != nil {
+		return err
+	}
+	var tag string
+	if len(self.tag) > 0 {
+		tag = "Tag=" + self.tag + ","
+	}
+	// written at once, so that the lines of the writers sharing the log
+	// are not interleaved
+	_, err = fmt.Fprintf(self.w, "%s%s,%s,%.3f,%s\n",
+		tag,
+		formatLogSeconds(startTime-self.baseTime),
+		formatLogSeconds(endTime-startTime),
+		float64(h.Max())/HdrHistogramLogMaxValueUnitRatio,
+		base64.StdEncoding.EncodeToString(data))
+	return err
+}
+
+// An interval histogram in the log.
+type HdrIntervalHistogram struct {
+	// the tag of the histogram, empty if there is none
+	Tag string
+	// the start and end time of interval in milliseconds since epoch
+	StartTime int64
+	EndTime   int64
+	Histogram *hdrhistogram.Histogram
+}
+
+// Read interval histograms from the standard HdrHistogram log format.
+type HdrHistogramLogReader struct {
+	scanner *bufio.Scanner
+	// the start time and base time in seconds
+	startTime        float64
+	baseTime         float64
+	observedBaseTime bool
+}
+
+func NewHdrHistogramLogReader(r io.Reader) *HdrHistogramLogReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &HdrHistogramLogReader{
+		scanner: scanner,
+	}
+}
+
+// Return the start time of the log in milliseconds since epoch, which is
+// available after the first interval histogram is read.
+func (self *HdrHistogramLogReader) StartTime() int64 {
+	return int64(math.Round(self.startTime * 1000.0))
+}
+
+func parseLogHeaderSeconds(line, prefix string) (float64, error) {
+	fields := strings.Fields(strings.TrimPrefix(line, prefix))
+	if len(fields) == 0 {
+		return 0, g.NewErrorf("invalid histogram log line: %s", line)
+	}
+	return strconv.ParseFloat(strings.TrimSuffix(fields[0], "]"), 64)
+}
+
+// Return the next interval histogram in the log, or io.EOF if there is no more.
+func (self *HdrHistogramLogReader) NextIntervalHistogram() (*HdrIntervalHistogram, error) {
+	for self.scanner.Scan() {
+		line := strings.TrimSpace(self.scanner.Text())
+		var err error
+		switch {
+		case strings.HasPrefix(line, "#[StartTime: "):
+			self.startTime, err = parseLogHeaderSeconds(line, "#[StartTime: ")
+		case strings.HasPrefix(line, "#[BaseTime: "):
+			self.baseTime, err = parseLogHeaderSeconds(line, "#[BaseTime: ")
+			self.observedBaseTime = true
+		case (len(line) == 0) || strings.HasPrefix(line, "#") || strings.HasPrefix(line, `"StartTimestamp"`):
+		default:
+			return self.parseIntervalHistogram(line)
+		}
+		if err != nil {
+			return nil, g.NewErrorf("invalid histogram log line: %s", line)
+		}
+	}
+	if err := self.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (self *HdrHistogramLogReader) parseIntervalHistogram(line string) (*HdrIntervalHistogram, error) {
+	var tag string
+	if strings.HasPrefix(line, "Tag=") {
+		i := strings.Index(line, ",")
+		if i < 0 {
+			return nil, g.NewErrorf("invalid histogram log line: %s", line)
+		}
+		tag = strings.TrimPrefix(line[:i], "Tag=")
+		line = line[i+1:]
+	}
+	fields := strings.Split(line, ",")
+	if len(fields) != 4 {
+		return nil, g.NewErrorf("invalid histogram log line: %s", line)
+	}
+	timestamp, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, g.NewErrorf("invalid histogram log line: %s", line)
+	}
+	length, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, g.NewErrorf("invalid histogram log line: %s", line)
+	}
+	data, err := base64.StdEncoding.DecodeString(fields[3])
+	if err != nil {
+		return nil, g.NewErrorf("invalid histogram log line: %s", line)
+	}
+	h, err := DecodeCompressedHdrHistogram(data)
+	if err != nil {
+		return nil, err
+	}
+	if !self.observedBaseTime {
+		// the timestamps more than a year before the start time are
+		// taken as relative to it, otherwise absolute
+		if timestamp < self.startTime-365*24*3600.0 {
+			self.baseTime = self.startTime
+		}
+		self.observedBaseTime = true
+	}
+	startTime := timestamp + self.baseTime
+	return &HdrIntervalHistogram{
+		Tag:       tag,
+		StartTime: int64(math.Round(startTime * 1000.0)),
+		EndTime:   int64(math.Round((startTime + length) * 1000.0)),
+		Histogram: h,
+	}, nil
+}
+
+// Return the histogram of the next interval in the log, or io.EOF if
+// there is no more.
+func (self *HdrHistogramLogReader) NextHistogram() (*hdrhistogram.Histogram, error) {
+	interval, err := self.NextIntervalHistogram()
+	if err != nil {
+		return nil, err
+	}
+	return interval.Histogram, nil
+}
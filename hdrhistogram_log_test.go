@@ -0,0 +1,110 @@
+package yabf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"github.com/codahale/hdrhistogram"
+	"github.com/hhkbp2/testify/require"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestZigZag(t *testing.T) {
+	buf := make([]byte, hdrMaxZigZagSize)
+	for _, v := range []int64{0, 1, -1, 63, -64, 64, 300, -300, 1 << 40, math.MaxInt64, math.MinInt64} {
+		n := putZigZag(buf, v)
+		x, m, err := getZigZag(buf[:n])
+		require.Nil(t, err)
+		require.Equal(t, n, m)
+		require.Equal(t, v, x)
+	}
+	_, _, err := getZigZag([]byte{0x80})
+	require.NotNil(t, err)
+}
+
+func newTestHistogram(values ...int64) *hdrhistogram.Histogram {
+	h := hdrhistogram.New(0, 2000000, 3)
+	for _, v := range values {
+		h.RecordValue(v)
+	}
+	return h
+}
+
+func TestCompressedHdrHistogram(t *testing.T) {
+	h := newTestHistogram(1, 1, 2, 100, 1000, 12345, 999999)
+	data, err := EncodeCompressedHdrHistogram(h)
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(base64.StdEncoding.EncodeToString(data), "HISTF"))
+	h2, err := DecodeCompressedHdrHistogram(data)
+	require.Nil(t, err)
+	require.Equal(t, h.Export().Counts, h2.Export().Counts)
+	require.Equal(t, h.TotalCount(), h2.TotalCount())
+	require.Equal(t, h.Max(), h2.Max())
+	require.Equal(t, h.ValueAtQuantile(50), h2.ValueAtQuantile(50))
+
+	// empty histogram
+	data, err = EncodeCompressedHdrHistogram(newTestHistogram())
+	require.Nil(t, err)
+	h2, err = DecodeCompressedHdrHistogram(data)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), h2.TotalCount())
+
+	// encoded by another implementation of the same values
+	data, err = base64.StdEncoding.DecodeString("HISTFAAAADt42izGoRlAQAAG0Hc/maD6zKHZxhzCmcAksmQjIyjX3lyvCSMKOmhmqcf2Afq8JeeQZ8295x8AlTYHGQ==")
+	require.Nil(t, err)
+	h2, err = DecodeCompressedHdrHistogram(data)
+	require.Nil(t, err)
+	require.Equal(t, h.Export().Counts, h2.Export().Counts)
+
+	_, err = DecodeCompressedHdrHistogram([]byte{1, 2, 3, 4, 0, 0, 0, 0})
+	require.NotNil(t, err)
+}
+
+func TestHdrHistogramLog(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewHdrHistogramLogWriter(&buf)
+	startTime := int64(1441812279474)
+	require.Nil(t, writer.OutputHeader(startTime))
+	h1 := newTestHistogram(10, 20, 30)
+	h2 := newTestHistogram(1000, 2000)
+	require.Nil(t, writer.OutputIntervalHistogram(startTime+127, startTime+1134, h1))
+	require.Nil(t, writer.OutputIntervalHistogram(startTime+1134, startTime+2140, h2))
+	lines := strings.Split(buf.String(), "\n")
+	require.Equal(t, "#[Histogram log format version 1.3]", lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "#[StartTime: 1441812279.474 (seconds since epoch), "))
+	require.Equal(t, HdrHistogramLogLegend, lines[3])
+	require.True(t, strings.HasPrefix(lines[4], "0.127,1.007,0.030,HISTF"))
+
+	reader := NewHdrHistogramLogReader(&buf)
+	interval, err := reader.NextIntervalHistogram()
+	require.Nil(t, err)
+	require.Equal(t, startTime, reader.StartTime())
+	require.Equal(t, startTime+127, interval.StartTime)
+	require.Equal(t, startTime+1134, interval.EndTime)
+	require.Equal(t, h1.Export().Counts, interval.Histogram.Export().Counts)
+	h, err := reader.NextHistogram()
+	require.Nil(t, err)
+	require.Equal(t, h2.Export().Counts, h.Export().Counts)
+	_, err = reader.NextIntervalHistogram()
+	require.Equal(t, io.EOF, err)
+
+	// tagged lines with absolute timestamps, without base time
+	data, err := EncodeCompressedHdrHistogram(h1)
+	require.Nil(t, err)
+	log := fmt.Sprintf("#[StartTime: 1441812279.474 (seconds since epoch)]\nTag=READ,1441812280.000,1.000,0.030,%s\n",
+		base64.StdEncoding.EncodeToString(data))
+	reader = NewHdrHistogramLogReader(strings.NewReader(log))
+	interval, err = reader.NextIntervalHistogram()
+	require.Nil(t, err)
+	require.Equal(t, "READ", interval.Tag)
+	require.Equal(t, int64(1441812280000), interval.StartTime)
+	require.Equal(t, int64(1441812281000), interval.EndTime)
+	require.Equal(t, h1.TotalCount(), interval.Histogram.TotalCount())
+
+	reader = NewHdrHistogramLogReader(strings.NewReader("0.1,1.0,HISTF\n"))
+	_, err = reader.NextIntervalHistogram()
+	require.NotNil(t, err)
+}
@@ -2,8 +2,9 @@ package yabf
 
 import (
 	"bufio"
+	"bytes"
 	"container/list"
-	"encoding/binary"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -28,6 +29,7 @@ const (
 	MeasurementHDRHistogramAndRaw
 	MeasurementTimeSeries
 	MeasurementRaw
+	MeasurementHDRTimeSeries
 )
 
 type StatusType uint8
@@ -41,6 +43,8 @@ const (
 	StatusBadRequest
 	StatusForbidden
 	StatusServiceUnavailable
+	StatusTimeout
+	StatusCanceled
 )
 
 func (self StatusType) String() string {
@@ -61,11 +65,25 @@ func (self StatusType) String() string {
 		return "FORBIDDEN"
 	case StatusServiceUnavailable:
 		return "SERVICE_UNAVAILABLE"
+	case StatusTimeout:
+		return "TIMEOUT"
+	case StatusCanceled:
+		return "CANCELED"
 	default:
 		return "UNKNOW_STATUS"
 	}
 }
 
+// Return the status of the name returned by String().
+func ParseStatus(name string) (StatusType, bool) {
+	for status := StatusOK; status <= StatusCanceled; status++ {
+		if status.String() == name {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
 // Used to export the collected measuremrnts into a usefull format, for example
 // human readable text or machine readable JSON.
 type MeasurementExporter interface {
@@ -74,7 +92,9 @@ type MeasurementExporter interface {
 	io.Closer
 }
 
-type MakeMeasurementExporterFunc func(w io.WriteCloser) MeasurementExporter
+// Make an exporter writing to w. The properties and the label(of the "-l"
+// option) of the run are for the exporters which tag the measurements with them.
+type MakeMeasurementExporterFunc func(w io.WriteCloser, props Properties, label string) MeasurementExporter
 
 var (
 	MeasurementExporters map[string]MakeMeasurementExporterFunc
@@ -82,24 +102,30 @@ var (
 
 func init() {
 	MeasurementExporters = map[string]MakeMeasurementExporterFunc{
-		"TextMeasurementExporter": func(w io.WriteCloser) MeasurementExporter {
+		"TextMeasurementExporter": func(w io.WriteCloser, props Properties, label string) MeasurementExporter {
 			return NewTextMeasurementExporter(w)
 		},
-		"JSONMeasurementExporter": func(w io.WriteCloser) MeasurementExporter {
+		"JSONMeasurementExporter": func(w io.WriteCloser, props Properties, label string) MeasurementExporter {
 			return NewJSONMeasurementExporter(w)
 		},
-		"JSONArrayMeasurementExporter": func(w io.WriteCloser) MeasurementExporter {
+		"JSONArrayMeasurementExporter": func(w io.WriteCloser, props Properties, label string) MeasurementExporter {
 			return NewJSONArrayMeasurementExporter(w)
 		},
+		"CSVMeasurementExporter": func(w io.WriteCloser, props Properties, label string) MeasurementExporter {
+			return NewCSVMeasurementExporter(w, props, label)
+		},
+		"LineProtocolMeasurementExporter": func(w io.WriteCloser, props Properties, label string) MeasurementExporter {
+			return NewLineProtocolMeasurementExporter(w, props, label)
+		},
 	}
 }
 
-func NewMeasurementExporter(className string, w io.WriteCloser) (MeasurementExporter, error) {
+func NewMeasurementExporter(className string, w io.WriteCloser, props Properties, label string) (MeasurementExporter, error) {
 	f, ok := MeasurementExporters[className]
 	if !ok {
 		return nil, g.NewErrorf("unsupported measurement exporter: %s", className)
 	}
-	e := f(w)
+	e := f(w, props, label)
 	return e, nil
 }
 
@@ -110,10 +136,29 @@ type OneMeasurement interface {
 	GetSummary() string
 	// Report a return code.
 	ReportStatus(status StatusType)
+	// Return the counts of the return codes so far.
+	GetReturnCodes() map[StatusType]uint32
 	// Exports the current measurements to a suitable format.
 	ExportMeasurements(exporter MeasurementExporter) error
 }
 
+// The measurements which hold resources, e.g. an output file, to release
+// when they are discarded without being exported.
+type closableMeasurement interface {
+	close() error
+}
+
+// Close the measurements which hold resources.
+func closeMeasurements(measurements map[string]OneMeasurement) {
+	for op, m := range measurements {
+		if c, ok := m.(closableMeasurement); ok {
+			if err := c.close(); err != nil {
+				EPrintf("fail to close measurement of %s, error: %s", op, err)
+			}
+		}
+	}
+}
+
 type OneMeasurementBase struct {
 	Name            string
 	MeasureLock     *sync.Mutex
@@ -141,6 +186,17 @@ func (self *OneMeasurementBase) ReportStatus(status StatusType) {
 	self.ReturnCodes[status] = count + 1
 }
 
+// Return a copy of the counts of the return codes so far.
+func (self *OneMeasurementBase) GetReturnCodes() map[StatusType]uint32 {
+	self.ReturnCodesLock.Lock()
+	defer self.ReturnCodesLock.Unlock()
+	returnCodes := make(map[StatusType]uint32)
+	for status, count := range self.ReturnCodes {
+		returnCodes[status] = count
+	}
+	return returnCodes
+}
+
 func (self *OneMeasurementBase) ExportStatusCounts(exporter MeasurementExporter) error {
 	var err error
 	for status, count := range self.ReturnCodes {
@@ -158,21 +214,91 @@ type Measurements interface {
 	// operation="READ" and latency is the measured value.
 	Measure(operation string, latency int64)
 
+	// Report a single latency of an operation which is measured from
+	// the intended start time in the schedule of the client, instead of
+	// the actual start time, to correct the coordinated omission.
+	// It's recorded under the operation name prefixed with "Intended-".
+	MeasureIntended(operation string, latency int64)
+
 	// Return a one line summary of the measurements.
 	GetSummary() string
 
 	// Report a return code for a single DB operation.
 	ReportStatus(operation string, status StatusType)
 
+	// Add delta to the named counter of a metric. E.g. for the records
+	// inserted by batches, metric="BATCH-INSERT" and counter="Records".
+	Count(metric string, counter string, delta int64)
+
+	// Return the current value of the named counter of a metric.
+	GetCount(metric string, counter string) int64
+
 	// Export the current measurements to a suitable format.
 	ExportMeasurements(exporter MeasurementExporter) error
+
+	// Return the measurement of an operation, or nil if there is none.
+	Lookup(operation string) OneMeasurement
+
+	// Return the names of all the operations measured, in sorted order.
+	Operations() []string
+
+	// Discard all the measurements and counters so far, e.g. the ones
+	// during warm-up. The operations in progress may still be recorded
+	// into the discarded ones.
+	Reset()
+
+	// Return a snapshot of all the measurements and counters, which could
+	// be shipped to another process. Only the HdrHistogram measurements
+	// support it.
+	Snapshot() (*MeasurementsSnapshot, error)
+
+	// Merge a snapshot of the measurements of another process into these.
+	Merge(snapshot *MeasurementsSnapshot) error
+}
+
+// A snapshot of the measurement of an operation.
+type MeasurementSnapshot struct {
+	Histogram   *hdrhistogram.Snapshot
+	ReturnCodes map[StatusType]uint32
+}
+
+// A snapshot of all the measurements and counters of a process.
+type MeasurementsSnapshot struct {
+	Operations map[string]*MeasurementSnapshot
+	Counters   map[string]map[string]int64
+}
+
+// The flags of which latencies of the DB operations to record, configured
+// by the "measurement.interval" property.
+const (
+	measureOpInterval = 1 << iota
+	measureIntendedInterval
+)
+
+// Parse the "measurement.interval" property into the flags.
+func parseMeasurementInterval(props Properties) (int, error) {
+	propStr := props.GetDefault(PropertyMeasurementInterval, PropertyMeasurementIntervalDefault)
+	switch propStr {
+	case "op":
+		return measureOpInterval, nil
+	case "intended":
+		return measureIntendedInterval, nil
+	case "both":
+		return measureOpInterval | measureIntendedInterval, nil
+	default:
+		return 0, g.NewErrorf("unknown %s=%s", PropertyMeasurementInterval, propStr)
+	}
 }
 
 type DefaultMeasurements struct {
 	props              Properties
 	measurementType    MeasurementType
 	opToMeasurementMap map[string]OneMeasurement
+	counters           map[string]map[string]int64
 	lock               *sync.RWMutex
+	countersLock       *sync.Mutex
+	// the routine streaming the time series, only for "hdrtimeseries"
+	streamer *TimeSeriesStreamer
 }
 
 func NewDefaultMeasurements(props Properties) *DefaultMeasurements {
@@ -192,16 +318,29 @@ func NewDefaultMeasurements(props Properties) *DefaultMeasurements {
 		measurementType = MeasurementTimeSeries
 	case "raw":
 		measurementType = MeasurementRaw
+	case "hdrtimeseries":
+		measurementType = MeasurementHDRTimeSeries
 	default:
 		panic(fmt.Sprintf("unknown %s=%s", PropertyMeasurementType, propStr))
 	}
 
-	return &DefaultMeasurements{
+	object := &DefaultMeasurements{
 		props:              props,
 		measurementType:    measurementType,
 		opToMeasurementMap: opToMeasurementMap,
+		counters:           make(map[string]map[string]int64),
 		lock:               &sync.RWMutex{},
+		countersLock:       &sync.Mutex{},
 	}
+	if measurementType == MeasurementHDRTimeSeries {
+		streamer, err := NewTimeSeriesStreamer(object, props)
+		if err != nil {
+			panic(fmt.Sprintf("fail to create time series streamer, error: %s", err))
+		}
+		object.streamer = streamer
+		go streamer.run()
+	}
+	return object
 }
 
 func MustNewMeasurement(m OneMeasurement, err error) OneMeasurement {
@@ -229,6 +368,8 @@ func (self *DefaultMeasurements) constructOneMeasurement(name string) OneMeasure
 		return MustNewMeasurement(NewOneMeasurementTimeSeries(name, self.props))
 	case MeasurementRaw:
 		return MustNewMeasurement(NewOneMeasurementRaw(name, self.props))
+	case MeasurementHDRTimeSeries:
+		return MustNewMeasurement(NewOneMeasurementHdrTimeSeries(name, self.props))
 	default:
 		panic("impossible to be here. Dead code reached. Bugs?")
 	}
@@ -241,7 +382,16 @@ func (self *DefaultMeasurements) Measure(operation string, latency int64) {
 	m.Measure(latency)
 }
 
+// Report a single latency of an operation which is measured from
+// the intended start time.
+func (self *DefaultMeasurements) MeasureIntended(operation string, latency int64) {
+	m := self.getOpMeasurement("Intended-" + operation)
+	m.Measure(latency)
+}
+
 func (self *DefaultMeasurements) GetSummary() string {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
 	var ret string
 	for _, m := range self.opToMeasurementMap {
 		ret += m.GetSummary()
@@ -254,14 +404,130 @@ func (self *DefaultMeasurements) ReportStatus(operation string, status StatusTyp
 	m.ReportStatus(status)
 }
 
+func (self *DefaultMeasurements) Count(metric string, counter string, delta int64) {
+	self.countersLock.Lock()
+	defer self.countersLock.Unlock()
+	m, ok := self.counters[metric]
+	if !ok {
+		m = make(map[string]int64)
+		self.counters[metric] = m
+	}
+	m[counter] += delta
+}
+
+func (self *DefaultMeasurements) GetCount(metric string, counter string) int64 {
+	self.countersLock.Lock()
+	defer self.countersLock.Unlock()
+	return self.counters[metric][counter]
+}
+
 func (self *DefaultMeasurements) ExportMeasurements(exporter MeasurementExporter) (err error) {
 	defer catch(&err)
+	self.stopStreaming()
 	for _, m := range self.opToMeasurementMap {
 		try(m.ExportMeasurements(exporter))
 	}
+	self.countersLock.Lock()
+	defer self.countersLock.Unlock()
+	for metric, m := range self.counters {
+		for counter, v := range m {
+			try(exporter.Write(metric, counter, v))
+		}
+	}
 	return
 }
 
+// Stop streaming and close all the measurements, which are discarded.
+func (self *DefaultMeasurements) close() {
+	self.stopStreaming()
+	self.lock.RLock()
+	measurements := self.opToMeasurementMap
+	self.lock.RUnlock()
+	closeMeasurements(measurements)
+}
+
+// Stop streaming the time series, if any.
+func (self *DefaultMeasurements) stopStreaming() {
+	if self.streamer != nil {
+		if err := self.streamer.stop(); err != nil {
+			EPrintf("fail to write time series, error: %s", err)
+		}
+	}
+}
+
+func (self *DefaultMeasurements) Lookup(operation string) OneMeasurement {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return self.opToMeasurementMap[operation]
+}
+
+func (self *DefaultMeasurements) Operations() []string {
+	self.lock.RLock()
+	ret := make([]string, 0, len(self.opToMeasurementMap))
+	for op, _ := range self.opToMeasurementMap {
+		ret = append(ret, op)
+	}
+	self.lock.RUnlock()
+	sort.Strings(ret)
+	return ret
+}
+
+func (self *DefaultMeasurements) Reset() {
+	self.lock.Lock()
+	measurements := self.opToMeasurementMap
+	self.opToMeasurementMap = make(map[string]OneMeasurement)
+	self.lock.Unlock()
+	// the log files of the discarded measurements are continued by
+	// the new ones
+	closeMeasurements(measurements)
+	self.countersLock.Lock()
+	self.counters = make(map[string]map[string]int64)
+	self.countersLock.Unlock()
+}
+
+func (self *DefaultMeasurements) Snapshot() (*MeasurementsSnapshot, error) {
+	snapshot := &MeasurementsSnapshot{
+		Operations: make(map[string]*MeasurementSnapshot),
+		Counters:   make(map[string]map[string]int64),
+	}
+	self.lock.RLock()
+	for op, m := range self.opToMeasurementMap {
+		hdr, ok := m.(*OneMeasurementHdrHistogram)
+		if !ok {
+			self.lock.RUnlock()
+			return nil, g.NewErrorf("measurement of %s doesn't support snapshot", op)
+		}
+		snapshot.Operations[op] = hdr.Snapshot()
+	}
+	self.lock.RUnlock()
+	self.countersLock.Lock()
+	defer self.countersLock.Unlock()
+	for metric, m := range self.counters {
+		counters := make(map[string]int64)
+		for counter, v := range m {
+			counters[counter] = v
+		}
+		snapshot.Counters[metric] = counters
+	}
+	return snapshot, nil
+}
+
+func (self *DefaultMeasurements) Merge(snapshot *MeasurementsSnapshot) error {
+	for op, s := range snapshot.Operations {
+		hdr, ok := self.getOpMeasurement(op).(*OneMeasurementHdrHistogram)
+		if !ok {
+			return g.NewErrorf("measurement of %s doesn't support merge", op)
+		}
+		hdr.Merge(s)
+	}
+	for metric, m := range snapshot.Counters {
+		for counter, v := range m {
+			self.Count(metric, counter, v)
+		}
+	}
+	return nil
+}
+
 func (self *DefaultMeasurements) getOpMeasurement(operation string) OneMeasurement {
 	self.lock.RLock()
 	m, ok := self.opToMeasurementMap[operation]
@@ -278,17 +544,38 @@ func (self *DefaultMeasurements) getOpMeasurement(operation string) OneMeasureme
 var (
 	measurementProperties Properties = NewProperties()
 	singleton             Measurements
+	// guard the two above, which are read by e.g. the Prometheus exporter
+	// in its own routine
+	singletonLock sync.Mutex
 )
 
 func SetMeasurementProperties(props Properties) {
+	singletonLock.Lock()
+	defer singletonLock.Unlock()
 	measurementProperties = props
 }
 
 func GetMeasurementProperties() Properties {
+	singletonLock.Lock()
+	defer singletonLock.Unlock()
 	return measurementProperties
 }
 
+// Discard the current measurements, so that the ones after are measured
+// afresh. It should be called when there is no operation in progress.
+func ResetMeasurements() {
+	singletonLock.Lock()
+	m := singleton
+	singleton = nil
+	singletonLock.Unlock()
+	if m, ok := m.(*DefaultMeasurements); ok {
+		m.close()
+	}
+}
+
 func GetMeasurements() Measurements {
+	singletonLock.Lock()
+	defer singletonLock.Unlock()
 	if singleton == nil {
 		singleton = NewDefaultMeasurements(measurementProperties)
 	}
@@ -356,7 +643,7 @@ func (self *JSONMeasurementExporter) Write(metric string, measurement string, v
 
 func (self *JSONMeasurementExporter) Close() error {
 	err := self.buf.Flush()
-	err2 := self.Close()
+	err2 := self.WriteCloser.Close()
 	if err != nil {
 		return err
 	}
@@ -407,13 +694,166 @@ func (self *JSONArrayMeasurementExporter) Close() error {
 		return err
 	}
 	err = self.buf.Flush()
-	err2 := self.Close()
+	err2 := self.WriteCloser.Close()
+	if err != nil {
+		return err
+	}
+	return err2
+}
+
+// The header of the CSV files exported by CSVMeasurementExporter.
+var CSVMeasurementHeader = []string{"timestamp", "label", "workload", "db", "metric", "measurement", "value"}
+
+// Export measurements into a CSV file with a stable header, one measurement
+// per row. Every row is tagged with the run, so that the measurements of
+// many runs could be appended to one file. The header is omitted when
+// appending to a non-empty file.
+type CSVMeasurementExporter struct {
+	io.WriteCloser
+	buf *csv.Writer
+	// the columns of the run before metric
+	run []string
+}
+
+func NewCSVMeasurementExporter(w io.WriteCloser, props Properties, label string) *CSVMeasurementExporter {
+	object := &CSVMeasurementExporter{
+		WriteCloser: w,
+		buf:         csv.NewWriter(w),
+		run: []string{
+			time.Now().Format(time.RFC3339),
+			label,
+			props.Get(PropertyWorkload),
+			props.Get(PropertyDB),
+		},
+	}
+	if !isNonEmptyFile(w) {
+		object.buf.Write(CSVMeasurementHeader)
+	}
+	return object
+}
+
+func (self *CSVMeasurementExporter) Write(metric string, measurement string, v interface{}) error {
+	record := make([]string, 0, len(CSVMeasurementHeader))
+	record = append(record, self.run...)
+	record = append(record, metric, measurement, fmt.Sprintf("%v", v))
+	return self.buf.Write(record)
+}
+
+func (self *CSVMeasurementExporter) Close() error {
+	self.buf.Flush()
+	err := self.buf.Error()
+	err2 := self.WriteCloser.Close()
+	if err != nil {
+		return err
+	}
+	return err2
+}
+
+// Return whether w is a regular file which is not empty.
+func isNonEmptyFile(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return (err == nil) && info.Mode().IsRegular() && (info.Size() > 0)
+}
+
+// Export measurements in the InfluxDB line protocol. The measurements of
+// a metric are written as the fields of a point of "yabf", which is tagged
+// with the operation(the metric), the label, the workload and the db of
+// the run. All the points of a run have the same timestamp, when
+// the exporter is created.
+type LineProtocolMeasurementExporter struct {
+	io.WriteCloser
+	buf *bufio.Writer
+	// the tags of the run after operation, escaped
+	tags      string
+	timestamp int64
+	// the metric and the fields of the point to write
+	metric string
+	fields []string
+}
+
+func NewLineProtocolMeasurementExporter(w io.WriteCloser, props Properties, label string) *LineProtocolMeasurementExporter {
+	var tags bytes.Buffer
+	for _, tag := range [][]string{
+		{"label", label},
+		{"workload", props.Get(PropertyWorkload)},
+		{"db", props.Get(PropertyDB)},
+	} {
+		// the empty tag values are not allowed
+		if len(tag[1]) > 0 {
+			tags.WriteString("," + tag[0] + "=" + escapeLineProtocol(tag[1]))
+		}
+	}
+	return &LineProtocolMeasurementExporter{
+		WriteCloser: w,
+		buf:         bufio.NewWriter(w),
+		tags:        tags.String(),
+		timestamp:   NowNS(),
+		fields:      make([]string, 0),
+	}
+}
+
+func (self *LineProtocolMeasurementExporter) Write(metric string, measurement string, v interface{}) error {
+	var value string
+	switch x := v.(type) {
+	case int, int32, int64, uint32, uint64:
+		value = fmt.Sprintf("%di", x)
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			// not representable in the line protocol
+			return nil
+		}
+		value = strconv.FormatFloat(x, 'g', -1, 64)
+	case bool:
+		value = strconv.FormatBool(x)
+	default:
+		value = strconv.Quote(fmt.Sprintf("%v", x))
+	}
+	if metric != self.metric {
+		if err := self.flushPoint(); err != nil {
+			return err
+		}
+		self.metric = metric
+	}
+	self.fields = append(self.fields, escapeLineProtocol(measurement)+"="+value)
+	return nil
+}
+
+// Write the point of the current metric, if any.
+func (self *LineProtocolMeasurementExporter) flushPoint() error {
+	if len(self.fields) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(self.buf, "yabf,operation=%s%s %s %d\n",
+		escapeLineProtocol(self.metric), self.tags, strings.Join(self.fields, ","), self.timestamp)
+	self.fields = self.fields[:0]
+	return err
+}
+
+func (self *LineProtocolMeasurementExporter) Close() error {
+	err := self.flushPoint()
+	if err == nil {
+		err = self.buf.Flush()
+	}
+	err2 := self.WriteCloser.Close()
 	if err != nil {
 		return err
 	}
 	return err2
 }
 
+var (
+	lineProtocolReplacer = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// Escape the tag keys, tag values and field keys in the line protocol.
+func escapeLineProtocol(s string) string {
+	return lineProtocolReplacer.Replace(s)
+}
+
 // One raw point, has two fields:
 // timestamp(ms) when the datapoint is inserted, and the value.
 type RawDataPoint struct {
@@ -522,6 +962,16 @@ func catch(err *error) {
 	}
 }
 
+// Close the output file, if it's not stdout.
+func (self *OneMeasurementRaw) close() error {
+	if (len(self.filePath) == 0) || (self.file == nil) {
+		return nil
+	}
+	err := self.file.Close()
+	self.file = nil
+	return err
+}
+
 func (self *OneMeasurementRaw) ExportMeasurements(exporter MeasurementExporter) (err error) {
 	defer catch(&err)
 	// Output raw data points first then print out a summary of percentiles.
@@ -533,9 +983,7 @@ func (self *OneMeasurementRaw) ExportMeasurements(exporter MeasurementExporter)
 		tryn(self.file.WriteString(fmt.Sprintf("%s,%d,%d",
 			self.GetName(), p.timestamp.UnixNano()/1000, p.value)))
 	}
-	if len(self.filePath) != 0 {
-		self.file.Close()
-	}
+	self.close()
 	total := self.measurements.Len()
 	try(exporter.Write(self.GetName(), "Total Operations", total))
 	if total > 0 && !self.noSummaryStats {
@@ -786,48 +1234,18 @@ func (self *OneMeasurementHistogram) ExportMeasurements(exporter MeasurementExpo
 	return
 }
 
-type HdrHistogramLogReader struct {
-	r io.Reader
-}
-
-func NewHdrHistogramLogReader(r io.Reader) *HdrHistogramLogReader {
-	return &HdrHistogramLogReader{
-		r: r,
-	}
-}
-
-func (self *HdrHistogramLogReader) NextHistogram() (*hdrhistogram.Histogram, error) {
-	var snapshot *hdrhistogram.Snapshot
-	err := binary.Read(self.r, binary.LittleEndian, snapshot)
-	if err != nil {
-		return nil, err
-	}
-	h := hdrhistogram.Import(snapshot)
-	return h, nil
-}
-
-type HdrHistogramLogWriter struct {
-	w io.Writer
-}
-
-func NewHdrHistogramLogWriter(w io.Writer) *HdrHistogramLogWriter {
-	return &HdrHistogramLogWriter{
-		w: w,
-	}
-}
-
-func (self *HdrHistogramLogWriter) OutputHistogram(h *hdrhistogram.Histogram) error {
-	return binary.Write(self.w, binary.LittleEndian, h.Export())
-}
-
 // Take measurements and maintain a HdrHistogram of a given metric, such as READ LATENCY.
 type OneMeasurementHdrHistogram struct {
 	*OneMeasurementBase
 	histogram   *hdrhistogram.Histogram
 	filePath    string
-	file        *os.File
+	file        *hdrHistogramLogFile
 	writer      *HdrHistogramLogWriter
 	percentiles []int64
+	// the histogram of the current interval to log, and its start time
+	// in milliseconds since epoch
+	intervalHistogram *hdrhistogram.Histogram
+	intervalStartTime int64
 }
 
 // Helper function to parse the given percentile value string.
@@ -863,19 +1281,26 @@ func NewOneMeasurementHdrHistogram(name string, props Properties) (*OneMeasureme
 		return nil, err
 	}
 	var filePath string
-	var f *os.File
+	var f *hdrHistogramLogFile
 	var writer *HdrHistogramLogWriter
-	if !shouldLog {
-		filePath = ""
-		f = nil
-		writer = nil
-	} else {
-		filePath = props.GetDefault(PropertyHdrHistogramOutputPath, PropertyHdrHistogramOutputPathDefault)
-		f, err = os.OpenFile(filePath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	var intervalHistogram *hdrhistogram.Histogram
+	now := NowMS()
+	if shouldLog {
+		// the interval histograms of every operation are logged into
+		// a separate file, unless a log shared by all of them is specified
+		filePath = props.GetDefault(PropertyHdrHistogramOutputFile, PropertyHdrHistogramOutputFileDefault)
+		shared := len(filePath) > 0
+		if !shared {
+			filePath = props.GetDefault(PropertyHdrHistogramOutputPath, PropertyHdrHistogramOutputPathDefault) + name + ".hdr"
+		}
+		f, writer, err = openHdrHistogramLog(filePath, now)
 		if err != nil {
 			return nil, err
 		}
-		writer = NewHdrHistogramLogWriter(f)
+		if shared {
+			writer.SetTag(name)
+		}
+		intervalHistogram = hdrhistogram.New(0, max, int(sig))
 	}
 	object := &OneMeasurementHdrHistogram{
 		OneMeasurementBase: NewOneMeasurementBase(name),
@@ -884,24 +1309,139 @@ func NewOneMeasurementHdrHistogram(name string, props Properties) (*OneMeasureme
 		file:               f,
 		writer:             writer,
 		percentiles:        percentiles,
+		intervalHistogram:  intervalHistogram,
+		intervalStartTime:  now,
 	}
 	return object, nil
 }
 
+// A histogram log file opened by this process. It's shared by
+// the measurements logging into it, e.g. all the operations with
+// the shared log, so that it's opened only once and their intervals are
+// written under the lock. It's closed when the last of them is closed.
+type hdrHistogramLogFile struct {
+	lock sync.Mutex
+	file *os.File
+	// the base time of the log
+	baseTime int64
+	// the number of the measurements logging into the file
+	refCount int
+}
+
+func (self *hdrHistogramLogFile) Write(p []byte) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.file.Write(p)
+}
+
+func (self *hdrHistogramLogFile) Close() error {
+	hdrHistogramLogFilesLock.Lock()
+	defer hdrHistogramLogFilesLock.Unlock()
+	self.refCount--
+	if self.refCount > 0 {
+		return nil
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	err := self.file.Close()
+	self.file = nil
+	return err
+}
+
+var (
+	// the histogram log files opened by this process, which are kept after
+	// they're closed, so that they're appended to instead of being
+	// overwritten when they're opened again, e.g. by the measurements after
+	// the warm-up
+	hdrHistogramLogFiles     = make(map[string]*hdrHistogramLogFile)
+	hdrHistogramLogFilesLock sync.Mutex
+)
+
+// Open the histogram log file, and write the header with the specified
+// start time unless the log is opened by this process before and it's
+// still there, in which case it's continued with the intervals relative
+// to its base time.
+func openHdrHistogramLog(filePath string, startTime int64) (*hdrHistogramLogFile, *HdrHistogramLogWriter, error) {
+	hdrHistogramLogFilesLock.Lock()
+	defer hdrHistogramLogFilesLock.Unlock()
+	logFile, ok := hdrHistogramLogFiles[filePath]
+	if ok && (logFile.refCount > 0) {
+		logFile.refCount++
+		writer := NewHdrHistogramLogWriter(logFile)
+		writer.baseTime = logFile.baseTime
+		return logFile, writer, nil
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if ok {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(filePath, flag, 0666)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok && isNonEmptyFile(f) {
+		logFile.file = f
+		logFile.refCount = 1
+		writer := NewHdrHistogramLogWriter(logFile)
+		writer.baseTime = logFile.baseTime
+		return logFile, writer, nil
+	}
+	writer := NewHdrHistogramLogWriter(f)
+	if err = writer.OutputHeader(startTime); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	logFile = &hdrHistogramLogFile{
+		file:     f,
+		baseTime: startTime,
+		refCount: 1,
+	}
+	hdrHistogramLogFiles[filePath] = logFile
+	writer = NewHdrHistogramLogWriter(logFile)
+	writer.baseTime = startTime
+	return logFile, writer, nil
+}
+
 // It appears latency is reported in micros.
 func (self *OneMeasurementHdrHistogram) Measure(latency int64) {
 	self.MeasureLock.Lock()
 	defer self.MeasureLock.Unlock()
 
 	self.histogram.RecordValue(latency)
+	if self.intervalHistogram != nil {
+		self.intervalHistogram.RecordValue(latency)
+	}
+}
+
+// Log the histogram of the interval since the last one, and start
+// a new interval.
+func (self *OneMeasurementHdrHistogram) logInterval() error {
+	self.MeasureLock.Lock()
+	defer self.MeasureLock.Unlock()
+	return self.writeInterval()
+}
+
+// Write the histogram of the interval since the last one, if it's logged,
+// and start a new interval. It's called with MeasureLock held, so that
+// the log is never written after it's closed.
+func (self *OneMeasurementHdrHistogram) writeInterval() error {
+	if self.writer == nil {
+		return nil
+	}
+	h := self.intervalHistogram
+	startTime := self.intervalStartTime
+	endTime := NowMS()
+	self.intervalHistogram = hdrhistogram.New(h.LowestTrackableValue(), h.HighestTrackableValue(), int(h.SignificantFigures()))
+	self.intervalStartTime = endTime
+	return self.writer.OutputIntervalHistogram(startTime, endTime, h)
 }
 
 // This is called periodically from the status goroutine. There's a single
 // status goroutine per client process. We optionally serialize the interval to
 // log on this oppertunity.
 func (self *OneMeasurementHdrHistogram) GetSummary() string {
-	if self.writer != nil {
-		self.writer.OutputHistogram(self.histogram)
+	if err := self.logInterval(); err != nil {
+		EPrintf("fail to log histogram interval of %s, error: %s", self.GetName(), err)
 	}
 	format := "[%s: Count=%d, Max=%d, Min=%d, Avg=%g, 90=%d, 99=%d, 99.9=%d, 99.99=%d]"
 	return fmt.Sprintf(format,
@@ -916,6 +1456,52 @@ func (self *OneMeasurementHdrHistogram) GetSummary() string {
 		self.histogram.ValueAtQuantile(99.99))
 }
 
+// Return the latency at the percentile, e.g. 99.9 for the 99.9th percentile.
+func (self *OneMeasurementHdrHistogram) ValueAtPercentile(percentile float64) int64 {
+	self.MeasureLock.Lock()
+	defer self.MeasureLock.Unlock()
+	return self.histogram.ValueAtQuantile(percentile)
+}
+
+// Return the latencies at the quantiles(in range [0, 1]), the count and
+// the sum of all the latencies so far.
+func (self *OneMeasurementHdrHistogram) latencyQuantiles(quantiles []float64) ([]int64, int64, float64) {
+	self.MeasureLock.Lock()
+	defer self.MeasureLock.Unlock()
+	values := make([]int64, 0, len(quantiles))
+	for _, q := range quantiles {
+		values = append(values, self.histogram.ValueAtQuantile(q*100))
+	}
+	count := self.histogram.TotalCount()
+	return values, count, self.histogram.Mean() * float64(count)
+}
+
+func (self *OneMeasurementHdrHistogram) Snapshot() *MeasurementSnapshot {
+	self.MeasureLock.Lock()
+	histogram := self.histogram.Export()
+	self.MeasureLock.Unlock()
+	return &MeasurementSnapshot{
+		Histogram:   histogram,
+		ReturnCodes: self.GetReturnCodes(),
+	}
+}
+
+// Merge the snapshot into this measurement. The values out of the range of
+// this histogram are dropped.
+func (self *OneMeasurementHdrHistogram) Merge(snapshot *MeasurementSnapshot) {
+	if snapshot.Histogram != nil {
+		h := hdrhistogram.Import(snapshot.Histogram)
+		self.MeasureLock.Lock()
+		self.histogram.Merge(h)
+		self.MeasureLock.Unlock()
+	}
+	self.ReturnCodesLock.Lock()
+	defer self.ReturnCodesLock.Unlock()
+	for status, count := range snapshot.ReturnCodes {
+		self.ReturnCodes[status] += count
+	}
+}
+
 var (
 	Suffixes = []string{"th", "st", "nd", "rd", "th", "th", "th", "th", "th", "th"}
 )
@@ -929,14 +1515,28 @@ func ordinal(p int64) string {
 	}
 }
 
+// Log the last interval and close the log file, if any. It's safe to be
+// called more than once.
+func (self *OneMeasurementHdrHistogram) close() (err error) {
+	self.MeasureLock.Lock()
+	defer self.MeasureLock.Unlock()
+	if self.writer == nil {
+		return nil
+	}
+	err = self.writeInterval()
+	self.writer = nil
+	self.intervalHistogram = nil
+	if err2 := self.file.Close(); err == nil {
+		err = err2
+	}
+	return
+}
+
 // This is called from a main thread, on orderly termination.
 func (self *OneMeasurementHdrHistogram) ExportMeasurements(exporter MeasurementExporter) (err error) {
 	defer catch(&err)
 
-	if self.writer != nil {
-		self.writer.OutputHistogram(self.histogram)
-		self.file.Close()
-	}
+	try(self.close())
 	name := self.GetName()
 	try(exporter.Write(name, "Operations", self.histogram.TotalCount()))
 	try(exporter.Write(name, "AverageLatency(us)", self.histogram.Mean()))
@@ -978,6 +1578,26 @@ func (self *TwoInOneMeasurement) GetSummary() string {
 	return self.thing1.GetSummary() + "\n" + self.thing2.GetSummary()
 }
 
+// Delegates to the first measurement instance, if it supports the quantiles.
+func (self *TwoInOneMeasurement) latencyQuantiles(quantiles []float64) ([]int64, int64, float64) {
+	if m, ok := self.thing1.(quantileMeasurement); ok {
+		return m.latencyQuantiles(quantiles)
+	}
+	return nil, 0, 0
+}
+
+// Close both the measurement instances.
+func (self *TwoInOneMeasurement) close() (err error) {
+	for _, m := range []OneMeasurement{self.thing1, self.thing2} {
+		if c, ok := m.(closableMeasurement); ok {
+			if err2 := c.close(); err == nil {
+				err = err2
+			}
+		}
+	}
+	return
+}
+
 // This is called from a main goroutine, on orderly termination.
 func (self *TwoInOneMeasurement) ExportMeasurements(exporter MeasurementExporter) (err error) {
 	defer catch(&err)
@@ -0,0 +1,163 @@
+package yabf
+
+import (
+	"github.com/hhkbp2/testify/require"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type nopWriteCloser struct {
+	*strings.Builder
+}
+
+func (self nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestCSVMeasurementExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "measurement")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "result.csv")
+	props := NewProperties()
+	props.Add(PropertyWorkload, "CoreWorkload")
+	props.Add(PropertyDB, "basic")
+	// the header is only written into the empty file
+	for _, label := range []string{"run1", "run,2"} {
+		f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		require.Nil(t, err)
+		exporter := NewCSVMeasurementExporter(f, props, label)
+		require.Nil(t, exporter.Write("OVERALL", "Throughput(ops/sec)", 1000.5))
+		require.Nil(t, exporter.Write("READ", "Return=OK", uint32(10)))
+		require.Nil(t, exporter.Close())
+	}
+	data, err := ioutil.ReadFile(fileName)
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Equal(t, 5, len(lines))
+	require.Equal(t, "timestamp,label,workload,db,metric,measurement,value", lines[0])
+	fields := strings.SplitN(lines[1], ",", 2)
+	require.Equal(t, "run1,CoreWorkload,basic,OVERALL,Throughput(ops/sec),1000.5", fields[1])
+	fields = strings.SplitN(lines[4], ",", 2)
+	require.Equal(t, `"run,2",CoreWorkload,basic,READ,Return=OK,10`, fields[1])
+}
+
+func TestLineProtocolMeasurementExporter(t *testing.T) {
+	var buf strings.Builder
+	props := NewProperties()
+	props.Add(PropertyWorkload, "CoreWorkload")
+	exporter := NewLineProtocolMeasurementExporter(nopWriteCloser{&buf}, props, "my run")
+	require.Nil(t, exporter.Write("OVERALL", "RunTime(ms)", int64(1000)))
+	require.Nil(t, exporter.Write("OVERALL", "Throughput(ops/sec)", 1000.5))
+	require.Nil(t, exporter.Write("OVERALL", "Ratio", math.Inf(1)))
+	require.Nil(t, exporter.Write("READ", "Operations", int64(10)))
+	require.Nil(t, exporter.Write("READ", "Return=OK", uint32(10)))
+	require.Nil(t, exporter.Close())
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, 2, len(lines))
+	timestamp := lines[0][strings.LastIndex(lines[0], " ")+1:]
+	require.Equal(t, `yabf,operation=OVERALL,label=my\ run,workload=CoreWorkload RunTime(ms)=1000i,Throughput(ops/sec)=1000.5 `+timestamp, lines[0])
+	require.Equal(t, `yabf,operation=READ,label=my\ run,workload=CoreWorkload Operations=10i,Return\=OK=10i `+timestamp, lines[1])
+}
+
+func TestWarmupHdrHistogramLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "warmup")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	resetMemoryTables()
+	defer func() {
+		SetMeasurementProperties(NewProperties())
+		ResetMeasurements()
+	}()
+	props := NewProperties()
+	props.Add(PropertyWorkload, "CoreWorkload")
+	props.Add(PropertyDB, "faulty")
+	props.Add(PropertyFaultyDB, "memory")
+	props.Add(PropertyFaultyLatency, "constant:1000")
+	props.Add(PropertyRecordCount, "0")
+	props.Add(PropertyOperationCount, "200")
+	props.Add(PropertyReadProportion, "0")
+	props.Add(PropertyUpdateProportion, "0")
+	props.Add(PropertyInsertProportion, "1")
+	props.Add(PropertyWarmupOperations, "50")
+	props.Add(PropertyHdrHistogramOutput, "true")
+	props.Add(PropertyHdrHistogramOutputPath, dir+"/")
+	ResetMeasurements()
+	NewRunner(&Arguemnts{Command: "run", Properties: props}).Run(props)
+	require.True(t, GetMeasurements().Lookup("INSERT").(*OneMeasurementHdrHistogram).histogram.TotalCount() < 200)
+
+	// the log is continued after the warm-up instead of being truncated,
+	// and no log file is left open
+	ResetMeasurements()
+	count := countOpenFiles(dir)
+	require.True(t, count <= 0, count)
+	f, err := os.Open(filepath.Join(dir, "INSERT.hdr"))
+	require.Nil(t, err)
+	defer f.Close()
+	reader := NewHdrHistogramLogReader(f)
+	total := int64(0)
+	for {
+		h, err := reader.NextHistogram()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		total += h.TotalCount()
+	}
+	require.Equal(t, int64(200), total)
+}
+
+func TestSharedHdrHistogramLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdr")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "all.hdr")
+	props := NewProperties()
+	props.Add(PropertyHdrHistogramOutput, "true")
+	props.Add(PropertyHdrHistogramOutputFile, fileName)
+	counts := map[string]int64{"READ": 3, "UPDATE": 2}
+	measurements := make(map[string]*OneMeasurementHdrHistogram)
+	for op := range counts {
+		m, err := NewOneMeasurementHdrHistogram(op, props)
+		require.Nil(t, err)
+		measurements[op] = m
+	}
+	for op, m := range measurements {
+		for i := int64(0); i < counts[op]; i++ {
+			m.Measure(100)
+		}
+		require.Nil(t, m.logInterval())
+		m.Measure(100)
+		counts[op]++
+	}
+	for _, m := range measurements {
+		require.Nil(t, m.close())
+	}
+	// the operations opened later continue the log
+	m, err := NewOneMeasurementHdrHistogram("INSERT", props)
+	require.Nil(t, err)
+	m.Measure(100)
+	require.Nil(t, m.close())
+	counts["INSERT"] = 1
+
+	// the operations share one log, in which their intervals are tagged
+	f, err := os.Open(fileName)
+	require.Nil(t, err)
+	defer f.Close()
+	reader := NewHdrHistogramLogReader(f)
+	logged := make(map[string]int64)
+	for {
+		interval, err := reader.NextIntervalHistogram()
+		if err == io.EOF {
+			break
+		}
+		require.Nil(t, err)
+		logged[interval.Tag] += interval.Histogram.TotalCount()
+	}
+	require.Equal(t, counts, logged)
+}
@@ -0,0 +1,290 @@
+package yabf
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	memoryTableMaxLevel = 32
+)
+
+// A record of a memoryTable, which is a node of its skip list.
+type memoryNode struct {
+	key    string
+	record KVMap
+	next   []*memoryNode
+}
+
+// A table of MemoryDB, which keeps the records ordered by key in a skip list.
+// The reads share the table while the writes hold it exclusively.
+type memoryTable struct {
+	lock   sync.RWMutex
+	head   *memoryNode
+	level  int
+	length int64
+	// the random source to choose the levels of new nodes, which is
+	// guarded by the write lock
+	random *rand.Rand
+}
+
+func newMemoryTable() *memoryTable {
+	return &memoryTable{
+		head: &memoryNode{
+			next: make([]*memoryNode, memoryTableMaxLevel),
+		},
+		level:  1,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (self *memoryTable) randomLevel() int {
+	level := 1
+	for (level < memoryTableMaxLevel) && (self.random.Int63()&3 == 0) {
+		level++
+	}
+	return level
+}
+
+// Return the first node whose key is not less than key, and fill prev with
+// the last nodes before it on every level if prev is not nil.
+func (self *memoryTable) seek(key string, prev []*memoryNode) *memoryNode {
+	node := self.head
+	for i := self.level - 1; i >= 0; i-- {
+		for (node.next[i] != nil) && (node.next[i].key < key) {
+			node = node.next[i]
+		}
+		if prev != nil {
+			prev[i] = node
+		}
+	}
+	return node.next[0]
+}
+
+// Return the node of key, or nil if there is no such record.
+func (self *memoryTable) find(key string) *memoryNode {
+	node := self.seek(key, nil)
+	if (node == nil) || (node.key != key) {
+		return nil
+	}
+	return node
+}
+
+// Add the record of key, which should not be in the table yet.
+func (self *memoryTable) add(key string, record KVMap) bool {
+	prev := make([]*memoryNode, memoryTableMaxLevel)
+	node := self.seek(key, prev)
+	if (node != nil) && (node.key == key) {
+		return false
+	}
+	level := self.randomLevel()
+	for i := self.level; i < level; i++ {
+		prev[i] = self.head
+	}
+	if level > self.level {
+		self.level = level
+	}
+	node = &memoryNode{
+		key:    key,
+		record: record,
+		next:   make([]*memoryNode, level),
+	}
+	for i := 0; i < level; i++ {
+		node.next[i] = prev[i].next[i]
+		prev[i].next[i] = node
+	}
+	self.length++
+	return true
+}
+
+// Remove the record of key.
+func (self *memoryTable) remove(key string) bool {
+	prev := make([]*memoryNode, memoryTableMaxLevel)
+	node := self.seek(key, prev)
+	if (node == nil) || (node.key != key) {
+		return false
+	}
+	for i := 0; i < len(node.next); i++ {
+		prev[i].next[i] = node.next[i]
+	}
+	for (self.level > 1) && (self.head.next[self.level-1] == nil) {
+		self.level--
+	}
+	self.length--
+	return true
+}
+
+// The tables of all the MemoryDB instances in this process, so that all
+// the client routines, and all the phases of a plan, work on the same data.
+var (
+	memoryTables     = make(map[string]*memoryTable)
+	memoryTablesLock sync.Mutex
+)
+
+// Return the table of name, which is created on first use.
+func getMemoryTable(name string) *memoryTable {
+	memoryTablesLock.Lock()
+	defer memoryTablesLock.Unlock()
+	table, ok := memoryTables[name]
+	if !ok {
+		table = newMemoryTable()
+		memoryTables[name] = table
+	}
+	return table
+}
+
+// Drop all the tables of MemoryDB.
+func resetMemoryTables() {
+	memoryTablesLock.Lock()
+	defer memoryTablesLock.Unlock()
+	memoryTables = make(map[string]*memoryTable)
+}
+
+// Return a copy of the fields of record, or all of them if fields is empty.
+// The values are copied so that the stored records are never shared
+// with the callers.
+func copyFields(record KVMap, fields []string) KVMap {
+	ret := make(KVMap, len(record))
+	if len(fields) == 0 {
+		for k, v := range record {
+			ret[k] = append(Binary(nil), v...)
+		}
+		return ret
+	}
+	for _, k := range fields {
+		if v, ok := record[k]; ok {
+			ret[k] = append(Binary(nil), v...)
+		}
+	}
+	return ret
+}
+
+// A DB implementation which keeps the records in memory, in the ordered
+// tables shared by all its instances in this process. Unlike BasicDB, it
+// does the operations for real: the records written are read back, and
+// the missing ones are reported NOT_FOUND, so the workloads and their
+// verification could be tested without a database server.
+// Inserting a record which exists already fails with ERROR as the
+// primary key of a SQL table does.
+type MemoryDB struct {
+	*DBBase
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		DBBase: NewDBBase(),
+	}
+}
+
+func (self *MemoryDB) Init() error {
+	// do nothing
+	return nil
+}
+
+func (self *MemoryDB) Cleanup() error {
+	// keep the records for the following phases
+	return nil
+}
+
+// Read a record from the database.
+func (self *MemoryDB) Read(table string, key string, fields []string) (KVMap, StatusType) {
+	t := getMemoryTable(table)
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	node := t.find(key)
+	if node == nil {
+		return nil, StatusNotFound
+	}
+	return copyFields(node.record, fields), StatusOK
+}
+
+// Perform a range scan for a set of records in the database.
+func (self *MemoryDB) Scan(table string, startKey string, recordCount int64, fields []string) ([]KVMap, StatusType) {
+	if recordCount < 0 {
+		return nil, StatusBadRequest
+	}
+	t := getMemoryTable(table)
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	ret := make([]KVMap, 0, recordCount)
+	for node := t.seek(startKey, nil); (node != nil) && (int64(len(ret)) < recordCount); node = node.next[0] {
+		ret = append(ret, copyFields(node.record, fields))
+	}
+	return ret, StatusOK
+}
+
+// Update a record in the database.
+func (self *MemoryDB) Update(table string, key string, values KVMap) StatusType {
+	t := getMemoryTable(table)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	node := t.find(key)
+	if node == nil {
+		return StatusNotFound
+	}
+	for k, v := range values {
+		node.record[k] = append(Binary(nil), v...)
+	}
+	return StatusOK
+}
+
+// Insert a record in the database.
+func (self *MemoryDB) Insert(table string, key string, values KVMap) StatusType {
+	t := getMemoryTable(table)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.add(key, copyFields(values, nil)) {
+		return StatusError
+	}
+	return StatusOK
+}
+
+// Delete a record from the database.
+func (self *MemoryDB) Delete(table string, key string) StatusType {
+	t := getMemoryTable(table)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if !t.remove(key) {
+		return StatusNotFound
+	}
+	return StatusOK
+}
+
+// Insert a batch of records in the database. None of them is inserted
+// if any of them exists already.
+func (self *MemoryDB) BatchInsert(table string, keys []string, values []KVMap) StatusType {
+	if len(keys) != len(values) {
+		return StatusBadRequest
+	}
+	t := getMemoryTable(table)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if seen[key] || (t.find(key) != nil) {
+			return StatusError
+		}
+		seen[key] = true
+	}
+	for i, key := range keys {
+		t.add(key, copyFields(values[i], nil))
+	}
+	return StatusOK
+}
+
+// Read a batch of records from the database.
+func (self *MemoryDB) MultiRead(table string, keys []string, fields []string) ([]KVMap, StatusType) {
+	t := getMemoryTable(table)
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	ret := make([]KVMap, 0, len(keys))
+	for _, key := range keys {
+		var record KVMap
+		if node := t.find(key); node != nil {
+			record = copyFields(node.record, fields)
+		}
+		ret = append(ret, record)
+	}
+	return ret, StatusOK
+}
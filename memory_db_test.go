@@ -0,0 +1,108 @@
+package yabf
+
+import (
+	"fmt"
+	"github.com/hhkbp2/testify/require"
+	"sync"
+	"testing"
+)
+
+// The operations common to all the bindings are checked in
+// the binding package.
+func TestMemoryDB(t *testing.T) {
+	resetMemoryTables()
+	db := NewMemoryDB()
+	require.Nil(t, db.Init())
+	defer db.Cleanup()
+
+	_, status := db.Read("t", "k1", nil)
+	require.Equal(t, StatusNotFound, status)
+	require.Equal(t, StatusNotFound, db.Update("t", "k1", KVMap{"f0": Binary("v")}))
+	require.Equal(t, StatusNotFound, db.Delete("t", "k1"))
+
+	values := KVMap{"f0": Binary("a"), "f1": Binary("b")}
+	require.Equal(t, StatusOK, db.Insert("t", "k1", values))
+	// the stored record is not shared with the caller
+	values["f0"][0] = 'x'
+	ret, status := db.Read("t", "k1", nil)
+	require.Equal(t, StatusOK, status)
+	require.Equal(t, KVMap{"f0": Binary("a"), "f1": Binary("b")}, ret)
+	ret, status = db.Read("t", "k1", []string{"f1", "f2"})
+	require.Equal(t, StatusOK, status)
+	require.Equal(t, KVMap{"f1": Binary("b")}, ret)
+	// the tables are separated
+	_, status = db.Read("other", "k1", nil)
+	require.Equal(t, StatusNotFound, status)
+
+	// the records are shared by all the instances
+	other := NewMemoryDB()
+	require.Equal(t, StatusOK, other.BatchInsert("t", []string{"k3", "k0", "k2"},
+		[]KVMap{{"f0": Binary("3")}, {"f0": Binary("0")}, {"f0": Binary("2")}}))
+	rets, status := db.Scan("t", "k", 10, []string{"f0"})
+	require.Equal(t, StatusOK, status)
+	require.Equal(t, 4, len(rets))
+	require.Equal(t, Binary("0"), rets[0]["f0"])
+	require.Equal(t, StatusOK, other.Delete("t", "k1"))
+	require.Equal(t, StatusNotFound, db.Delete("t", "k1"))
+	rets, _ = db.Scan("t", "k1", 10, nil)
+	require.Equal(t, 2, len(rets))
+	require.Equal(t, Binary("2"), rets[0]["f0"])
+}
+
+func TestMemoryDBConcurrency(t *testing.T) {
+	resetMemoryTables()
+	var group sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		group.Add(1)
+		go func(i int) {
+			defer group.Done()
+			db := NewMemoryDB()
+			for j := 0; j < 200; j++ {
+				key := fmt.Sprintf("k%05d", j*8+i)
+				require.Equal(t, StatusOK, db.Insert("t", key, KVMap{"f0": Binary(key)}))
+				ret, status := db.Read("t", key, nil)
+				require.Equal(t, StatusOK, status)
+				require.Equal(t, Binary(key), ret["f0"])
+				db.Scan("t", key, 10, nil)
+			}
+		}(i)
+	}
+	group.Wait()
+	rets, status := NewMemoryDB().Scan("t", "", 2000, nil)
+	require.Equal(t, StatusOK, status)
+	require.Equal(t, 1600, len(rets))
+	for i, ret := range rets {
+		require.Equal(t, Binary(fmt.Sprintf("k%05d", i)), ret["f0"])
+	}
+}
+
+// Load the records with CoreWorkload and verify them in the transactions.
+func TestMemoryDBDataIntegrity(t *testing.T) {
+	resetMemoryTables()
+	ResetMeasurements()
+	defer ResetMeasurements()
+	props := NewProperties()
+	props.Add(PropertyRecordCount, "100")
+	props.Add(PropertyReadProportion, "0.5")
+	props.Add(PropertyUpdateProportion, "0")
+	props.Add(PropertyReadModifyWriteProportion, "0.3")
+	props.Add(PropertyScanProportion, "0.2")
+	props.Add(PropertyDataIntegrity, "true")
+	props.Add(PropertySeed, "42")
+	workload := NewCoreWorkload()
+	require.Nil(t, workload.Init(props))
+	random, err := NewRandomStream(props, 0)
+	require.Nil(t, err)
+	state, err := workload.InitRoutine(props, random)
+	require.Nil(t, err)
+	db := NewMemoryDB()
+	for i := 0; i < 100; i++ {
+		require.True(t, workload.DoInsert(db, state))
+	}
+	for i := 0; i < 500; i++ {
+		require.True(t, workload.DoTransaction(db, state))
+	}
+	codes := GetMeasurements().Lookup("VERIFY").GetReturnCodes()
+	require.Equal(t, 1, len(codes))
+	require.True(t, codes[StatusOK] > 0)
+}
@@ -0,0 +1,264 @@
+package yabf
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// A routine which issues operations in open loop.
+// Unlike Worker, it doesn't wait for an operation to complete before
+// issuing the next one. The operations arrive at the rate of the target
+// schedule, with constant or exponential(poisson process) inter-arrival
+// times, and each of them is handed to an idle executor routine. The executors
+// are spawned lazily up to the in-flight cap, every one with its own DB
+// instance, which is initialized off the dispatching. The concurrency is
+// bounded by the cap "openloop.maxinflight" rather than "threadcount",
+// which is ignored in open loop mode.
+// An operation which arrives when all the executors are busy and the cap
+// is reached is dropped, and an operation which starts later than its
+// arrival time by more than a threshold is late. Both are counted under
+// the label "OPEN-LOOP".
+type OpenLoopDispatcher struct {
+	ctx            context.Context
+	dbName         string
+	workload       Workload
+	props          Properties
+	doTransactions bool
+	opCount        int64
+	schedule       TargetSchedule
+	// the generator of inter-arrival times at 1 op/sec, nil for
+	// constant ones
+	arrivalGenerator *g.ExponentialGenerator
+	random           *rand.Rand
+	maxInFlight      int64
+	lateThresholdNS  int64
+	requests         chan int64
+	// the number of executors alive or being initialized
+	executorCount int64
+	// the number of executors ever spawned, which numbers their random
+	// streams
+	executorSpawned int64
+	executorGroup   *sync.WaitGroup
+	opIssued        int64
+	opDone          int64
+	inFlight        int64
+	failed          int32
+	stopCh          chan int
+	resultCh        chan int64
+	measurements    Measurements
+}
+
+func NewOpenLoopDispatcher(ctx context.Context, dbName string, workload Workload, props Properties, doTransactions bool, opCount int64, schedule TargetSchedule, stopCh chan int, resultCh chan int64) (*OpenLoopDispatcher, error) {
+	if schedule == nil {
+		return nil, g.NewErrorf("%s or %s should be set in open loop mode", PropertyTarget, PropertyTargetSchedule)
+	}
+	var arrivalGenerator *g.ExponentialGenerator
+	propStr := props.GetDefault(PropertyArrivalDistribution, PropertyArrivalDistributionDefault)
+	switch propStr {
+	case "constant":
+	case "poisson":
+		arrivalGenerator = g.NewExponentialGeneratorByMean(float64(SecondToNanosecond(1)))
+	default:
+		return nil, g.NewErrorf("unknown %s=%s", PropertyArrivalDistribution, propStr)
+	}
+	if _, ok := props[PropertyThreadCount]; ok {
+		Warnf("%s is ignored in open loop mode, use %s to bound the concurrency",
+			PropertyThreadCount, PropertyOpenLoopMaxInFlight)
+	}
+	propStr = props.GetDefault(PropertyOpenLoopMaxInFlight, PropertyOpenLoopMaxInFlightDefault)
+	maxInFlight, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return nil, err
+	}
+	if maxInFlight <= 0 {
+		return nil, g.NewErrorf("invalid %s=%d, should be positive", PropertyOpenLoopMaxInFlight, maxInFlight)
+	}
+	propStr = props.GetDefault(PropertyOpenLoopLateThreshold, PropertyOpenLoopLateThresholdDefault)
+	lateThreshold, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return nil, err
+	}
+	// the arrivals are drawn from the first stream, and the executors
+	// from the following ones in the order they're spawned
+	random, err := NewRandomStream(props, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &OpenLoopDispatcher{
+		ctx:              ctx,
+		dbName:           dbName,
+		workload:         workload,
+		props:            props,
+		doTransactions:   doTransactions,
+		opCount:          opCount,
+		schedule:         schedule,
+		arrivalGenerator: arrivalGenerator,
+		random:           random,
+		maxInFlight:      maxInFlight,
+		lateThresholdNS:  MillisecondToNanosecond(lateThreshold),
+		requests:         make(chan int64),
+		executorGroup:    &sync.WaitGroup{},
+		stopCh:           stopCh,
+		resultCh:         resultCh,
+		measurements:     GetMeasurements(),
+	}, nil
+}
+
+func (self *OpenLoopDispatcher) run() {
+	defer func() {
+		self.resultCh <- atomic.LoadInt64(&self.opDone)
+	}()
+
+	startTime := NowNS()
+	arrival := startTime
+DISPATCHER_LOOP:
+	for (self.opCount == 0) || (self.getOpsIssued() < self.opCount) {
+		select {
+		case <-self.stopCh:
+			break DISPATCHER_LOOP
+		case <-self.ctx.Done():
+			break DISPATCHER_LOOP
+		default:
+			if atomic.LoadInt32(&self.failed) != 0 {
+				break DISPATCHER_LOOP
+			}
+			waitUtil(arrival)
+			self.dispatch(arrival)
+			atomic.AddInt64(&self.opIssued, 1)
+			arrival = startTime + self.nextArrival(arrival-startTime)
+		}
+	}
+	// let all the executors finish the operations in flight and exit
+	close(self.requests)
+	self.executorGroup.Wait()
+}
+
+// Return the arrival time of the operation following the one at elapsed,
+// both in nanoseconds since the start.
+func (self *OpenLoopDispatcher) nextArrival(elapsed int64) int64 {
+	if self.arrivalGenerator == nil {
+		return NextScheduledTime(self.schedule, elapsed, ConstantInterval)
+	}
+	return NextScheduledTime(self.schedule, elapsed, func(target float64) int64 {
+		return int64(float64(self.arrivalGenerator.NextIntFrom(self.random)) / target)
+	})
+}
+
+// Hand the operation which arrives at the specified time to an idle
+// executor, or a new one if there is none.
+func (self *OpenLoopDispatcher) dispatch(arrival int64) {
+	select {
+	case self.requests <- arrival:
+		return
+	default:
+	}
+	if atomic.LoadInt64(&self.executorCount) >= self.maxInFlight {
+		self.measurements.Count("OPEN-LOOP", "Dropped", 1)
+		return
+	}
+	self.spawnExecutor(arrival)
+}
+
+// Spawn an executor for the operation which arrives at the specified time.
+// The executor is initialized in its own routine, so that the dispatcher
+// is never held up by the initialization of the DB.
+func (self *OpenLoopDispatcher) spawnExecutor(arrival int64) {
+	atomic.AddInt64(&self.executorCount, 1)
+	self.executorSpawned++
+	self.executorGroup.Add(1)
+	go self.execute(self.executorSpawned, arrival)
+}
+
+// Initialize the DB and the workload state of the executor, the random
+// numbers of which are drawn from the specified stream.
+func (self *OpenLoopDispatcher) initExecutor(stream int64) (*DBWrapper, interface{}, error) {
+	random, err := NewRandomStream(self.props, stream)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := NewDBWithContext(self.ctx, self.dbName, self.props)
+	if err != nil {
+		return nil, nil, err
+	}
+	db.SetRandom(newChildRandom(random))
+	if err = db.Init(); err != nil {
+		return nil, nil, err
+	}
+	workloadState, err := self.workload.InitRoutine(self.props, random)
+	if err != nil {
+		db.Cleanup()
+		return nil, nil, err
+	}
+	return db, workloadState, nil
+}
+
+// Run the operation arriving at the specified time, and then the ones
+// handed by the dispatcher one by one, until there is no more operation.
+func (self *OpenLoopDispatcher) execute(stream int64, arrival int64) {
+	defer self.executorGroup.Done()
+	db, workloadState, err := self.initExecutor(stream)
+	if err != nil {
+		EPrintf("open loop dispatcher fail to spawn executor, error: %s", err)
+		self.measurements.Count("OPEN-LOOP", "Dropped", 1)
+		atomic.AddInt64(&self.executorCount, -1)
+		return
+	}
+	self.do(db, workloadState, arrival)
+	for arrival := range self.requests {
+		self.do(db, workloadState, arrival)
+	}
+	if err := db.Cleanup(); err != nil {
+		EPrintf("cleanup database error: %s", err)
+	}
+}
+
+// Do the operation which arrives at the specified time.
+func (self *OpenLoopDispatcher) do(db *DBWrapper, workloadState interface{}, arrival int64) {
+	if NowNS()-arrival > self.lateThresholdNS {
+		self.measurements.Count("OPEN-LOOP", "Late", 1)
+	}
+	// the latencies of operations are measured from their arrival
+	// times if the coordinated omission is corrected.
+	db.SetIntendedStartTime(arrival)
+	atomic.AddInt64(&self.inFlight, 1)
+	var ok bool
+	if self.doTransactions {
+		ok = self.workload.DoTransaction(db, workloadState)
+	} else {
+		ok = self.workload.DoInsert(db, workloadState)
+	}
+	atomic.AddInt64(&self.inFlight, -1)
+	if !ok {
+		atomic.StoreInt32(&self.failed, 1)
+		return
+	}
+	atomic.AddInt64(&self.opDone, 1)
+}
+
+func (self *OpenLoopDispatcher) getOpsIssued() int64 {
+	return atomic.LoadInt64(&self.opIssued)
+}
+
+// the total amount of operations completed.
+func (self *OpenLoopDispatcher) getOpsDone() int64 {
+	return atomic.LoadInt64(&self.opDone)
+}
+
+// the operations left to issue.
+func (self *OpenLoopDispatcher) getOpsTodo() int64 {
+	todo := self.opCount - self.getOpsIssued()
+	if todo < 0 {
+		return 0
+	}
+	return todo
+}
+
+// the operations in progress in the executors.
+func (self *OpenLoopDispatcher) getInFlight() int64 {
+	return atomic.LoadInt64(&self.inFlight)
+}
@@ -0,0 +1,69 @@
+package yabf
+
+import (
+	"context"
+	"github.com/hhkbp2/testify/require"
+	"testing"
+	"time"
+)
+
+// A MemoryDB which takes a while to initialize and insert.
+type slowInitDB struct {
+	*MemoryDB
+}
+
+func (self *slowInitDB) Init() error {
+	time.Sleep(100 * time.Millisecond)
+	return nil
+}
+
+func (self *slowInitDB) Insert(table string, key string, values KVMap) StatusType {
+	time.Sleep(20 * time.Millisecond)
+	return self.MemoryDB.Insert(table, key, values)
+}
+
+// Dispatch 20 inserts at 1000 ops/sec to the executors, and return
+// the operations done and how long the dispatching takes.
+func runOpenLoop(t *testing.T, maxInFlight string) (int64, time.Duration) {
+	resetMemoryTables()
+	Databases["slowinit"] = func() DB {
+		return &slowInitDB{MemoryDB: NewMemoryDB()}
+	}
+	defer delete(Databases, "slowinit")
+	props := NewProperties()
+	props.Add(PropertyRecordCount, "20")
+	props.Add(PropertyOpenLoopMaxInFlight, maxInFlight)
+	workload := NewCoreWorkload()
+	require.Nil(t, workload.Init(props))
+	resultCh := make(chan int64, 1)
+	dispatcher, err := NewOpenLoopDispatcher(context.Background(), "slowinit", workload, props, false, 20,
+		NewConstantTargetSchedule(1000), make(chan int, 1), resultCh)
+	require.Nil(t, err)
+	startTime := time.Now()
+	go dispatcher.run()
+	for dispatcher.getOpsTodo() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	elapsed := time.Since(startTime)
+	return <-resultCh, elapsed
+}
+
+func TestOpenLoopDispatcher(t *testing.T) {
+	ResetMeasurements()
+	defer ResetMeasurements()
+	// the dispatching goes on at the target rate while the executors
+	// are initialized, all of which start late
+	done, elapsed := runOpenLoop(t, "100")
+	require.Equal(t, int64(20), done)
+	require.True(t, elapsed < 100*time.Millisecond, elapsed)
+	measurements := GetMeasurements()
+	require.Equal(t, int64(0), measurements.GetCount("OPEN-LOOP", "Dropped"))
+	require.True(t, measurements.GetCount("OPEN-LOOP", "Late") > 0)
+
+	// the operations arriving while all the executors are busy are dropped
+	ResetMeasurements()
+	done, _ = runOpenLoop(t, "2")
+	dropped := GetMeasurements().GetCount("OPEN-LOOP", "Dropped")
+	require.True(t, dropped > 0)
+	require.Equal(t, int64(20), done+dropped)
+}
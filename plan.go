@@ -0,0 +1,231 @@
+package yabf
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// The key in a phase section of plan file, which specifies the command
+// of the phase, "load" or "run".
+const PlanPhaseCommand = "command"
+
+var (
+	regexPlanSection *regexp.Regexp
+)
+
+func init() {
+	regexPlanSection = regexp.MustCompile(`^\s*\[\s*([^\]\s]+)\s*\]\s*$`)
+}
+
+// One phase of a benchmark plan.
+type PlanPhase struct {
+	Name    string
+	Command string
+	// the properties of this phase, which override the ones of the plan,
+	// but not the ones specified by -p on the command line
+	Properties Properties
+}
+
+// A benchmark plan, which consists of the phases to run in order.
+type Plan struct {
+	// the properties shared by all the phases
+	Properties Properties
+	Phases     []*PlanPhase
+}
+
+// Load the plan from a file, e.g.
+//
+//	# the properties before any phase are shared by all the phases
+//	workload=CoreWorkload
+//	recordcount=100000
+//
+//	[load]
+//	command=load
+//	threadcount=16
+//
+//	[run-a]
+//	command=run
+//	threadcount=64
+//	target=10000
+//	maxexecutiontime=300
+//	readproportion=0.5
+//	updateproportion=0.5
+//
+// The phase name is in brackets, followed by the properties of the phase,
+// e.g. its thread count, target and duration. The command of a phase is
+// "run" if it's not specified.
+func LoadPlan(fileName string) (*Plan, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	plan := &Plan{
+		Properties: NewProperties(),
+		Phases:     make([]*PlanPhase, 0),
+	}
+	names := make(map[string]bool)
+	props := plan.Properties
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if parts := regexPlanSection.FindStringSubmatch(line); parts != nil {
+			name := parts[1]
+			if names[name] {
+				return nil, g.NewErrorf("duplicate phase %s in plan file: %s", name, fileName)
+			}
+			names[name] = true
+			phase := &PlanPhase{
+				Name:       name,
+				Properties: NewProperties(),
+			}
+			plan.Phases = append(plan.Phases, phase)
+			props = phase.Properties
+			continue
+		}
+		key, value, ignorable, ok := parsePropertyLine(line)
+		if ignorable {
+			continue
+		}
+		if !ok {
+			return nil, g.NewErrorf("invalid plan file: %s, line: %s", fileName, line)
+		}
+		props.Add(key, value)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(plan.Phases) == 0 {
+		return nil, g.NewErrorf("no phase in plan file: %s", fileName)
+	}
+	for _, phase := range plan.Phases {
+		phase.Command = phase.Properties.GetDefault(PlanPhaseCommand, "run")
+		delete(phase.Properties, PlanPhaseCommand)
+		if (phase.Command != "load") && (phase.Command != "run") {
+			return nil, g.NewErrorf("invalid command %s of phase %s, should be load or run", phase.Command, phase.Name)
+		}
+	}
+	return plan, nil
+}
+
+// A client which runs the phases of a plan one after another, and
+// exports the measurements of every phase labelled by its name.
+type PlanRunner struct {
+	args *Arguemnts
+}
+
+func NewPlanRunner(args *Arguemnts) *PlanRunner {
+	return &PlanRunner{
+		args: args,
+	}
+}
+
+func (self *PlanRunner) Main() {
+	fileName, ok := self.args.Properties[PropertyPlan]
+	if !ok || (len(fileName) == 0) {
+		ExitOnError("Missing property: %s", PropertyPlan)
+	}
+	plan, err := LoadPlan(fileName)
+	if err != nil {
+		ExitOnError("fail to load plan, error: %s", err)
+	}
+	// check all the phases before running any of them
+	clients := make([]*ClientBase, 0, len(plan.Phases))
+	for _, phase := range plan.Phases {
+		client := self.newPhaseClient(plan, phase)
+		client.CheckProperties()
+		clients = append(clients, client)
+	}
+
+	if err = self.run(plan, clients); err != nil {
+		ExitOnError("%s", err)
+	}
+}
+
+// Run the phases with the clients one after another. The exporter is closed
+// even if a phase fails, so that the measurements of the finished phases
+// are kept.
+func (self *PlanRunner) run(plan *Plan, clients []*ClientBase) (err error) {
+	exporter, err := openMeasurementExporter(self.args.Properties, self.args.Options["l"])
+	if err != nil {
+		return g.NewErrorf("could not export measurements, error: %s", err)
+	}
+	defer func() {
+		if err2 := exporter.Close(); (err2 != nil) && (err == nil) {
+			err = g.NewErrorf("could not close measurement exporter, error: %s", err2)
+		}
+	}()
+	document := NewResultDocument(self.args)
+	for i, phase := range plan.Phases {
+		client := clients[i]
+		Printf("Starting phase %s(%s), %d of %d.", phase.Name, phase.Command, i+1, len(plan.Phases))
+		ResetMeasurements()
+		result, err := client.run(client.Args.Properties)
+		if err != nil {
+			return g.NewErrorf("phase %s fails, error: %s", phase.Name, err)
+		}
+		Printf("Phase %s done, %d operations in %d ms.", phase.Name, result.Operations, result.RunTime)
+		recorder := document.AddPhase(phase.Name, phase.Command, client.Args.Properties, result).Recorder(
+			newPhaseMeasurementExporter(exporter, phase.Name))
+		err = writeMeasurements(recorder, result.Operations, result.RunTime)
+		if err != nil {
+			return g.NewErrorf("could not export measurements of phase %s, error: %s", phase.Name, err)
+		}
+		// written after every phase, so that the finished ones are kept
+		// if a later phase fails
+		if err = document.Write(self.args.Properties); err != nil {
+			return g.NewErrorf("could not write result document, error: %s", err)
+		}
+	}
+	return nil
+}
+
+// Return the client to run the phase, whose properties are the ones of
+// the command line, overridden by the ones of the plan and then the phase,
+// except that the ones specified by -p override all of them.
+func (self *PlanRunner) newPhaseClient(plan *Plan, phase *PlanPhase) *ClientBase {
+	props := NewProperties().Merge(self.args.Properties).Merge(plan.Properties).Merge(phase.Properties).
+		Merge(self.args.CommandLineProperties)
+	options := make(map[string]string)
+	for k, v := range self.args.Options {
+		options[k] = v
+	}
+	if label, ok := options["l"]; ok {
+		options["l"] = label + "/" + phase.Name
+	} else {
+		options["l"] = phase.Name
+	}
+	client := NewClientBase(&Arguemnts{
+		Command:    phase.Command,
+		Database:   self.args.Database,
+		Options:    options,
+		Properties: props,
+	})
+	client.DoTransactions = (phase.Command == "run")
+	return client
+}
+
+// An exporter which labels the metrics of a phase with the phase name, e.g.
+// "load/OVERALL". It leaves the exporter open for the following phases.
+type phaseMeasurementExporter struct {
+	MeasurementExporter
+	phase string
+}
+
+func newPhaseMeasurementExporter(exporter MeasurementExporter, phase string) *phaseMeasurementExporter {
+	return &phaseMeasurementExporter{
+		MeasurementExporter: exporter,
+		phase:               phase,
+	}
+}
+
+func (self *phaseMeasurementExporter) Write(metric string, measurement string, v interface{}) error {
+	return self.MeasurementExporter.Write(self.phase+"/"+metric, measurement, v)
+}
+
+func (self *phaseMeasurementExporter) Close() error {
+	return nil
+}
@@ -0,0 +1,126 @@
+package yabf
+
+import (
+	"encoding/json"
+	"github.com/hhkbp2/testify/require"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func writeTempFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "plan")
+	require.Nil(t, err)
+	_, err = f.WriteString(content)
+	require.Nil(t, err)
+	f.Close()
+	return f.Name()
+}
+
+func TestLoadPlan(t *testing.T) {
+	fileName := writeTempFile(t, `# shared
+workload = CoreWorkload
+recordcount=100
+
+[load]
+command=load
+threadcount=4
+
+[ run-a ]
+target=1000
+maxexecutiontime=60
+`)
+	defer os.Remove(fileName)
+	plan, err := LoadPlan(fileName)
+	require.Nil(t, err)
+	require.Equal(t, Properties{"workload": "CoreWorkload", "recordcount": "100"}, plan.Properties)
+	require.Equal(t, 2, len(plan.Phases))
+	require.Equal(t, "load", plan.Phases[0].Name)
+	require.Equal(t, "load", plan.Phases[0].Command)
+	require.Equal(t, Properties{"threadcount": "4"}, plan.Phases[0].Properties)
+	require.Equal(t, "run-a", plan.Phases[1].Name)
+	require.Equal(t, "run", plan.Phases[1].Command)
+	require.Equal(t, Properties{"target": "1000", "maxexecutiontime": "60"}, plan.Phases[1].Properties)
+
+	for _, content := range []string{
+		"workload=CoreWorkload\n",
+		"[a]\n[a]\n",
+		"[a]\ncommand=shell\n",
+		"[a]\ninvalid line\n",
+	} {
+		fileName := writeTempFile(t, content)
+		defer os.Remove(fileName)
+		plan, err = LoadPlan(fileName)
+		require.NotNil(t, err, content)
+		require.Nil(t, plan, content)
+	}
+}
+
+func TestPlanPhaseProperties(t *testing.T) {
+	plan := &Plan{
+		Properties: Properties{"workload": "CoreWorkload", "recordcount": "100", "target": "100"},
+		Phases: []*PlanPhase{
+			&PlanPhase{Name: "run-a", Command: "run", Properties: Properties{"threadcount": "4", "target": "1000"}},
+		},
+	}
+	runner := NewPlanRunner(&Arguemnts{
+		Command:               "plan",
+		Options:               map[string]string{},
+		Properties:            Properties{"recordcount": "10", "threadcount": "2", "table": "usertable"},
+		CommandLineProperties: Properties{"threadcount": "2"},
+	})
+	// the properties of the plan and the phase override the ones of
+	// the command line, except the ones specified by -p
+	client := runner.newPhaseClient(plan, plan.Phases[0])
+	require.Equal(t, Properties{
+		"workload":    "CoreWorkload",
+		"recordcount": "100",
+		"target":      "1000",
+		"threadcount": "2",
+		"table":       "usertable",
+	}, client.Args.Properties)
+	require.Equal(t, "run-a", client.Args.Options["l"])
+	require.True(t, client.DoTransactions)
+}
+
+func TestPlanRunnerFailedPhase(t *testing.T) {
+	defer ResetMeasurements()
+	resetMemoryTables()
+	exportFile := writeTempFile(t, "")
+	defer os.Remove(exportFile)
+	plan := &Plan{
+		Properties: Properties{"db": "memory", "recordcount": "10"},
+		Phases: []*PlanPhase{
+			&PlanPhase{Name: "load", Command: "load", Properties: Properties{"workload": "CoreWorkload"}},
+			// the range of records is out of the table
+			&PlanPhase{Name: "run", Command: "run", Properties: Properties{
+				"workload": "ClosedEconomyWorkload", "insertstart": "5", "insertcount": "10"}},
+		},
+	}
+	runner := NewPlanRunner(&Arguemnts{
+		Command: "plan",
+		Options: map[string]string{},
+		Properties: Properties{
+			PropertyExporter:   "JSONArrayMeasurementExporter",
+			PropertyExportFile: exportFile,
+		},
+	})
+	clients := make([]*ClientBase, 0, len(plan.Phases))
+	for _, phase := range plan.Phases {
+		clients = append(clients, runner.newPhaseClient(plan, phase))
+	}
+	err := runner.run(plan, clients)
+	require.NotNil(t, err)
+
+	// the measurements of the finished phase are exported
+	data, err := ioutil.ReadFile(exportFile)
+	require.Nil(t, err)
+	var measurements []map[string]interface{}
+	require.Nil(t, json.Unmarshal(data, &measurements))
+	metrics := make(map[string]bool)
+	for _, m := range measurements {
+		metrics[m["metric"].(string)] = true
+	}
+	require.True(t, metrics["load/OVERALL"])
+	require.False(t, metrics["run/OVERALL"])
+}
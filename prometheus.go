@@ -0,0 +1,204 @@
+package yabf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// The measurements which could report the quantiles of the latencies so far.
+type quantileMeasurement interface {
+	latencyQuantiles(quantiles []float64) ([]int64, int64, float64)
+}
+
+// Serve the metrics of the run in progress in the Prometheus text format,
+// so that long runs could be graphed alongside the metrics of the database
+// servers. It serves the latest run of the process, e.g. the current phase
+// of a plan.
+type PrometheusExporter struct {
+	quantiles []float64
+	lock      sync.Mutex
+	client    *ClientBase
+	// the last sample of the operations done, to compute the current throughput
+	lastTime   int64
+	lastOps    int64
+	throughput float64
+}
+
+func NewPrometheusExporter(props Properties) (*PrometheusExporter, error) {
+	propStr := props.GetDefault(PropertyPrometheusQuantiles, PropertyPrometheusQuantilesDefault)
+	quantiles := make([]float64, 0)
+	for _, part := range strings.Split(propStr, ",") {
+		q, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if (err != nil) || (q < 0) || (q > 1) {
+			return nil, g.NewErrorf("invalid property %s=%s", PropertyPrometheusQuantiles, propStr)
+		}
+		quantiles = append(quantiles, q)
+	}
+	return &PrometheusExporter{
+		quantiles: quantiles,
+	}, nil
+}
+
+var (
+	prometheusExporter     *PrometheusExporter
+	prometheusExporterLock sync.Mutex
+)
+
+// Start serving the metrics on the address of the "prometheus.listen"
+// property, if it's set and not started yet. Return the exporter, or nil
+// if it's disabled.
+func servePrometheus(props Properties) (*PrometheusExporter, error) {
+	prometheusExporterLock.Lock()
+	defer prometheusExporterLock.Unlock()
+	if prometheusExporter != nil {
+		return prometheusExporter, nil
+	}
+	addr := props.Get(PropertyPrometheusListen)
+	if len(addr) == 0 {
+		return nil, nil
+	}
+	exporter, err := NewPrometheusExporter(props)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	go func() {
+		err := http.Serve(listener, mux)
+		EPrintf("prometheus exporter stops, error: %s", err)
+	}()
+	Printf("Serving Prometheus metrics on http://%s/metrics", listener.Addr())
+	prometheusExporter = exporter
+	return exporter, nil
+}
+
+// Serve the metrics of the client from now on.
+func (self *PrometheusExporter) setClient(client *ClientBase) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.client = client
+	self.lastTime = NowMS()
+	self.lastOps = 0
+	self.throughput = 0
+}
+
+func (self *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf := bufio.NewWriter(w)
+	if err := self.WriteMetrics(buf); err != nil {
+		EPrintf("fail to write metrics, error: %s", err)
+		return
+	}
+	buf.Flush()
+}
+
+// Write all the metrics in the Prometheus text exposition format.
+func (self *PrometheusExporter) WriteMetrics(w io.Writer) (err error) {
+	defer catch(&err)
+	write := func(format string, args ...interface{}) {
+		_, err := fmt.Fprintf(w, format, args...)
+		try(err)
+	}
+
+	var opsDone, opsTodo, inFlight int64
+	self.lock.Lock()
+	if self.client != nil {
+		for _, worker := range self.client.getWorkers() {
+			opsDone += worker.getOpsDone()
+			opsTodo += worker.getOpsTodo()
+			inFlight += worker.getInFlight()
+		}
+	}
+	// the throughput is computed over the interval since the last sample,
+	// which is taken at most once per second
+	now := NowMS()
+	if now-self.lastTime >= 1000 {
+		self.throughput = float64(opsDone-self.lastOps) * 1000.0 / float64(now-self.lastTime)
+		self.lastTime = now
+		self.lastOps = opsDone
+	}
+	throughput := self.throughput
+	self.lock.Unlock()
+
+	write("# HELP yabf_operations_done_total The number of operations done in the current run.\n")
+	write("# TYPE yabf_operations_done_total counter\n")
+	write("yabf_operations_done_total %d\n", opsDone)
+	write("# HELP yabf_operations_todo The number of operations left to do in the current run.\n")
+	write("# TYPE yabf_operations_todo gauge\n")
+	write("yabf_operations_todo %d\n", opsTodo)
+	write("# HELP yabf_workers_in_flight The number of workers with an operation in flight.\n")
+	write("# TYPE yabf_workers_in_flight gauge\n")
+	write("yabf_workers_in_flight %d\n", inFlight)
+	write("# HELP yabf_throughput_ops The current throughput in operations per second.\n")
+	write("# TYPE yabf_throughput_ops gauge\n")
+	write("yabf_throughput_ops %s\n", formatPrometheusValue(throughput))
+
+	measurements := GetMeasurements()
+	operations := measurements.Operations()
+	write("# HELP yabf_operation_returns_total The number of operations by return code.\n")
+	write("# TYPE yabf_operation_returns_total counter\n")
+	for _, op := range operations {
+		m := measurements.Lookup(op)
+		if m == nil {
+			// reset in the meantime
+			continue
+		}
+		returnCodes := m.GetReturnCodes()
+		statuses := make([]StatusType, 0, len(returnCodes))
+		for status, _ := range returnCodes {
+			statuses = append(statuses, status)
+		}
+		sort.Slice(statuses, func(i, j int) bool {
+			return statuses[i] < statuses[j]
+		})
+		for _, status := range statuses {
+			write("yabf_operation_returns_total{operation=\"%s\",status=\"%s\"} %d\n",
+				escapePrometheusLabel(op), status, returnCodes[status])
+		}
+	}
+	write("# HELP yabf_operation_latency_us The latencies of operations in microseconds since the start of the run.\n")
+	write("# TYPE yabf_operation_latency_us summary\n")
+	for _, op := range operations {
+		m, ok := measurements.Lookup(op).(quantileMeasurement)
+		if !ok {
+			continue
+		}
+		values, count, sum := m.latencyQuantiles(self.quantiles)
+		if values == nil {
+			continue
+		}
+		label := escapePrometheusLabel(op)
+		for i, q := range self.quantiles {
+			write("yabf_operation_latency_us{operation=\"%s\",quantile=\"%s\"} %d\n",
+				label, formatPrometheusValue(q), values[i])
+		}
+		write("yabf_operation_latency_us_sum{operation=\"%s\"} %s\n", label, formatPrometheusValue(sum))
+		write("yabf_operation_latency_us_count{operation=\"%s\"} %d\n", label, count)
+	}
+	return
+}
+
+func formatPrometheusValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	prometheusLabelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func escapePrometheusLabel(s string) string {
+	return prometheusLabelReplacer.Replace(s)
+}
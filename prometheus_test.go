@@ -0,0 +1,120 @@
+package yabf
+
+import (
+	"github.com/hhkbp2/testify/require"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testOpsCounter struct {
+	done, todo, inFlight int64
+}
+
+func (self *testOpsCounter) getOpsDone() int64 {
+	return self.done
+}
+
+func (self *testOpsCounter) getOpsTodo() int64 {
+	return self.todo
+}
+
+func (self *testOpsCounter) getInFlight() int64 {
+	return self.inFlight
+}
+
+func TestPrometheusExporter(t *testing.T) {
+	props := NewProperties()
+	props.Add(PropertyPrometheusQuantiles, "0.5,0.99")
+	exporter, err := NewPrometheusExporter(props)
+	require.Nil(t, err)
+	client := NewClientBase(&Arguemnts{})
+	client.workers = []opsCounter{
+		&testOpsCounter{done: 10, todo: 90, inFlight: 1},
+		&testOpsCounter{done: 20, todo: 80, inFlight: 0},
+	}
+	exporter.setClient(client)
+
+	measurementProps := NewProperties()
+	measurementProps.Add(PropertyMeasurementType, "hdrhistogram")
+	SetMeasurementProperties(measurementProps)
+	ResetMeasurements()
+	defer func() {
+		SetMeasurementProperties(NewProperties())
+		ResetMeasurements()
+	}()
+	measurements := GetMeasurements()
+	for i := int64(1); i <= 100; i++ {
+		measurements.Measure("READ", i)
+		measurements.ReportStatus("READ", StatusOK)
+	}
+	measurements.ReportStatus("READ", StatusNotFound)
+	measurements.Measure("SCAN\"1\"", 5)
+
+	r := httptest.NewRecorder()
+	exporter.ServeHTTP(r, httptest.NewRequest("GET", "/metrics", nil))
+	require.True(t, strings.HasPrefix(r.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	body, err := ioutil.ReadAll(r.Body)
+	require.Nil(t, err)
+	lines := strings.Split(string(body), "\n")
+	for _, line := range []string{
+		"# TYPE yabf_operations_done_total counter",
+		"yabf_operations_done_total 30",
+		"yabf_operations_todo 170",
+		"yabf_workers_in_flight 1",
+		"yabf_throughput_ops 0",
+		`yabf_operation_returns_total{operation="READ",status="OK"} 100`,
+		`yabf_operation_returns_total{operation="READ",status="NOT_FOUND"} 1`,
+		"# TYPE yabf_operation_latency_us summary",
+		`yabf_operation_latency_us{operation="READ",quantile="0.5"} 50`,
+		`yabf_operation_latency_us{operation="READ",quantile="0.99"} 99`,
+		`yabf_operation_latency_us_sum{operation="READ"} 5050`,
+		`yabf_operation_latency_us_count{operation="READ"} 100`,
+		`yabf_operation_latency_us_count{operation="SCAN\"1\""} 1`,
+	} {
+		require.Contains(t, lines, line)
+	}
+	// every sample line is in the form "name{labels} value"
+	for _, line := range lines {
+		if (len(line) == 0) || strings.HasPrefix(line, "#") {
+			continue
+		}
+		require.Equal(t, 2, len(strings.Split(strings.Replace(line, `\"`, "", -1), " ")), line)
+	}
+
+	props.Add(PropertyPrometheusQuantiles, "0.5,99")
+	_, err = NewPrometheusExporter(props)
+	require.NotNil(t, err)
+}
+
+func TestPrometheusExporterReset(t *testing.T) {
+	exporter, err := NewPrometheusExporter(NewProperties())
+	require.Nil(t, err)
+	client := NewClientBase(&Arguemnts{})
+	client.workers = []opsCounter{&testOpsCounter{done: 10}}
+	exporter.setClient(client)
+	defer func() {
+		SetMeasurementProperties(NewProperties())
+		ResetMeasurements()
+	}()
+
+	// the metrics are scraped while the measurements are reset, e.g. at
+	// the end of warm-up or between the phases of a plan, which races
+	// without the singleton guarded under "go test -race"
+	done := make(chan int)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			r := httptest.NewRecorder()
+			exporter.ServeHTTP(r, httptest.NewRequest("GET", "/metrics", nil))
+			require.Equal(t, 200, r.Code)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		SetMeasurementProperties(NewProperties())
+		ResetMeasurements()
+		GetMeasurements().Measure("READ", int64(i))
+	}
+	<-done
+}
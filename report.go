@@ -0,0 +1,451 @@
+package yabf
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codahale/hdrhistogram"
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// A client which post-processes the HdrHistogram interval logs, e.g.
+// the ones of OneMeasurementHdrHistogram. It merges the logs(across
+// operations or across clients), selects a time window, and reports
+// the percentile distribution, the percentile time series and
+// the percentile spectrum of them.
+type Reporter struct {
+	args *Arguemnts
+}
+
+func NewReporter(args *Arguemnts) *Reporter {
+	return &Reporter{
+		args: args,
+	}
+}
+
+func (self *Reporter) Main() {
+	if len(self.args.Inputs) == 0 {
+		ExitOnError("no input file")
+	}
+	props := self.args.Properties
+	options, err := newReportOptions(props)
+	if err != nil {
+		ExitOnError("%s", err)
+	}
+	intervals := make([]*reportInterval, 0)
+	for _, fileName := range self.args.Inputs {
+		v, err := loadReportIntervals(fileName)
+		if err != nil {
+			ExitOnError("fail to load %s, error: %s", fileName, err)
+		}
+		intervals = append(intervals, v...)
+	}
+	report := buildReport(intervals, options)
+	if len(report.Groups) == 0 {
+		Warnf("no interval in the window")
+	}
+
+	var w io.Writer = os.Stdout
+	if fileName := props.Get(PropertyExportFile); len(fileName) > 0 {
+		f, err := os.Create(fileName)
+		if err != nil {
+			ExitOnError("%s", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	format := props.GetDefault(PropertyReportFormat, PropertyReportFormatDefault)
+	switch format {
+	case "text":
+		err = report.WriteText(w)
+	case "csv":
+		err = report.WriteCSV(w)
+	case "json":
+		err = report.WriteJSON(w)
+	default:
+		ExitOnError("invalid property %s=%s, should be text, csv or json", PropertyReportFormat, format)
+	}
+	if err != nil {
+		ExitOnError("fail to write report, error: %s", err)
+	}
+}
+
+type reportOptions struct {
+	// the window and the interval length in milliseconds
+	start       int64
+	end         int64
+	interval    int64
+	percentiles []float64
+	groupBy     string
+}
+
+func newReportOptions(props Properties) (*reportOptions, error) {
+	parseSeconds := func(name, defaultValue string) (int64, error) {
+		propStr := props.GetDefault(name, defaultValue)
+		v, err := strconv.ParseFloat(propStr, 64)
+		if (err != nil) || (v < 0) {
+			return 0, g.NewErrorf("invalid property %s=%s, should be non-negative number", name, propStr)
+		}
+		return int64(v * 1000), nil
+	}
+	options := &reportOptions{}
+	var err error
+	if options.start, err = parseSeconds(PropertyReportStart, PropertyReportStartDefault); err != nil {
+		return nil, err
+	}
+	if options.end, err = parseSeconds(PropertyReportEnd, PropertyReportEndDefault); err != nil {
+		return nil, err
+	}
+	if options.interval, err = parseSeconds(PropertyReportInterval, PropertyReportIntervalDefault); err != nil {
+		return nil, err
+	}
+	if options.interval <= 0 {
+		return nil, g.NewErrorf("%s should be positive", PropertyReportInterval)
+	}
+	propStr := props.GetDefault(PropertyReportPercentiles, PropertyReportPercentilesDefault)
+	for _, p := range strings.Split(propStr, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if (err != nil) || (v < 0) || (v > 100) {
+			return nil, g.NewErrorf("invalid property %s=%s", PropertyReportPercentiles, propStr)
+		}
+		options.percentiles = append(options.percentiles, v)
+	}
+	options.groupBy = props.GetDefault(PropertyReportGroupBy, PropertyReportGroupByDefault)
+	if (options.groupBy != "all") && (options.groupBy != "operation") {
+		return nil, g.NewErrorf("invalid property %s=%s, should be all or operation", PropertyReportGroupBy, options.groupBy)
+	}
+	return options, nil
+}
+
+// An interval histogram in the logs, with the operation it's for.
+type reportInterval struct {
+	operation string
+	*HdrIntervalHistogram
+}
+
+// Load all the interval histograms in the log file. The operation of them
+// is the tag if there is one, or the file name without ".hdr".
+func loadReportIntervals(fileName string) ([]*reportInterval, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	operation := strings.TrimSuffix(filepath.Base(fileName), ".hdr")
+	reader := NewHdrHistogramLogReader(f)
+	ret := make([]*reportInterval, 0)
+	for {
+		interval, err := reader.NextIntervalHistogram()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		op := operation
+		if len(interval.Tag) > 0 {
+			op = interval.Tag
+		}
+		ret = append(ret, &reportInterval{
+			operation:            op,
+			HdrIntervalHistogram: interval,
+		})
+	}
+	return ret, nil
+}
+
+type ReportPercentile struct {
+	Percentile float64 `json:"percentile"`
+	// the latency in microseconds
+	Value int64 `json:"value"`
+}
+
+// The distribution of the latencies in microseconds.
+type ReportSummary struct {
+	Count       int64              `json:"count"`
+	Min         int64              `json:"min"`
+	Max         int64              `json:"max"`
+	Mean        float64            `json:"mean"`
+	StdDev      float64            `json:"stddev"`
+	Percentiles []ReportPercentile `json:"percentiles"`
+}
+
+// One interval in the percentile time series.
+type ReportInterval struct {
+	// the start time in seconds since the start of the logs
+	Time        float64            `json:"time"`
+	Count       int64              `json:"count"`
+	Throughput  float64            `json:"throughput"`
+	Percentiles []ReportPercentile `json:"percentiles"`
+}
+
+// One point of the percentile spectrum.
+type ReportSpectrumPoint struct {
+	Value      int64   `json:"value"`
+	Percentile float64 `json:"percentile"`
+	TotalCount int64   `json:"totalcount"`
+}
+
+// The report of the logs merged into one group, e.g. the ones of an operation.
+type ReportGroup struct {
+	Name      string                `json:"name"`
+	Summary   ReportSummary         `json:"summary"`
+	Intervals []ReportInterval      `json:"intervals"`
+	Spectrum  []ReportSpectrumPoint `json:"spectrum"`
+}
+
+type Report struct {
+	// the start time of the logs in milliseconds since epoch
+	StartTime int64 `json:"starttime"`
+	// the window in seconds since the start of the logs
+	WindowStart float64        `json:"windowstart"`
+	WindowEnd   float64        `json:"windowend"`
+	Percentiles []float64      `json:"-"`
+	Groups      []*ReportGroup `json:"groups"`
+}
+
+func reportPercentiles(h *hdrhistogram.Histogram, percentiles []float64) []ReportPercentile {
+	ret := make([]ReportPercentile, 0, len(percentiles))
+	for _, p := range percentiles {
+		ret = append(ret, ReportPercentile{
+			Percentile: p,
+			Value:      h.ValueAtQuantile(p),
+		})
+	}
+	return ret
+}
+
+// The intervals merged into one bucket of the time series.
+type reportBucket struct {
+	histogram *hdrhistogram.Histogram
+	startTime int64
+	endTime   int64
+}
+
+func newReportHistogram(like *hdrhistogram.Histogram) *hdrhistogram.Histogram {
+	return hdrhistogram.New(like.LowestTrackableValue(), like.HighestTrackableValue(), int(like.SignificantFigures()))
+}
+
+// Build the report of the intervals in the window, grouped by the options.
+func buildReport(intervals []*reportInterval, options *reportOptions) *Report {
+	report := &Report{
+		Percentiles: options.percentiles,
+		Groups:      make([]*ReportGroup, 0),
+	}
+	if len(intervals) == 0 {
+		return report
+	}
+	report.StartTime = intervals[0].StartTime
+	operations := make(map[string]bool)
+	for _, interval := range intervals {
+		if interval.StartTime < report.StartTime {
+			report.StartTime = interval.StartTime
+		}
+		operations[interval.operation] = true
+	}
+	report.WindowStart = float64(options.start) / 1000.0
+	report.WindowEnd = float64(options.end) / 1000.0
+
+	groups := make(map[string][]*reportInterval)
+	windowEnd := int64(0)
+	for _, interval := range intervals {
+		elapsed := interval.StartTime - report.StartTime
+		if (elapsed < options.start) || ((options.end > 0) && (elapsed >= options.end)) {
+			continue
+		}
+		if interval.EndTime-report.StartTime > windowEnd {
+			windowEnd = interval.EndTime - report.StartTime
+		}
+		name := interval.operation
+		if options.groupBy == "all" && (len(operations) > 1) {
+			name = "ALL"
+		}
+		groups[name] = append(groups[name], interval)
+	}
+	if options.end == 0 {
+		report.WindowEnd = float64(windowEnd) / 1000.0
+	}
+	names := make([]string, 0, len(groups))
+	for name, _ := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		report.Groups = append(report.Groups, buildReportGroup(name, groups[name], report.StartTime, options))
+	}
+	return report
+}
+
+func buildReportGroup(name string, intervals []*reportInterval, startTime int64, options *reportOptions) *ReportGroup {
+	total := newReportHistogram(intervals[0].Histogram)
+	buckets := make(map[int64]*reportBucket)
+	for _, interval := range intervals {
+		total.Merge(interval.Histogram)
+		index := (interval.StartTime - startTime) / options.interval
+		bucket, ok := buckets[index]
+		if !ok {
+			bucket = &reportBucket{
+				histogram: newReportHistogram(interval.Histogram),
+				startTime: interval.StartTime,
+				endTime:   interval.EndTime,
+			}
+			buckets[index] = bucket
+		}
+		bucket.histogram.Merge(interval.Histogram)
+		if interval.StartTime < bucket.startTime {
+			bucket.startTime = interval.StartTime
+		}
+		if interval.EndTime > bucket.endTime {
+			bucket.endTime = interval.EndTime
+		}
+	}
+
+	group := &ReportGroup{
+		Name: name,
+		Summary: ReportSummary{
+			Count:       total.TotalCount(),
+			Min:         total.Min(),
+			Max:         total.Max(),
+			Mean:        total.Mean(),
+			StdDev:      total.StdDev(),
+			Percentiles: reportPercentiles(total, options.percentiles),
+		},
+		Intervals: make([]ReportInterval, 0, len(buckets)),
+		Spectrum:  make([]ReportSpectrumPoint, 0),
+	}
+	indexes := make([]int64, 0, len(buckets))
+	for index, _ := range buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i] < indexes[j]
+	})
+	for _, index := range indexes {
+		bucket := buckets[index]
+		var throughput float64
+		if bucket.endTime > bucket.startTime {
+			throughput = float64(bucket.histogram.TotalCount()) * 1000.0 / float64(bucket.endTime-bucket.startTime)
+		}
+		group.Intervals = append(group.Intervals, ReportInterval{
+			Time:        float64(index*options.interval) / 1000.0,
+			Count:       bucket.histogram.TotalCount(),
+			Throughput:  throughput,
+			Percentiles: reportPercentiles(bucket.histogram, options.percentiles),
+		})
+	}
+	if total.TotalCount() > 0 {
+		for _, b := range total.CumulativeDistribution() {
+			group.Spectrum = append(group.Spectrum, ReportSpectrumPoint{
+				Value:      b.ValueAt,
+				Percentile: b.Quantile,
+				TotalCount: b.Count,
+			})
+		}
+	}
+	return group
+}
+
+func formatPercentile(p float64) string {
+	return "p" + strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+// Write the report in human readable text.
+func (self *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Window: %.3f - %.3f sec\n", self.WindowStart, self.WindowEnd)
+	for _, group := range self.Groups {
+		s := group.Summary
+		fmt.Fprintf(tw, "\n[%s]\n", group.Name)
+		fmt.Fprintf(tw, "Operations: %d, Min(us): %d, Mean(us): %.2f, Max(us): %d, StdDev(us): %.2f\n",
+			s.Count, s.Min, s.Mean, s.Max, s.StdDev)
+		fmt.Fprintf(tw, "\nPercentile distribution(us):\n")
+		for _, p := range s.Percentiles {
+			fmt.Fprintf(tw, "%s\t%d\t\n", formatPercentile(p.Percentile), p.Value)
+		}
+		fmt.Fprintf(tw, "\nPercentile time series(us):\n")
+		fmt.Fprintf(tw, "Time(s)\tCount\tThroughput(ops/sec)\t")
+		for _, p := range self.Percentiles {
+			fmt.Fprintf(tw, "%s\t", formatPercentile(p))
+		}
+		fmt.Fprintf(tw, "\n")
+		for _, interval := range group.Intervals {
+			fmt.Fprintf(tw, "%.3f\t%d\t%.2f\t", interval.Time, interval.Count, interval.Throughput)
+			for _, p := range interval.Percentiles {
+				fmt.Fprintf(tw, "%d\t", p.Value)
+			}
+			fmt.Fprintf(tw, "\n")
+		}
+		fmt.Fprintf(tw, "\nPercentile spectrum(us):\n")
+		fmt.Fprintf(tw, "Value\tPercentile\tTotalCount\t1/(1-Percentile)\t\n")
+		for _, point := range group.Spectrum {
+			inverted := "Inf"
+			if point.Percentile < 100 {
+				inverted = fmt.Sprintf("%.2f", 1/(1-point.Percentile/100))
+			}
+			fmt.Fprintf(tw, "%d\t%.6f\t%d\t%s\t\n", point.Value, point.Percentile/100, point.TotalCount, inverted)
+		}
+	}
+	return tw.Flush()
+}
+
+// Write the report in CSV, as three tables separated by blank lines, for
+// the percentile distributions, the time series and the spectrums.
+func (self *Report) WriteCSV(w io.Writer) error {
+	percentileHeaders := make([]string, 0, len(self.Percentiles))
+	for _, p := range self.Percentiles {
+		percentileHeaders = append(percentileHeaders, formatPercentile(p))
+	}
+	formatInt := func(v int64) string {
+		return strconv.FormatInt(v, 10)
+	}
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	appendPercentiles := func(record []string, percentiles []ReportPercentile) []string {
+		for _, p := range percentiles {
+			record = append(record, formatInt(p.Value))
+		}
+		return record
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write(append([]string{"operation", "count", "min", "mean", "max", "stddev"}, percentileHeaders...))
+	for _, group := range self.Groups {
+		s := group.Summary
+		record := []string{group.Name, formatInt(s.Count), formatInt(s.Min), formatFloat(s.Mean), formatInt(s.Max), formatFloat(s.StdDev)}
+		cw.Write(appendPercentiles(record, s.Percentiles))
+	}
+	cw.Flush()
+	fmt.Fprintln(w)
+	cw.Write(append([]string{"operation", "time", "count", "throughput"}, percentileHeaders...))
+	for _, group := range self.Groups {
+		for _, interval := range group.Intervals {
+			record := []string{group.Name, formatFloat(interval.Time), formatInt(interval.Count), formatFloat(interval.Throughput)}
+			cw.Write(appendPercentiles(record, interval.Percentiles))
+		}
+	}
+	cw.Flush()
+	fmt.Fprintln(w)
+	cw.Write([]string{"operation", "value", "percentile", "totalcount"})
+	for _, group := range self.Groups {
+		for _, point := range group.Spectrum {
+			cw.Write([]string{group.Name, formatInt(point.Value), formatFloat(point.Percentile), formatInt(point.TotalCount)})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (self *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(self)
+}
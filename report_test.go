@@ -0,0 +1,105 @@
+package yabf
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hhkbp2/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write a log of intervals of 1 second from startTime, with the values of
+// every interval.
+func writeTestLog(t *testing.T, fileName string, startTime int64, values ...[]int64) {
+	f, err := os.Create(fileName)
+	require.Nil(t, err)
+	defer f.Close()
+	writer := NewHdrHistogramLogWriter(f)
+	require.Nil(t, writer.OutputHeader(startTime))
+	for i, v := range values {
+		s := startTime + int64(i)*1000
+		require.Nil(t, writer.OutputIntervalHistogram(s, s+1000, newTestHistogram(v...)))
+	}
+}
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "report")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	startTime := int64(1441812279000)
+	for _, client := range []string{"client1", "client2"} {
+		require.Nil(t, os.Mkdir(filepath.Join(dir, client), 0755))
+	}
+	// the logs of READ from 2 clients, and the one of UPDATE
+	writeTestLog(t, filepath.Join(dir, "client1", "READ.hdr"), startTime, []int64{10, 20}, []int64{30}, []int64{40})
+	writeTestLog(t, filepath.Join(dir, "client2", "READ.hdr"), startTime+500, []int64{100}, []int64{200})
+	writeTestLog(t, filepath.Join(dir, "client1", "UPDATE.hdr"), startTime, []int64{1000})
+
+	intervals := make([]*reportInterval, 0)
+	for _, fileName := range []string{"client1/READ.hdr", "client2/READ.hdr", "client1/UPDATE.hdr"} {
+		v, err := loadReportIntervals(filepath.Join(dir, fileName))
+		require.Nil(t, err)
+		intervals = append(intervals, v...)
+	}
+	require.Equal(t, 6, len(intervals))
+
+	props := NewProperties()
+	props.Add(PropertyReportGroupBy, "operation")
+	props.Add(PropertyReportInterval, "1")
+	options, err := newReportOptions(props)
+	require.Nil(t, err)
+	report := buildReport(intervals, options)
+	require.Equal(t, startTime, report.StartTime)
+	require.Equal(t, float64(3), report.WindowEnd)
+	require.Equal(t, 2, len(report.Groups))
+	read := report.Groups[0]
+	require.Equal(t, "READ", read.Name)
+	require.Equal(t, int64(6), read.Summary.Count)
+	require.Equal(t, int64(10), read.Summary.Min)
+	require.Equal(t, 3, len(read.Intervals))
+	require.Equal(t, int64(3), read.Intervals[0].Count)
+	require.Equal(t, float64(1), read.Intervals[1].Time)
+	require.Equal(t, int64(2), read.Intervals[1].Count)
+	require.Equal(t, float64(100), read.Spectrum[len(read.Spectrum)-1].Percentile)
+	require.Equal(t, int64(6), read.Spectrum[len(read.Spectrum)-1].TotalCount)
+	require.Equal(t, "UPDATE", report.Groups[1].Name)
+
+	// all the operations merged, in the window from 1 sec to 2 sec
+	props.Add(PropertyReportGroupBy, "all")
+	props.Add(PropertyReportStart, "1")
+	props.Add(PropertyReportEnd, "2")
+	options, err = newReportOptions(props)
+	require.Nil(t, err)
+	report = buildReport(intervals, options)
+	require.Equal(t, 1, len(report.Groups))
+	require.Equal(t, "ALL", report.Groups[0].Name)
+	require.Equal(t, int64(2), report.Groups[0].Summary.Count)
+
+	var buf bytes.Buffer
+	require.Nil(t, report.WriteText(&buf))
+	require.True(t, strings.Contains(buf.String(), "[ALL]"))
+	buf.Reset()
+	require.Nil(t, report.WriteCSV(&buf))
+	tables := strings.Split(strings.TrimSpace(buf.String()), "\n\n")
+	require.Equal(t, 3, len(tables))
+	require.True(t, strings.HasPrefix(tables[0], "operation,count,min,mean,max,stddev,p50,p90,p95,p99,p99.9,p99.99\nALL,2,"))
+	buf.Reset()
+	require.Nil(t, report.WriteJSON(&buf))
+	var decoded Report
+	require.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, int64(2), decoded.Groups[0].Summary.Count)
+
+	for _, v := range [][]string{
+		{PropertyReportGroupBy, "client"},
+		{PropertyReportInterval, "0"},
+		{PropertyReportPercentiles, "101"},
+	} {
+		p := NewProperties()
+		p.Add(v[0], v[1])
+		_, err = newReportOptions(p)
+		require.NotNil(t, err)
+	}
+}
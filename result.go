@@ -0,0 +1,186 @@
+package yabf
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// A self-describing document of the result of a command, which records
+// the properties and the environment every phase runs in, as well as
+// the measurements of it, so that the result could be reproduced.
+// The values of the passwords, e.g. "mysql.password", are redacted in
+// the properties and the command line.
+type ResultDocument struct {
+	Program     string            `json:"program"`
+	Version     string            `json:"version"`
+	GitVersion  string            `json:"gitversion"`
+	Command     string            `json:"command"`
+	Database    string            `json:"database,omitempty"`
+	Label       string            `json:"label,omitempty"`
+	CommandLine []string          `json:"commandline"`
+	Environment ResultEnvironment `json:"environment"`
+	StartTime   time.Time         `json:"starttime"`
+	EndTime     time.Time         `json:"endtime"`
+	Phases      []*ResultPhase    `json:"phases"`
+}
+
+// The environment a command runs in.
+type ResultEnvironment struct {
+	Host      string `json:"host"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	CPUs      int    `json:"cpus"`
+	GoVersion string `json:"goversion"`
+}
+
+// The result of one run of the workload, e.g. a phase of a plan.
+type ResultPhase struct {
+	Name      string    `json:"name"`
+	Command   string    `json:"command"`
+	StartTime time.Time `json:"starttime"`
+	EndTime   time.Time `json:"endtime"`
+	// the run time in milliseconds
+	RunTime    int64   `json:"runtime"`
+	Operations int64   `json:"operations"`
+	Throughput float64 `json:"throughput"`
+	// the effective properties of the run
+	Properties Properties `json:"properties"`
+	// the measurements by metric(e.g. "READ") and then by measurement(e.g.
+	// "AverageLatency(us)" or "Return=OK"), as written to the exporters
+	Measurements map[string]map[string]interface{} `json:"measurements"`
+}
+
+func NewResultDocument(args *Arguemnts) *ResultDocument {
+	host, _ := os.Hostname()
+	return &ResultDocument{
+		Program:     ProgramName,
+		Version:     MainVersion,
+		GitVersion:  GitVersion,
+		Command:     args.Command,
+		Database:    args.Database,
+		Label:       args.Options["l"],
+		CommandLine: redactCommandLine(os.Args),
+		Environment: ResultEnvironment{
+			Host:      host,
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			CPUs:      runtime.NumCPU(),
+			GoVersion: runtime.Version(),
+		},
+		StartTime: time.Now(),
+		Phases:    make([]*ResultPhase, 0),
+	}
+}
+
+// Add a phase of the run result. Its measurements are recorded by
+// the exporter returned by ResultPhase.Recorder().
+func (self *ResultDocument) AddPhase(name, command string, props Properties, result *RunResult) *ResultPhase {
+	startTime := time.Unix(0, MillisecondToNanosecond(result.StartTime))
+	var throughput float64
+	if result.RunTime > 0 {
+		throughput = result.Throughput()
+	}
+	phase := &ResultPhase{
+		Name:         name,
+		Command:      command,
+		StartTime:    startTime,
+		EndTime:      startTime.Add(time.Duration(MillisecondToNanosecond(result.RunTime))),
+		RunTime:      result.RunTime,
+		Operations:   result.Operations,
+		Throughput:   throughput,
+		Properties:   redactProperties(props),
+		Measurements: make(map[string]map[string]interface{}),
+	}
+	self.Phases = append(self.Phases, phase)
+	return phase
+}
+
+// The value of the passwords in the result document.
+const redactedValue = "<redacted>"
+
+// Return whether the property is a password, e.g. "mysql.password".
+func isPasswordProperty(name string) bool {
+	return (name == "password") || strings.HasSuffix(name, ".password")
+}
+
+// Return a copy of the properties with the passwords redacted.
+func redactProperties(props Properties) Properties {
+	ret := NewProperties()
+	for k, v := range props {
+		if isPasswordProperty(k) {
+			v = redactedValue
+		}
+		ret[k] = v
+	}
+	return ret
+}
+
+// Return a copy of the command line with the passwords of the properties,
+// e.g. "-p mysql.password=xxx", redacted.
+func redactCommandLine(args []string) []string {
+	ret := make([]string, 0, len(args))
+	for _, arg := range args {
+		if i := strings.Index(arg, "="); (i > 0) && isPasswordProperty(arg[:i]) {
+			arg = arg[:i+1] + redactedValue
+		}
+		ret = append(ret, arg)
+	}
+	return ret
+}
+
+// Write the document into the file of the "result.file" property,
+// if it's set.
+func (self *ResultDocument) Write(props Properties) error {
+	fileName := props.Get(PropertyResultFile)
+	if len(fileName) == 0 {
+		return nil
+	}
+	self.EndTime = time.Now()
+	b, err := json.MarshalIndent(self, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	err2 := f.Close()
+	if err != nil {
+		return err
+	}
+	return err2
+}
+
+// Return an exporter which records the measurements into the phase,
+// and writes them to the exporter as well.
+func (self *ResultPhase) Recorder(exporter MeasurementExporter) MeasurementExporter {
+	return &resultRecorder{
+		MeasurementExporter: exporter,
+		phase:               self,
+	}
+}
+
+type resultRecorder struct {
+	MeasurementExporter
+	phase *ResultPhase
+}
+
+func (self *resultRecorder) Write(metric string, measurement string, v interface{}) error {
+	m, ok := self.phase.Measurements[metric]
+	if !ok {
+		m = make(map[string]interface{})
+		self.phase.Measurements[metric] = m
+	}
+	if f, ok := v.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+		// not representable in JSON
+		m[measurement] = nil
+	} else {
+		m[measurement] = v
+	}
+	return self.MeasurementExporter.Write(metric, measurement, v)
+}
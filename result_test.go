@@ -0,0 +1,73 @@
+package yabf
+
+import (
+	"encoding/json"
+	"github.com/hhkbp2/testify/require"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResultDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "result")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "result.json")
+
+	props := NewProperties()
+	props.Add(PropertyDB, "basic")
+	props.Add(PropertyThreadCount, "4")
+	props.Add(PropertyResultFile, fileName)
+	props.Add("mysql.password", "secret")
+	document := NewResultDocument(&Arguemnts{
+		Command:    "run",
+		Database:   "basic",
+		Options:    map[string]string{"l": "test"},
+		Properties: props,
+	})
+	result := &RunResult{
+		StartTime:  1441812279474,
+		Operations: 1000,
+		RunTime:    2000,
+	}
+	phase := document.AddPhase("run", "run", props, result)
+	var buf strings.Builder
+	recorder := phase.Recorder(NewTextMeasurementExporter(nopWriteCloser{&buf}))
+	require.Nil(t, writeMeasurements(recorder, result.Operations, result.RunTime))
+	require.Nil(t, recorder.Write("READ", "Return=OK", uint32(1000)))
+	require.Nil(t, recorder.Write("READ", "Ratio", math.NaN()))
+	require.Nil(t, recorder.Close())
+	require.True(t, strings.Contains(buf.String(), "[READ], Return=OK, 1000"))
+	// the properties of the phase are a copy
+	props.Add(PropertyThreadCount, "8")
+	require.Nil(t, document.Write(props))
+
+	data, err := ioutil.ReadFile(fileName)
+	require.Nil(t, err)
+	var decoded ResultDocument
+	require.Nil(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, "run", decoded.Command)
+	require.Equal(t, "test", decoded.Label)
+	require.Equal(t, GitVersion, decoded.GitVersion)
+	require.True(t, decoded.Environment.CPUs > 0)
+	require.Equal(t, 1, len(decoded.Phases))
+	p := decoded.Phases[0]
+	require.Equal(t, int64(1441812279474), p.StartTime.UnixNano()/1000000)
+	require.Equal(t, int64(1441812281474), p.EndTime.UnixNano()/1000000)
+	require.Equal(t, float64(500), p.Throughput)
+	require.Equal(t, "4", p.Properties[PropertyThreadCount])
+	require.Equal(t, redactedValue, p.Properties["mysql.password"])
+	require.False(t, strings.Contains(string(data), "secret"))
+	require.Equal(t, float64(500), p.Measurements["OVERALL"]["Throughput(ops/sec)"])
+	require.Equal(t, float64(1000), p.Measurements["READ"]["Return=OK"])
+	require.Nil(t, p.Measurements["READ"]["Ratio"])
+
+	require.Equal(t, []string{"yabf", "run", "mysql", "-p", "mysql.password=" + redactedValue, "-p", "recordcount=10"},
+		redactCommandLine([]string{"yabf", "run", "mysql", "-p", "mysql.password=secret", "-p", "recordcount=10"}))
+
+	// nothing is written without the file
+	require.Nil(t, document.Write(NewProperties()))
+}
@@ -0,0 +1,300 @@
+package yabf
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// TargetSchedule describes how the target throughput varies over time.
+type TargetSchedule interface {
+	// Return the target throughput in operations per second at the specified
+	// time, which is in nanoseconds since the start of the run.
+	TargetAt(elapsed int64) float64
+}
+
+// Create the target schedule from the "target.schedule" property, or
+// a constant one from the "target" property if there is no schedule.
+// Return nil if neither of them is set, which means no throttling.
+// The supported schedules are:
+//
+//	ramp:FROM:TO:SECONDS          a linear ramp from FROM to TO ops/sec
+//	                              over SECONDS, staying at TO afterwards
+//	step:START:INC:SECONDS[:MAX]  START ops/sec, increased by INC every
+//	                              SECONDS, up to MAX if it's specified
+//	sine:MEAN:AMPLITUDE:SECONDS   a sine wave around MEAN ops/sec, whose
+//	                              period is SECONDS
+//	csv:FILE                      the lines of "second,ops/sec" in FILE,
+//	                              each of which holds until the next one
+func NewTargetSchedule(props Properties) (TargetSchedule, error) {
+	propStr, ok := props[PropertyTargetSchedule]
+	if !ok || (propStr == "") {
+		propStr = props.GetDefault(PropertyTarget, PropertyTargetDefault)
+		target, err := strconv.ParseInt(propStr, 0, 64)
+		if err != nil {
+			return nil, g.NewErrorf("invalid property %s=%s, should be integer", PropertyTarget, propStr)
+		}
+		if target <= 0 {
+			return nil, nil
+		}
+		return NewConstantTargetSchedule(float64(target)), nil
+	}
+	parts := strings.Split(propStr, ":")
+	if parts[0] == "csv" {
+		if len(parts) != 2 {
+			return nil, g.NewErrorf("invalid %s=%s", PropertyTargetSchedule, propStr)
+		}
+		schedule, err := LoadCSVTargetSchedule(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		return schedule, nil
+	}
+	args := make([]float64, 0, len(parts)-1)
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, g.NewErrorf("invalid %s=%s, error: %s", PropertyTargetSchedule, propStr, err)
+		}
+		args = append(args, v)
+	}
+	var schedule TargetSchedule
+	var err error
+	switch {
+	case (parts[0] == "ramp") && (len(args) == 3):
+		schedule, err = NewRampTargetSchedule(args[0], args[1], args[2])
+	case (parts[0] == "step") && (len(args) == 3):
+		schedule, err = NewStepTargetSchedule(args[0], args[1], args[2], 0)
+	case (parts[0] == "step") && (len(args) == 4):
+		schedule, err = NewStepTargetSchedule(args[0], args[1], args[2], args[3])
+	case (parts[0] == "sine") && (len(args) == 3):
+		schedule, err = NewSineTargetSchedule(args[0], args[1], args[2])
+	default:
+		err = g.NewErrorf("invalid %s=%s", PropertyTargetSchedule, propStr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// A schedule of the constant target throughput.
+type ConstantTargetSchedule struct {
+	target float64
+}
+
+func NewConstantTargetSchedule(target float64) *ConstantTargetSchedule {
+	return &ConstantTargetSchedule{
+		target: target,
+	}
+}
+
+func (self *ConstantTargetSchedule) TargetAt(elapsed int64) float64 {
+	return self.target
+}
+
+// A schedule of the target throughput which increases(or decreases)
+// linearly from one to another over a period, and then stays.
+type RampTargetSchedule struct {
+	from     float64
+	to       float64
+	periodNS float64
+}
+
+func NewRampTargetSchedule(from, to, seconds float64) (*RampTargetSchedule, error) {
+	if (from < 0) || (to <= 0) || (seconds <= 0) {
+		return nil, g.NewErrorf("invalid ramp schedule from %v to %v over %v seconds", from, to, seconds)
+	}
+	return &RampTargetSchedule{
+		from:     from,
+		to:       to,
+		periodNS: seconds * float64(SecondToNanosecond(1)),
+	}, nil
+}
+
+func (self *RampTargetSchedule) TargetAt(elapsed int64) float64 {
+	if float64(elapsed) >= self.periodNS {
+		return self.to
+	}
+	return self.from + (self.to-self.from)*float64(elapsed)/self.periodNS
+}
+
+// A schedule of the target throughput which increases by a step
+// every interval, up to an optional maximum.
+type StepTargetSchedule struct {
+	start      float64
+	increment  float64
+	intervalNS int64
+	max        float64
+}
+
+func NewStepTargetSchedule(start, increment, seconds, max float64) (*StepTargetSchedule, error) {
+	if (start <= 0) || (increment < 0) || (seconds <= 0) || (max < 0) {
+		return nil, g.NewErrorf("invalid step schedule start %v increment %v every %v seconds up to %v",
+			start, increment, seconds, max)
+	}
+	return &StepTargetSchedule{
+		start:      start,
+		increment:  increment,
+		intervalNS: int64(seconds * float64(SecondToNanosecond(1))),
+		max:        max,
+	}, nil
+}
+
+func (self *StepTargetSchedule) TargetAt(elapsed int64) float64 {
+	target := self.start + self.increment*float64(elapsed/self.intervalNS)
+	if (self.max > 0) && (target > self.max) {
+		return self.max
+	}
+	return target
+}
+
+// A schedule of the target throughput which follows a sine wave, e.g.
+// the diurnal pattern of traffic. The target is 0 when the wave is below 0.
+type SineTargetSchedule struct {
+	mean      float64
+	amplitude float64
+	periodNS  float64
+}
+
+func NewSineTargetSchedule(mean, amplitude, seconds float64) (*SineTargetSchedule, error) {
+	if (mean <= 0) || (amplitude < 0) || (seconds <= 0) {
+		return nil, g.NewErrorf("invalid sine schedule mean %v amplitude %v period %v seconds", mean, amplitude, seconds)
+	}
+	return &SineTargetSchedule{
+		mean:      mean,
+		amplitude: amplitude,
+		periodNS:  seconds * float64(SecondToNanosecond(1)),
+	}, nil
+}
+
+func (self *SineTargetSchedule) TargetAt(elapsed int64) float64 {
+	target := self.mean + self.amplitude*math.Sin(2*math.Pi*float64(elapsed)/self.periodNS)
+	if target < 0 {
+		return 0
+	}
+	return target
+}
+
+type targetPoint struct {
+	elapsed int64
+	target  float64
+}
+
+// A schedule of the target throughput given by a list of points in time.
+// The target of each point holds until the next point, and the target of
+// the last point holds forever.
+type CSVTargetSchedule struct {
+	points []targetPoint
+}
+
+// Load the schedule from a file of the lines "second,ops/sec".
+// Blank lines and the lines starting with '#' are ignored.
+func LoadCSVTargetSchedule(fileName string) (*CSVTargetSchedule, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	points := make([]targetPoint, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if (len(line) == 0) || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) != 2 {
+			return nil, g.NewErrorf("invalid line in schedule file %s: %s", fileName, line)
+		}
+		second, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		if err != nil {
+			return nil, g.NewErrorf("invalid line in schedule file %s: %s", fileName, line)
+		}
+		target, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if (err != nil) || (target < 0) {
+			return nil, g.NewErrorf("invalid line in schedule file %s: %s", fileName, line)
+		}
+		points = append(points, targetPoint{
+			elapsed: int64(second * float64(SecondToNanosecond(1))),
+			target:  target,
+		})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return newCSVTargetSchedule(points)
+}
+
+func newCSVTargetSchedule(points []targetPoint) (*CSVTargetSchedule, error) {
+	if len(points) == 0 {
+		return nil, g.NewErrorf("empty schedule")
+	}
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].elapsed < points[j].elapsed
+	})
+	if points[len(points)-1].target <= 0 {
+		return nil, g.NewErrorf("the last target of schedule should be positive")
+	}
+	return &CSVTargetSchedule{
+		points: points,
+	}, nil
+}
+
+func (self *CSVTargetSchedule) TargetAt(elapsed int64) float64 {
+	// find the last point not after elapsed
+	i := sort.Search(len(self.points), func(i int) bool {
+		return self.points[i].elapsed > elapsed
+	})
+	if i == 0 {
+		return self.points[0].target
+	}
+	return self.points[i-1].target
+}
+
+// A schedule which is a fraction of another one, e.g. the share of
+// one client routine.
+type ScaledTargetSchedule struct {
+	TargetSchedule
+	factor float64
+}
+
+func NewScaledTargetSchedule(schedule TargetSchedule, factor float64) *ScaledTargetSchedule {
+	return &ScaledTargetSchedule{
+		TargetSchedule: schedule,
+		factor:         factor,
+	}
+}
+
+func (self *ScaledTargetSchedule) TargetAt(elapsed int64) float64 {
+	return self.TargetSchedule.TargetAt(elapsed) * self.factor
+}
+
+// The step to skip forward when the target throughput is 0.
+var scheduleIdleStepNS = MillisecondToNanosecond(10)
+
+// Return the time of the operation following the one at elapsed, both in
+// nanoseconds since the start of the run. The interval between them is
+// returned by intervalOf() given the target at elapsed. The periods when
+// the target is 0 are skipped.
+// All the schedules end with a positive target, so it always returns.
+func NextScheduledTime(schedule TargetSchedule, elapsed int64, intervalOf func(target float64) int64) int64 {
+	for {
+		target := schedule.TargetAt(elapsed)
+		if target > 0 {
+			return elapsed + intervalOf(target)
+		}
+		elapsed += scheduleIdleStepNS
+	}
+}
+
+// Return the constant interval in nanoseconds between the operations
+// at the target throughput.
+func ConstantInterval(target float64) int64 {
+	return int64(float64(SecondToNanosecond(1)) / target)
+}
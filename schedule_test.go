@@ -0,0 +1,75 @@
+package yabf
+
+import (
+	"github.com/hhkbp2/testify/require"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTargetSchedule(t *testing.T) {
+	second := SecondToNanosecond(1)
+
+	props := NewProperties()
+	s, err := NewTargetSchedule(props)
+	require.Nil(t, err)
+	require.Nil(t, s)
+
+	props.Add(PropertyTarget, "100")
+	s, err = NewTargetSchedule(props)
+	require.Nil(t, err)
+	require.Equal(t, float64(100), s.TargetAt(10*second))
+
+	props.Add(PropertyTargetSchedule, "ramp:0:1000:10")
+	s, err = NewTargetSchedule(props)
+	require.Nil(t, err)
+	require.Equal(t, float64(0), s.TargetAt(0))
+	require.Equal(t, float64(500), s.TargetAt(5*second))
+	require.Equal(t, float64(1000), s.TargetAt(20*second))
+
+	props.Add(PropertyTargetSchedule, "step:100:50:10:200")
+	s, err = NewTargetSchedule(props)
+	require.Nil(t, err)
+	require.Equal(t, float64(100), s.TargetAt(9*second))
+	require.Equal(t, float64(150), s.TargetAt(10*second))
+	require.Equal(t, float64(200), s.TargetAt(100*second))
+
+	props.Add(PropertyTargetSchedule, "sine:100:50:40")
+	s, err = NewTargetSchedule(props)
+	require.Nil(t, err)
+	require.InDelta(t, float64(100), s.TargetAt(0), 0.001)
+	require.InDelta(t, float64(150), s.TargetAt(10*second), 0.001)
+	require.InDelta(t, float64(50), s.TargetAt(30*second), 0.001)
+
+	f, err := ioutil.TempFile("", "schedule")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# second,ops/sec\n0,100\n\n10,300\n5,200\n")
+	require.Nil(t, err)
+	f.Close()
+	props.Add(PropertyTargetSchedule, "csv:"+f.Name())
+	s, err = NewTargetSchedule(props)
+	require.Nil(t, err)
+	require.Equal(t, float64(100), s.TargetAt(4*second))
+	require.Equal(t, float64(200), s.TargetAt(5*second))
+	require.Equal(t, float64(300), s.TargetAt(60*second))
+
+	for _, v := range []string{"ramp:0:0:10", "step:100", "sine:0:10:10", "unknown:1", "csv:/nonexistent"} {
+		props.Add(PropertyTargetSchedule, v)
+		s, err = NewTargetSchedule(props)
+		require.NotNil(t, err, v)
+		require.Nil(t, s, v)
+	}
+}
+
+func TestNextScheduledTime(t *testing.T) {
+	second := SecondToNanosecond(1)
+	s, err := NewRampTargetSchedule(0, 1000, 10)
+	require.Nil(t, err)
+	// the period of target 0 is skipped
+	next := NextScheduledTime(s, 0, ConstantInterval)
+	require.True(t, next > 0)
+	require.True(t, next < 2*second)
+	next = NextScheduledTime(s, 20*second, ConstantInterval)
+	require.Equal(t, 20*second+MillisecondToNanosecond(1), next)
+}
@@ -0,0 +1,170 @@
+package yabf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A client which searches for the highest target throughput the database
+// could sustain, i.e. the achieved throughput keeps up with the target and
+// the latency at the percentile stays under the SLO.
+// It runs the transaction phase in successive short steps, and bisects
+// on the target between "search.min" and "search.max".
+type Searcher struct {
+	*ClientBase
+}
+
+func NewSearcher(args *Arguemnts) *Searcher {
+	object := &Searcher{
+		ClientBase: NewClientBase(args),
+	}
+	object.DoTransactions = true
+	return object
+}
+
+// The result of one step of search.
+type searchStep struct {
+	target     int64
+	throughput float64
+	// the highest latency at the percentile among the operations checked
+	latency     int64
+	operation   string
+	sustainable bool
+}
+
+type searchOptions struct {
+	stepTime   string
+	percentile float64
+	latency    int64
+	operations []string
+	tolerance  float64
+}
+
+func parseSearchInt(props Properties, name, defaultValue string) int64 {
+	propStr := props.GetDefault(name, defaultValue)
+	v, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil || (v <= 0) {
+		ExitOnError("invalid property %s=%s, should be positive integer", name, propStr)
+	}
+	return v
+}
+
+func parseSearchFloat(props Properties, name, defaultValue string) float64 {
+	propStr := props.GetDefault(name, defaultValue)
+	v, err := strconv.ParseFloat(propStr, 64)
+	if err != nil || (v < 0) {
+		ExitOnError("invalid property %s=%s, should be non-negative number", name, propStr)
+	}
+	return v
+}
+
+func (self *Searcher) Main() {
+	self.CheckProperties()
+
+	props := self.Args.Properties
+	min := parseSearchInt(props, PropertySearchMin, PropertySearchMinDefault)
+	max := parseSearchInt(props, PropertySearchMax, PropertySearchMaxDefault)
+	resolution := parseSearchInt(props, PropertySearchResolution, PropertySearchResolutionDefault)
+	stepTime := parseSearchInt(props, PropertySearchStepTime, PropertySearchStepTimeDefault)
+	if min > max {
+		ExitOnError("%s=%d should not be greater than %s=%d", PropertySearchMin, min, PropertySearchMax, max)
+	}
+	options := &searchOptions{
+		stepTime:   strconv.FormatInt(stepTime, 10),
+		percentile: parseSearchFloat(props, PropertySearchPercentile, PropertySearchPercentileDefault),
+		latency:    parseSearchInt(props, PropertySearchLatency, PropertySearchLatencyDefault),
+		tolerance:  parseSearchFloat(props, PropertySearchTolerance, PropertySearchToleranceDefault),
+	}
+	propStr := props.GetDefault(PropertySearchOperations, PropertySearchOperationsDefault)
+	if len(propStr) > 0 {
+		options.operations = strings.Split(propStr, ",")
+	}
+
+	steps := make([]*searchStep, 0)
+	sustainable := func(target int64) bool {
+		step := self.runStep(props, target, options)
+		steps = append(steps, step)
+		Printf("search step %d: target %d ops/sec, throughput %.2f ops/sec, %gth percentile latency %d us, sustainable: %t",
+			len(steps), step.target, step.throughput, options.percentile, step.latency, step.sustainable)
+		return step.sustainable
+	}
+	best := searchTarget(min, max, resolution, sustainable)
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("%-6s %-12s %-20s %-24s %-20s %s\n",
+		"Step", "Target", "Throughput(ops/sec)",
+		fmt.Sprintf("%gthPercentile(us)", options.percentile), "Operation", "Sustainable"))
+	for i, step := range steps {
+		buf.WriteString(fmt.Sprintf("%-6d %-12d %-20.2f %-24d %-20s %t\n",
+			i+1, step.target, step.throughput, step.latency, step.operation, step.sustainable))
+	}
+	Printf(buf.String())
+	if best > 0 {
+		Printf("Highest sustainable throughput: %d ops/sec", best)
+	} else {
+		Printf("No sustainable throughput found, even at %s=%d", PropertySearchMin, min)
+	}
+}
+
+// Return the highest target in [min, max] which is sustainable,
+// within resolution, or 0 if even min is not.
+func searchTarget(min, max, resolution int64, sustainable func(target int64) bool) int64 {
+	if !sustainable(min) {
+		return 0
+	}
+	if sustainable(max) {
+		return max
+	}
+	lo, hi := min, max
+	for hi-lo > resolution {
+		mid := lo + (hi-lo)/2
+		if sustainable(mid) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// Run the workload at the target for one step, with fresh measurements.
+func (self *Searcher) runStep(props Properties, target int64, options *searchOptions) *searchStep {
+	stepProps := NewProperties().Merge(props)
+	delete(stepProps, PropertyTargetSchedule)
+	stepProps.Add(PropertyTarget, strconv.FormatInt(target, 10))
+	stepProps.Add(PropertyMaxExecutionTime, options.stepTime)
+	stepProps.Add(PropertyOperationCount, "0")
+	// the percentiles are taken from the HdrHistogram
+	stepProps.Add(PropertyMeasurementType, "hdrhistogram")
+
+	ResetMeasurements()
+	result := self.Run(stepProps)
+	step := &searchStep{
+		target:     target,
+		throughput: result.Throughput(),
+	}
+	measurements := GetMeasurements()
+	operations := options.operations
+	if len(operations) == 0 {
+		operations = measurements.Operations()
+	}
+	for _, op := range operations {
+		if op == "CLEANUP" {
+			continue
+		}
+		m, ok := measurements.Lookup(op).(*OneMeasurementHdrHistogram)
+		if !ok {
+			continue
+		}
+		latency := m.ValueAtPercentile(options.percentile)
+		if latency >= step.latency {
+			step.latency = latency
+			step.operation = op
+		}
+	}
+	step.sustainable = (step.throughput >= float64(target)*(1-options.tolerance)) &&
+		(step.latency <= options.latency)
+	return step
+}
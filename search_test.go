@@ -0,0 +1,89 @@
+package yabf
+
+import (
+	"github.com/hhkbp2/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearchTarget(t *testing.T) {
+	tried := make([]int64, 0)
+	sustainable := func(limit int64) func(int64) bool {
+		tried = tried[:0]
+		return func(target int64) bool {
+			tried = append(tried, target)
+			return target <= limit
+		}
+	}
+	best := searchTarget(100, 1000, 10, sustainable(733))
+	require.True(t, (best > 723) && (best <= 733), best)
+	require.Equal(t, []int64{100, 1000, 550}, tried[:3])
+	require.Equal(t, int64(1000), searchTarget(100, 1000, 10, sustainable(2000)))
+	require.Equal(t, []int64{100, 1000}, tried)
+	require.Equal(t, int64(0), searchTarget(100, 1000, 10, sustainable(50)))
+	require.Equal(t, []int64{100}, tried)
+}
+
+// Return the number of the files under dir opened by this process,
+// or -1 if it's unknown.
+func countOpenFiles(dir string) int {
+	links, err := filepath.Glob("/proc/self/fd/*")
+	if (err != nil) || (len(links) == 0) {
+		return -1
+	}
+	count := 0
+	for _, link := range links {
+		if path, err := os.Readlink(link); (err == nil) && strings.HasPrefix(path, dir) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestSearcherStep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	resetMemoryTables()
+	defer func() {
+		SetMeasurementProperties(NewProperties())
+		ResetMeasurements()
+	}()
+	props := NewProperties()
+	props.Add(PropertyWorkload, "CoreWorkload")
+	props.Add(PropertyDB, "faulty")
+	props.Add(PropertyFaultyDB, "memory")
+	props.Add(PropertyRecordCount, "0")
+	props.Add(PropertyReadProportion, "0")
+	props.Add(PropertyUpdateProportion, "0")
+	props.Add(PropertyInsertProportion, "1")
+	props.Add(PropertyHdrHistogramOutput, "true")
+	props.Add(PropertyHdrHistogramOutputPath, dir+"/")
+	searcher := NewSearcher(&Arguemnts{Command: "search", Properties: props})
+	options := &searchOptions{
+		stepTime:   "1",
+		percentile: 99,
+		latency:    5000,
+		operations: []string{"INSERT"},
+		tolerance:  0.2,
+	}
+	step := searcher.runStep(props, 100, options)
+	require.True(t, step.sustainable)
+	require.Equal(t, "INSERT", step.operation)
+	require.True(t, step.throughput >= 80)
+
+	// the latency of the operations breaks the SLO
+	props.Add(PropertyFaultyLatency, "constant:10000")
+	resetMemoryTables()
+	step = searcher.runStep(props, 100, options)
+	require.False(t, step.sustainable)
+	require.True(t, step.latency >= 10000)
+
+	// the log files of the steps are closed when they are discarded
+	ResetMeasurements()
+	count := countOpenFiles(dir)
+	require.True(t, count <= 0, count)
+}
@@ -0,0 +1,196 @@
+package yabf
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codahale/hdrhistogram"
+	g "github.com/hhkbp2/yabf/generator"
+)
+
+// A HdrHistogram measurement of a metric, which also keeps the histogram and
+// the error count of the current interval, for TimeSeriesStreamer to take
+// every interval.
+type OneMeasurementHdrTimeSeries struct {
+	*OneMeasurementHdrHistogram
+	intervalLock      sync.Mutex
+	currentHistogram  *hdrhistogram.Histogram
+	currentErrorCount int64
+}
+
+func NewOneMeasurementHdrTimeSeries(name string, props Properties) (*OneMeasurementHdrTimeSeries, error) {
+	m, err := NewOneMeasurementHdrHistogram(name, props)
+	if err != nil {
+		return nil, err
+	}
+	return &OneMeasurementHdrTimeSeries{
+		OneMeasurementHdrHistogram: m,
+		currentHistogram:           newIntervalHistogram(m.histogram),
+	}, nil
+}
+
+func newIntervalHistogram(h *hdrhistogram.Histogram) *hdrhistogram.Histogram {
+	return hdrhistogram.New(h.LowestTrackableValue(), h.HighestTrackableValue(), int(h.SignificantFigures()))
+}
+
+func (self *OneMeasurementHdrTimeSeries) Measure(latency int64) {
+	self.OneMeasurementHdrHistogram.Measure(latency)
+	self.intervalLock.Lock()
+	defer self.intervalLock.Unlock()
+	self.currentHistogram.RecordValue(latency)
+}
+
+// Report a return code, which is counted as an error unless it's OK.
+func (self *OneMeasurementHdrTimeSeries) ReportStatus(status StatusType) {
+	self.OneMeasurementHdrHistogram.ReportStatus(status)
+	if status != StatusOK {
+		self.intervalLock.Lock()
+		defer self.intervalLock.Unlock()
+		self.currentErrorCount++
+	}
+}
+
+// Return the histogram and the error count of the interval since the last
+// call, and start a new interval.
+func (self *OneMeasurementHdrTimeSeries) takeInterval() (*hdrhistogram.Histogram, int64) {
+	self.intervalLock.Lock()
+	defer self.intervalLock.Unlock()
+	h := self.currentHistogram
+	errorCount := self.currentErrorCount
+	self.currentHistogram = newIntervalHistogram(h)
+	self.currentErrorCount = 0
+	return h, errorCount
+}
+
+// The header of the time series files written by TimeSeriesStreamer.
+var TimeSeriesHeader = []string{
+	"timestamp", "operation", "count", "throughput", "min", "mean",
+	"p50", "p95", "p99", "p99.9", "max", "errors",
+}
+
+var (
+	// the time series files opened by this process, which are appended to
+	// instead of being overwritten, e.g. by the phases of a plan
+	timeSeriesFiles     = make(map[string]bool)
+	timeSeriesFilesLock sync.Mutex
+)
+
+// A routine which streams the time series of all the operations to a CSV
+// file as the run progresses. Every interval, it takes the histogram of
+// every operation in the interval, and writes a row of the end time(in
+// milliseconds since epoch), the operation, the count, the throughput, the
+// latencies(in microseconds) and the error count of it.
+type TimeSeriesStreamer struct {
+	measurements *DefaultMeasurements
+	file         *os.File
+	writer       *csv.Writer
+	interval     time.Duration
+	lastTime     int64
+	stopCh       chan int
+	doneCh       chan int
+	stopOnce     sync.Once
+}
+
+func NewTimeSeriesStreamer(measurements *DefaultMeasurements, props Properties) (*TimeSeriesStreamer, error) {
+	propStr := props.GetDefault(PropertyGranularity, PropertyGranularityDefault)
+	granularity, err := strconv.ParseInt(propStr, 0, 64)
+	if (err != nil) || (granularity <= 0) {
+		return nil, g.NewErrorf("invalid property %s=%s, should be positive integer", PropertyGranularity, propStr)
+	}
+	fileName := props.GetDefault(PropertyTimeSeriesFile, PropertyTimeSeriesFileDefault)
+	timeSeriesFilesLock.Lock()
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if timeSeriesFiles[fileName] {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(fileName, flag, 0666)
+	if err == nil {
+		timeSeriesFiles[fileName] = true
+	}
+	timeSeriesFilesLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	object := &TimeSeriesStreamer{
+		measurements: measurements,
+		file:         f,
+		writer:       csv.NewWriter(f),
+		interval:     time.Duration(granularity) * time.Millisecond,
+		lastTime:     NowMS(),
+		stopCh:       make(chan int),
+		doneCh:       make(chan int),
+	}
+	if !isNonEmptyFile(f) {
+		object.writer.Write(TimeSeriesHeader)
+		object.writer.Flush()
+	}
+	return object, nil
+}
+
+func (self *TimeSeriesStreamer) run() {
+	defer close(self.doneCh)
+	ticker := time.NewTicker(self.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-self.stopCh:
+			return
+		case <-ticker.C:
+			if err := self.writeInterval(NowMS()); err != nil {
+				EPrintf("fail to write time series, error: %s", err)
+			}
+		}
+	}
+}
+
+// Write the rows of all the operations in the interval ending at now.
+func (self *TimeSeriesStreamer) writeInterval(now int64) error {
+	elapsed := now - self.lastTime
+	self.lastTime = now
+	timestamp := strconv.FormatInt(now, 10)
+	for _, op := range self.measurements.Operations() {
+		m, ok := self.measurements.Lookup(op).(*OneMeasurementHdrTimeSeries)
+		if !ok {
+			continue
+		}
+		h, errorCount := m.takeInterval()
+		var throughput float64
+		if elapsed > 0 {
+			throughput = float64(h.TotalCount()) * 1000.0 / float64(elapsed)
+		}
+		self.writer.Write([]string{
+			timestamp,
+			op,
+			strconv.FormatInt(h.TotalCount(), 10),
+			strconv.FormatFloat(throughput, 'f', 2, 64),
+			strconv.FormatInt(h.Min(), 10),
+			strconv.FormatFloat(h.Mean(), 'f', 2, 64),
+			strconv.FormatInt(h.ValueAtQuantile(50), 10),
+			strconv.FormatInt(h.ValueAtQuantile(95), 10),
+			strconv.FormatInt(h.ValueAtQuantile(99), 10),
+			strconv.FormatInt(h.ValueAtQuantile(99.9), 10),
+			strconv.FormatInt(h.Max(), 10),
+			strconv.FormatInt(errorCount, 10),
+		})
+	}
+	// flush every interval so that the rows survive a crash
+	self.writer.Flush()
+	return self.writer.Error()
+}
+
+// Stop the routine, write the last interval and close the file.
+// It's safe to be called more than once.
+func (self *TimeSeriesStreamer) stop() (err error) {
+	self.stopOnce.Do(func() {
+		close(self.stopCh)
+		<-self.doneCh
+		err = self.writeInterval(NowMS())
+		if err2 := self.file.Close(); err == nil {
+			err = err2
+		}
+	})
+	return
+}
@@ -0,0 +1,73 @@
+package yabf
+
+import (
+	"encoding/csv"
+	"github.com/hhkbp2/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeSeriesStreamer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "timeseries")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "timeseries.csv")
+	props := NewProperties()
+	props.Add(PropertyMeasurementType, "hdrtimeseries")
+	props.Add(PropertyGranularity, "100")
+	props.Add(PropertyTimeSeriesFile, fileName)
+	SetMeasurementProperties(props)
+	ResetMeasurements()
+	defer func() {
+		SetMeasurementProperties(NewProperties())
+		ResetMeasurements()
+	}()
+
+	measurements := GetMeasurements()
+	for i := int64(1); i <= 100; i++ {
+		measurements.Measure("READ", i)
+		measurements.ReportStatus("READ", StatusOK)
+	}
+	time.Sleep(250 * time.Millisecond)
+	// the rows are streamed before the end of the run
+	data, err := ioutil.ReadFile(fileName)
+	require.Nil(t, err)
+	require.True(t, len(strings.Split(strings.TrimSpace(string(data)), "\n")) >= 2)
+	measurements.Measure("READ", 1000)
+	measurements.ReportStatus("READ", StatusError)
+	measurements.Measure("UPDATE", 10)
+	measurements.ReportStatus("UPDATE", StatusOK)
+	require.Nil(t, measurements.ExportMeasurements(NewTextMeasurementExporter(nopWriteCloser{&strings.Builder{}})))
+
+	// the file is appended to by the measurements after reset
+	ResetMeasurements()
+	GetMeasurements().Measure("INSERT", 10)
+	ResetMeasurements()
+
+	f, err := os.Open(fileName)
+	require.Nil(t, err)
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	require.Nil(t, err)
+	require.Equal(t, TimeSeriesHeader, records[0])
+	require.Equal(t, []string{"READ", "100", "1", "50.50", "50", "95", "99", "100", "100", "0"},
+		append(records[1][1:3], records[1][4:]...))
+	counts := make(map[string]int64)
+	errorCounts := make(map[string]int64)
+	for _, record := range records[1:] {
+		require.Equal(t, len(TimeSeriesHeader), len(record))
+		count, err := strconv.ParseInt(record[2], 10, 64)
+		require.Nil(t, err)
+		counts[record[1]] += count
+		errorCount, err := strconv.ParseInt(record[11], 10, 64)
+		require.Nil(t, err)
+		errorCounts[record[1]] += errorCount
+	}
+	require.Equal(t, map[string]int64{"READ": 101, "UPDATE": 1, "INSERT": 1}, counts)
+	require.Equal(t, int64(1), errorCounts["READ"])
+}
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"os"
 	"regexp"
+	"strconv"
 	"time"
 )
 
@@ -44,8 +45,21 @@ var (
 )
 
 func init() {
-	regexIgnorable = regexp.MustCompile(`\s*(#.*)?`)
-	regexProperty = regexp.MustCompile(`\s*([\d.]+)\s*=\s*([\d.]+)\s*`)
+	regexIgnorable = regexp.MustCompile(`^\s*(#.*)?$`)
+	regexProperty = regexp.MustCompile(`^\s*([^=\s]+)\s*=\s*(.*?)\s*$`)
+}
+
+// Parse a line of properties file, which is either ignorable(blank or
+// comment), or in "key=value" form.
+func parsePropertyLine(line string) (key, value string, ignorable bool, ok bool) {
+	if regexIgnorable.MatchString(line) {
+		return "", "", true, true
+	}
+	parts := regexProperty.FindStringSubmatch(line)
+	if parts == nil {
+		return "", "", false, false
+	}
+	return parts[1], parts[2], false, true
 }
 
 func LoadProperties(fileName string) (Properties, error) {
@@ -58,14 +72,14 @@ func LoadProperties(fileName string) (Properties, error) {
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if regexIgnorable.MatchString(line) {
+		key, value, ignorable, ok := parsePropertyLine(line)
+		if ignorable {
 			continue
 		}
-		parts := regexIgnorable.FindAllString(line, -1)
-		if parts == nil {
+		if !ok {
 			return ret, g.NewErrorf("invalid workload file: %s, line: %s", fileName, line)
 		}
-		ret.Add(parts[0], parts[1])
+		ret.Add(key, value)
 	}
 	return ret, scanner.Err()
 }
@@ -92,6 +106,10 @@ func MillisecondToNanosecond(millis int64) int64 {
 	return millis * 1000 * 1000
 }
 
+func MicrosecondToNanosecond(micros int64) int64 {
+	return micros * 1000
+}
+
 func MillisecondToSecond(millis int64) int64 {
 	return millis / 1000
 }
@@ -112,9 +130,8 @@ const (
 	RandomBytesLength = 6
 )
 
-func makeRandomBytes() []byte {
+func makeRandomBytes(r *rand.Rand) []byte {
 	buf := make([]byte, RandomBytesLength)
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	v := r.Int63()
 	buf[0] = byte(' ' + (v & 31))
 	buf[1] = byte(' ' + ((v >> 5) & 63))
@@ -126,10 +143,16 @@ func makeRandomBytes() []byte {
 }
 
 func RandomBytes(length int64) []byte {
+	return RandomBytesFrom(rand.New(rand.NewSource(time.Now().UnixNano())), length)
+}
+
+// Return random printable bytes of the length, drawing from the random
+// source r.
+func RandomBytesFrom(r *rand.Rand, length int64) []byte {
 	ret := make([]byte, length)
 	addSize := int64(0)
 	for i := int64(0); i < length; i += addSize {
-		b := makeRandomBytes()
+		b := makeRandomBytes(r)
 		addSize = int64(len(b))
 		for j := int64(0); (j < addSize) && (i+j < length); j++ {
 			ret[i+j] = b[j]
@@ -137,3 +160,46 @@ func RandomBytes(length int64) []byte {
 	}
 	return ret
 }
+
+// Return the seed of the stream-th random stream derived from seed. It's
+// scrambled by the finalizer of SplitMix64, so that the streams of
+// consecutive seeds or stream numbers are not correlated.
+func deriveSeed(seed, stream int64) int64 {
+	z := uint64(seed) + uint64(stream+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// Parse the "seed" property, and return false if it's not set.
+func parseSeed(props Properties) (int64, bool, error) {
+	propStr := props.Get(PropertySeed)
+	if len(propStr) == 0 {
+		return 0, false, nil
+	}
+	seed, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return 0, false, g.NewErrorf("invalid property %s=%s, should be integer", PropertySeed, propStr)
+	}
+	return seed, true, nil
+}
+
+// Return the random source of the stream-th client routine. It's derived
+// from the "seed" property if it's set, so that the same seed always gives
+// the same streams, otherwise it's seeded by the time.
+func NewRandomStream(props Properties, stream int64) (*rand.Rand, error) {
+	seed, ok, err := parseSeed(props)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		seed = time.Now().UnixNano()
+	}
+	return rand.New(rand.NewSource(deriveSeed(seed, stream))), nil
+}
+
+// Return a new random source seeded from r, for the one which draws
+// independently of r, e.g. in another routine.
+func newChildRandom(r *rand.Rand) *rand.Rand {
+	return rand.New(rand.NewSource(r.Int63()))
+}
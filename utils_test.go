@@ -2,6 +2,8 @@ package yabf
 
 import (
 	"github.com/hhkbp2/testify/require"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 )
@@ -23,6 +25,23 @@ func TestProperties(t *testing.T) {
 	require.Equal(t, v1, z)
 }
 
+func TestLoadProperties(t *testing.T) {
+	f, err := ioutil.TempFile("", "properties")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("# comment\n\nrecordcount=1000\n  readproportion = 0.5  \ntable=test.test\n")
+	require.Nil(t, err)
+	f.Close()
+	p, err := LoadProperties(f.Name())
+	require.Nil(t, err)
+	require.Equal(t, Properties{"recordcount": "1000", "readproportion": "0.5", "table": "test.test"}, p)
+
+	p, err = LoadProperties("workloads/workloada")
+	require.Nil(t, err)
+	require.Equal(t, "CoreWorkload", p.Get(PropertyWorkload))
+	require.Equal(t, "zipfian", p.Get(PropertyRequestDistribution))
+}
+
 func TestNSToDuration(t *testing.T) {
 	now := time.Now()
 	later := now.Add(time.Second)
@@ -52,3 +71,22 @@ func TestRandomBytes(t *testing.T) {
 	require.Equal(t, length, int64(len(b2)))
 	require.NotEqual(t, b1, b2)
 }
+
+func TestNewRandomStream(t *testing.T) {
+	props := NewProperties()
+	props.Add(PropertySeed, "42")
+	r1, err := NewRandomStream(props, 0)
+	require.Nil(t, err)
+	r2, err := NewRandomStream(props, 0)
+	require.Nil(t, err)
+	r3, err := NewRandomStream(props, 1)
+	require.Nil(t, err)
+	v := r1.Int63()
+	require.Equal(t, v, r2.Int63())
+	require.NotEqual(t, v, r3.Int63())
+	require.Equal(t, RandomBytesFrom(r1, 100), RandomBytesFrom(r2, 100))
+
+	props.Add(PropertySeed, "abc")
+	_, err = NewRandomStream(props, 0)
+	require.NotNil(t, err)
+}
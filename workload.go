@@ -25,6 +25,9 @@ func init() {
 		"ConstantOccupancyWorkload": func() Workload {
 			return NewConstantOccupancyWorkload()
 		},
+		"ClosedEconomyWorkload": func() Workload {
+			return NewClosedEconomyWorkload()
+		},
 	}
 }
 
@@ -61,7 +64,10 @@ type Workload interface {
 	// If you have no state to retain for this routine, return null.
 	// (But if you have no state to retain for this routine, probably
 	// you don't need to override this function.)
-	InitRoutine(p Properties) (interface{}, error)
+	// The random source is owned by this routine. All the random choices of
+	// the routine should be drawn from it rather than a shared one, so that
+	// the run could be replayed with the "seed" property.
+	InitRoutine(p Properties, random *rand.Rand) (interface{}, error)
 
 	// Cleanup the scenario.
 	// Called once, in the main client routine, after all operations
@@ -87,6 +93,16 @@ type Workload interface {
 	DoTransaction(db DB, object interface{}) bool
 }
 
+// BatchWorkload is an optional extension of Workload for the workloads
+// which could insert a batch of records in one operation.
+type BatchWorkload interface {
+	// Do one batched insert operation of at most count records, or
+	// a full batch if count is 0. The same as DoInsert(), it must be
+	// routine safe.
+	// Return the number of records inserted and whether it succeeds.
+	DoBatchInsert(db DB, object interface{}, count int64) (int64, bool)
+}
+
 // CoreWorkload represents the core benchmark scenario.
 // It's a set of clients doing simple CRUD operations. The relative proportion
 // of different kinds of operations, and other properties of the workload,
@@ -105,6 +121,8 @@ type Workload interface {
 //   insertproportion: what proportion of operations should be inserts
 //                     (default: 0)
 //   scanproportion: what proportion of operations should be scans (default: 0)
+//   multireadproportion: what proportion of operations should be multi-gets of
+//                        batchsize records (default: 0)
 //   readmodifywriteproportion: what proportion of operations should be read a
 //                              record, modify it, write it back (default: 0)
 //   requestdistribution: what distribution should be used to select the records
@@ -118,6 +136,16 @@ type Workload interface {
 //                           (default: uniform)
 //   insertorder: should records be inserted in order by key ("ordered"), or in
 //                hashed order ("hashed") (default: hashed)
+//   batchsize: the number of records to insert in one operation during load,
+//              and to read in one multi-get (default: 1)
+//   transactional: should every transaction bundle a number of reads and
+//                  writes in one database transaction (true), instead of
+//                  doing one operation (false). The read and update
+//                  proportions are replaced by the following two, and
+//                  the proportions of the other operations must be 0
+//                  (default: false)
+//   transactionreads: the number of reads in one transaction (default: 1)
+//   transactionwrites: the number of writes in one transaction (default: 1)
 type CoreWorkload struct {
 	table      string
 	fieldCount int64
@@ -140,6 +168,10 @@ type CoreWorkload struct {
 	recordCount                  int64
 	insertionRetryLimit          int64
 	insertionRetryInterval       int64
+	batchSize                    int64
+	transactional                bool
+	transactionReads             int64
+	transactionWrites            int64
 	measurements                 Measurements
 }
 
@@ -194,6 +226,11 @@ func (self *CoreWorkload) Init(p Properties) error {
 	if err != nil {
 		return err
 	}
+	propStr = p.GetDefault(PropertyMultiReadProportion, PropertyMultiReadProportionDefault)
+	multiReadProportion, err := strconv.ParseFloat(propStr, 64)
+	if err != nil {
+		return err
+	}
 	propStr = p.GetDefault(PropertyRecordCount, PropertyRecordCountDefault)
 	recordCount, err := strconv.ParseInt(propStr, 0, 64)
 	if err != nil {
@@ -232,7 +269,7 @@ func (self *CoreWorkload) Init(p Properties) error {
 	propStr = p.GetDefault(PropertyFieldLengthDistribution, PropertyFieldLengthDistributionDefault)
 	isConstant := (propStr == "constant")
 	// Confirm that fieldLengthGenerator returns a constant if data integrity check requested.
-	if dataIntegrity && isConstant {
+	if dataIntegrity && !isConstant {
 		return g.NewErrorf("must have constant field size to check data integrity")
 	}
 	propStr = p.GetDefault(PropertyInsertOrder, PropertyInsertOrderDefault)
@@ -275,6 +312,9 @@ func (self *CoreWorkload) Init(p Properties) error {
 	if readModifyWriteProportion > 0 {
 		operationChooser.AddValue(readModifyWriteProportion, "READMODIFYWRITE")
 	}
+	if multiReadProportion > 0 {
+		operationChooser.AddValue(multiReadProportion, "MULTIREAD")
+	}
 
 	transactionInsertKeySequence := g.NewAcknowledgedCounterGenerator(recordCount)
 	switch requestDistrib {
@@ -341,6 +381,48 @@ func (self *CoreWorkload) Init(p Properties) error {
 	if err != nil {
 		return err
 	}
+	propStr = p.GetDefault(PropertyBatchSize, PropertyBatchSizeDefault)
+	batchSize, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return err
+	}
+	if batchSize < 1 {
+		return g.NewErrorf("invalid %s=%d, should be positive", PropertyBatchSize, batchSize)
+	}
+	propStr = p.GetDefault(PropertyTransactional, PropertyTransactionalDefault)
+	transactional, err := strconv.ParseBool(propStr)
+	if err != nil {
+		return err
+	}
+	propStr = p.GetDefault(PropertyTransactionReads, PropertyTransactionReadsDefault)
+	transactionReads, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return err
+	}
+	propStr = p.GetDefault(PropertyTransactionWrites, PropertyTransactionWritesDefault)
+	transactionWrites, err := strconv.ParseInt(propStr, 0, 64)
+	if err != nil {
+		return err
+	}
+	if (transactionReads < 0) || (transactionWrites < 0) || (transactionReads+transactionWrites == 0) {
+		return g.NewErrorf("invalid %s=%d and %s=%d, should be non-negative and not both zero",
+			PropertyTransactionReads, transactionReads, PropertyTransactionWrites, transactionWrites)
+	}
+	if transactional {
+		// a transaction bundles only reads and updates, the numbers of which
+		// are specified by transactionreads and transactionwrites
+		if (insertProportion > 0) || (scanProportion > 0) || (readModifyWriteProportion > 0) || (multiReadProportion > 0) {
+			return g.NewErrorf("%s=true only bundles reads and updates, but %s=%v, %s=%v, %s=%v, %s=%v",
+				PropertyTransactional, PropertyInsertProportion, insertProportion, PropertyScanProportion, scanProportion,
+				PropertyReadModifyWriteProportion, readModifyWriteProportion, PropertyMultiReadProportion, multiReadProportion)
+		}
+		for _, name := range []string{PropertyReadProportion, PropertyUpdateProportion} {
+			if _, ok := p[name]; ok {
+				Warnf("%s is ignored since %s=true, use %s and %s instead",
+					name, PropertyTransactional, PropertyTransactionReads, PropertyTransactionWrites)
+			}
+		}
+	}
 
 	// set all fields
 	self.table = table
@@ -361,6 +443,10 @@ func (self *CoreWorkload) Init(p Properties) error {
 	self.recordCount = recordCount
 	self.insertionRetryLimit = insertionRetryLimit
 	self.insertionRetryInterval = insertionRetryInterval
+	self.batchSize = batchSize
+	self.transactional = transactional
+	self.transactionReads = transactionReads
+	self.transactionWrites = transactionWrites
 	return nil
 }
 
@@ -391,9 +477,33 @@ func (self *CoreWorkload) getFieldLengthGenerator(p Properties) (g.IntegerGenera
 	return fieldLengthGenerator, nil
 }
 
-func (self *CoreWorkload) InitRoutine(p Properties) (interface{}, error) {
-	// nothing to do
-	return nil, nil
+// The state of a client routine of CoreWorkload. The routine draws from
+// generators of its own cloned from the ones of the workload, so that
+// the routines don't contend on them. The key sequences are shared.
+type coreRoutineState struct {
+	// the random source which all the choices of the routine draw from
+	random               *rand.Rand
+	fieldLengthGenerator g.IntegerGenerator
+	operationChooser     *g.DiscreteGenerator
+	keyChooser           g.IntegerGenerator
+	fieldChooser         g.IntegerGenerator
+	scanLengthChooser    g.IntegerGenerator
+}
+
+func (self *CoreWorkload) InitRoutine(p Properties, random *rand.Rand) (interface{}, error) {
+	return &coreRoutineState{
+		random:               random,
+		fieldLengthGenerator: self.fieldLengthGenerator.Clone(),
+		operationChooser:     self.operationChooser.Clone(),
+		keyChooser:           self.keyChooser.Clone(),
+		fieldChooser:         self.fieldChooser.Clone(),
+		scanLengthChooser:    self.scanLengthChooser.Clone(),
+	}, nil
+}
+
+// Return the routine state returned by InitRoutine().
+func routineState(object interface{}) *coreRoutineState {
+	return object.(*coreRoutineState)
 }
 
 func (self *CoreWorkload) Cleanup() error {
@@ -410,14 +520,14 @@ func (self *CoreWorkload) buildKeyName(keyNumber int64) string {
 }
 
 // Build a value for a randomly chosen field.
-func (self *CoreWorkload) buildSingleValue(key string) KVMap {
-	fieldKey := self.fieldNames[self.fieldChooser.NextInt()]
+func (self *CoreWorkload) buildSingleValue(state *coreRoutineState, key string) KVMap {
+	fieldKey := self.fieldNames[state.fieldChooser.NextIntFrom(state.random)]
 	var data []byte
 	if self.dataIntegrity {
-		data = self.buildDeterministicValue(key, fieldKey)
+		data = self.buildDeterministicValue(state, key, fieldKey)
 	} else {
 		// fill with random data
-		data = RandomBytes(self.fieldLengthGenerator.NextInt())
+		data = RandomBytesFrom(state.random, state.fieldLengthGenerator.NextIntFrom(state.random))
 	}
 	return KVMap{
 		fieldKey: data,
@@ -425,15 +535,15 @@ func (self *CoreWorkload) buildSingleValue(key string) KVMap {
 }
 
 // Build values for all fields.
-func (self *CoreWorkload) buildValues(key string) KVMap {
+func (self *CoreWorkload) buildValues(state *coreRoutineState, key string) KVMap {
 	ret := make(KVMap)
 	var data Binary
 	for _, fieldKey := range self.fieldNames {
 		if self.dataIntegrity {
-			data = self.buildDeterministicValue(key, fieldKey)
+			data = self.buildDeterministicValue(state, key, fieldKey)
 		} else {
 			// fill with random data
-			data = RandomBytes(self.fieldLengthGenerator.NextInt())
+			data = RandomBytesFrom(state.random, state.fieldLengthGenerator.NextIntFrom(state.random))
 		}
 		ret[fieldKey] = data
 	}
@@ -452,8 +562,8 @@ func javaStringHashcode(b []byte) int64 {
 }
 
 // Build a deterministic value given the key information.
-func (self *CoreWorkload) buildDeterministicValue(key string, fieldKey string) []byte {
-	size := self.fieldLengthGenerator.NextInt()
+func (self *CoreWorkload) buildDeterministicValue(state *coreRoutineState, key string, fieldKey string) []byte {
+	size := state.fieldLengthGenerator.NextIntFrom(state.random)
 	buf := bytes.NewBuffer(make([]byte, 0, size))
 	buf.WriteString(key)
 	buf.WriteString(":")
@@ -472,15 +582,60 @@ func (self *CoreWorkload) buildDeterministicValue(key string, fieldKey string) [
 // for each other, and it will be difficult to reach the target throughput.
 // Ideally, this function would have no side effects other than DB operations.
 func (self *CoreWorkload) DoInsert(db DB, object interface{}) bool {
+	state := routineState(object)
 	keyNumber := self.keySequence.NextInt()
 	dbKey := self.buildKeyName(keyNumber)
-	values := self.buildValues(dbKey)
+	values := self.buildValues(state, dbKey)
+	return self.insertWithRetry(state, func() StatusType {
+		return db.Insert(self.table, dbKey, values)
+	})
+}
 
+// Do one batched insert operation of at most count records. The batch size
+// is configured by the "batchsize" property. The records are inserted in
+// one operation if db supports it, otherwise one by one.
+func (self *CoreWorkload) DoBatchInsert(db DB, object interface{}, count int64) (int64, bool) {
+	n := self.batchSize
+	if (count > 0) && (count < n) {
+		n = count
+	}
+	if n <= 1 {
+		return 1, self.DoInsert(db, object)
+	}
+	batchDB, ok := asNativeBatchDB(db)
+	if !ok {
+		// insert the records one by one so that a failed record is retried
+		// alone, rather than the whole batch
+		for i := int64(0); i < n; i++ {
+			if !self.DoInsert(db, object) {
+				return i, false
+			}
+		}
+		return n, true
+	}
+	state := routineState(object)
+	keys := make([]string, 0, n)
+	values := make([]KVMap, 0, n)
+	for i := int64(0); i < n; i++ {
+		dbKey := self.buildKeyName(self.keySequence.NextInt())
+		keys = append(keys, dbKey)
+		values = append(values, self.buildValues(state, dbKey))
+	}
+	ok = self.insertWithRetry(state, func() StatusType {
+		return batchDB.BatchInsert(self.table, keys, values)
+	})
+	if !ok {
+		return 0, false
+	}
+	return n, true
+}
+
+// Do the insertion, and retry it if it fails and retry is configured.
+func (self *CoreWorkload) insertWithRetry(state *coreRoutineState, insert func() StatusType) bool {
 	var status StatusType
 	numberOfRetries := int64(0)
-	var random *rand.Rand
 	for {
-		status = db.Insert(self.table, dbKey, values)
+		status = insert()
 		if status == StatusOK {
 			break
 		}
@@ -489,12 +644,9 @@ func (self *CoreWorkload) DoInsert(db DB, object interface{}) bool {
 		// an insertion retry limit(default is 0) to enable retry.
 		numberOfRetries++
 		if numberOfRetries < self.insertionRetryLimit {
-			if random == nil {
-				random = rand.New(rand.NewSource(time.Now().UnixNano()))
-			}
 			// sleep for a random number between
 			// [0.8, 1.2) * InsertionRetryInterval
-			sleepTime := int64(float64(1000*self.insertionRetryInterval) * (0.8 + 0.4*random.Float64()))
+			sleepTime := int64(float64(1000*self.insertionRetryInterval) * (0.8 + 0.4*state.random.Float64()))
 			time.Sleep(time.Duration(sleepTime))
 		} else {
 			// error inserting, not retrying any more
@@ -510,35 +662,41 @@ func (self *CoreWorkload) DoInsert(db DB, object interface{}) bool {
 // for each other, and it will be difficult to reach the target throughput.
 // Ideally, this function would have no side effects other than DB operations.
 func (self *CoreWorkload) DoTransaction(db DB, object interface{}) bool {
-	op := self.operationChooser.NextString()
+	state := routineState(object)
+	if self.transactional {
+		return self.DoTransactionBundle(db, state)
+	}
+	op := state.operationChooser.NextStringFrom(state.random)
 	switch op {
 	case "READ":
-		self.DoTransactionRead(db)
+		self.DoTransactionRead(db, state)
 	case "UPDATE":
-		self.DoTransactionUpdate(db)
+		self.DoTransactionUpdate(db, state)
 	case "INSERT":
-		self.DoTransactionInsert(db)
+		self.DoTransactionInsert(db, state)
 	case "SCAN":
-		self.DoTransactionScan(db)
+		self.DoTransactionScan(db, state)
+	case "MULTIREAD":
+		self.DoTransactionMultiRead(db, state)
 	default:
-		self.DoTransactionReadModifyWrite(db)
+		self.DoTransactionReadModifyWrite(db, state)
 	}
 	return true
 }
 
-func (self *CoreWorkload) nextKeyNumber() int64 {
+func (self *CoreWorkload) nextKeyNumber(state *coreRoutineState) int64 {
 	var ret int64
-	c, ok := self.keyChooser.(*g.ExponentialGenerator)
+	c, ok := state.keyChooser.(*g.ExponentialGenerator)
 	if ok {
 		for {
-			ret = self.transactionInsertKeySequence.LastInt() - c.NextInt()
+			ret = self.transactionInsertKeySequence.LastInt() - c.NextIntFrom(state.random)
 			if ret >= 0 {
 				break
 			}
 		}
 	} else {
 		for {
-			ret = self.keyChooser.NextInt()
+			ret = state.keyChooser.NextIntFrom(state.random)
 			if ret <= self.transactionInsertKeySequence.LastInt() {
 				break
 			}
@@ -553,7 +711,7 @@ func (self *CoreWorkload) nextKeyNumber() int64 {
 // Bucket 0 means the expected data was returned.
 // Bucket 1 means incorrect data was returned.
 // Bucket 2 means null data was returned when some data was expected.
-func (self *CoreWorkload) verifyRow(key string, cells KVMap) {
+func (self *CoreWorkload) verifyRow(state *coreRoutineState, key string, cells KVMap) {
 	status := StatusOK
 	startTime := NowMS()
 	if (cells == nil) || len(cells) == 0 {
@@ -561,7 +719,7 @@ func (self *CoreWorkload) verifyRow(key string, cells KVMap) {
 		status = StatusError
 	} else {
 		for k, v := range cells {
-			if bytes.Compare(v, self.buildDeterministicValue(key, k)) != 0 {
+			if bytes.Compare(v, self.buildDeterministicValue(state, key, k)) != 0 {
 				status = StatusUnexpectedState
 				break
 			}
@@ -572,14 +730,14 @@ func (self *CoreWorkload) verifyRow(key string, cells KVMap) {
 	self.measurements.ReportStatus("VERIFY", status)
 }
 
-func (self *CoreWorkload) DoTransactionRead(db DB) {
+func (self *CoreWorkload) DoTransactionRead(db DB, state *coreRoutineState) {
 	// choose a random key
-	keyNumber := self.nextKeyNumber()
+	keyNumber := self.nextKeyNumber(state)
 	keyName := self.buildKeyName(keyNumber)
 	var fields []string
 	if !self.readAllFields {
 		// read a random field
-		fieldName := self.fieldNames[self.fieldChooser.NextInt()]
+		fieldName := self.fieldNames[state.fieldChooser.NextIntFrom(state.random)]
 		fields = []string{fieldName}
 	} else if self.dataIntegrity {
 		// pass the full field list if dataIntegrity is on for verification
@@ -587,27 +745,63 @@ func (self *CoreWorkload) DoTransactionRead(db DB) {
 	}
 	ret, _ := db.Read(self.table, keyName, fields)
 	if self.dataIntegrity {
-		self.verifyRow(keyName, ret)
+		self.verifyRow(state, keyName, ret)
 	}
 }
 
-func (self *CoreWorkload) DoTransactionReadModifyWrite(db DB) {
+func (self *CoreWorkload) DoTransactionMultiRead(db DB, state *coreRoutineState) {
+	// choose a batch of random keys
+	keyNames := make([]string, 0, self.batchSize)
+	for i := int64(0); i < self.batchSize; i++ {
+		keyNames = append(keyNames, self.buildKeyName(self.nextKeyNumber(state)))
+	}
+	var fields []string
+	if !self.readAllFields {
+		// read a random field
+		fieldName := self.fieldNames[state.fieldChooser.NextIntFrom(state.random)]
+		fields = []string{fieldName}
+	} else if self.dataIntegrity {
+		// pass the full field list if dataIntegrity is on for verification
+		fields = self.fieldNames
+	}
+	var ret []KVMap
+	if batchDB, ok := db.(BatchDB); ok {
+		ret, _ = batchDB.MultiRead(self.table, keyNames, fields)
+	} else {
+		ret = make([]KVMap, 0, len(keyNames))
+		for _, keyName := range keyNames {
+			values, _ := db.Read(self.table, keyName, fields)
+			ret = append(ret, values)
+		}
+	}
+	if self.dataIntegrity {
+		for i, keyName := range keyNames {
+			var values KVMap
+			if i < len(ret) {
+				values = ret[i]
+			}
+			self.verifyRow(state, keyName, values)
+		}
+	}
+}
+
+func (self *CoreWorkload) DoTransactionReadModifyWrite(db DB, state *coreRoutineState) {
 	// choose a random key
-	keyNumber := self.nextKeyNumber()
+	keyNumber := self.nextKeyNumber(state)
 	keyName := self.buildKeyName(keyNumber)
 	fields := make([]string, 0)
 	if !self.readAllFields {
 		// read a random field
-		fieldName := self.fieldNames[self.fieldChooser.NextInt()]
+		fieldName := self.fieldNames[state.fieldChooser.NextIntFrom(state.random)]
 		fields = []string{fieldName}
 	}
 	values := make(KVMap)
 	if !self.writeAllFields {
 		// new data for all the fields
-		values = self.buildValues(keyName)
+		values = self.buildValues(state, keyName)
 	} else {
 		// update a random field
-		values = self.buildSingleValue(keyName)
+		values = self.buildSingleValue(state, keyName)
 	}
 
 	// do the transaction
@@ -616,49 +810,133 @@ func (self *CoreWorkload) DoTransactionReadModifyWrite(db DB) {
 	db.Update(self.table, keyName, values)
 	endTime := NowMS()
 	if self.dataIntegrity {
-		self.verifyRow(keyName, ret)
+		self.verifyRow(state, keyName, ret)
 	}
 	self.measurements.Measure("READ-MODIFY-WRITE", endTime-startTime)
 }
 
-func (self *CoreWorkload) DoTransactionScan(db DB) {
+func (self *CoreWorkload) DoTransactionScan(db DB, state *coreRoutineState) {
 	// choose a random key
-	keyNumber := self.nextKeyNumber()
+	keyNumber := self.nextKeyNumber(state)
 	startKeyName := self.buildKeyName(keyNumber)
 	fields := make([]string, 0)
-	length := self.scanLengthChooser.NextInt()
+	length := state.scanLengthChooser.NextIntFrom(state.random)
 	if !self.readAllFields {
 		// read a random field
-		fieldName := self.fieldNames[self.fieldChooser.NextInt()]
+		fieldName := self.fieldNames[state.fieldChooser.NextIntFrom(state.random)]
 		fields = []string{fieldName}
 	}
 	db.Scan(self.table, startKeyName, length, fields)
 }
 
-func (self *CoreWorkload) DoTransactionUpdate(db DB) {
+func (self *CoreWorkload) DoTransactionUpdate(db DB, state *coreRoutineState) {
 	// choose a random key
-	keyNumber := self.nextKeyNumber()
+	keyNumber := self.nextKeyNumber(state)
 	keyName := self.buildKeyName(keyNumber)
 	values := make(KVMap)
 	if !self.writeAllFields {
 		// new data for all the fields
-		values = self.buildValues(keyName)
+		values = self.buildValues(state, keyName)
 	} else {
 		// update a random field
-		values = self.buildSingleValue(keyName)
+		values = self.buildSingleValue(state, keyName)
 	}
 	db.Update(self.table, keyName, values)
 }
 
-func (self *CoreWorkload) DoTransactionInsert(db DB) {
+func (self *CoreWorkload) DoTransactionInsert(db DB, state *coreRoutineState) {
 	// choose the next key
 	keyNumber := self.transactionInsertKeySequence.NextInt()
 	keyName := self.buildKeyName(keyNumber)
-	values := self.buildValues(keyName)
+	values := self.buildValues(state, keyName)
 	db.Insert(self.table, keyName, values)
 	self.transactionInsertKeySequence.Acknowledge(keyNumber)
 }
 
+// Do one database transaction which bundles transactionreads reads and
+// transactionwrites updates of random records. It's committed if all
+// the operations succeed, and aborted otherwise.
+// The latencies of committed and aborted transactions are measured
+// separately, and the commits and aborts are counted.
+func (self *CoreWorkload) DoTransactionBundle(db DB, state *coreRoutineState) bool {
+	txDB, ok := db.(TransactionalDB)
+	if !ok {
+		Errorf("database doesn't support transactions")
+		return false
+	}
+	startTime := NowNS()
+	status := txDB.Begin()
+	if status != StatusOK {
+		self.measurements.ReportStatus("TRANSACTION", status)
+		if status == StatusNotImplemented {
+			Errorf("database doesn't support transactions")
+			return false
+		}
+		return true
+	}
+	status = self.doBundledOperations(db, state)
+	if status == StatusOK {
+		status = txDB.Commit()
+	} else {
+		txDB.Abort()
+	}
+	endTime := NowNS()
+	latency := NanosecondToMicrosecond(endTime - startTime)
+	if status == StatusOK {
+		self.measurements.Measure("TRANSACTION", latency)
+		self.measurements.Count("TRANSACTION", "Commits", 1)
+	} else {
+		self.measurements.Measure("TRANSACTION-ABORTED", latency)
+		self.measurements.Count("TRANSACTION", "Aborts", 1)
+	}
+	self.measurements.ReportStatus("TRANSACTION", status)
+	return true
+}
+
+// Do the reads and then the writes of one transaction, and stop at
+// the first failed one. A read of a record which is not found doesn't fail
+// the transaction, like a read outside of transactions.
+func (self *CoreWorkload) doBundledOperations(db DB, state *coreRoutineState) StatusType {
+	for i := int64(0); i < self.transactionReads; i++ {
+		keyName := self.buildKeyName(self.nextKeyNumber(state))
+		var fields []string
+		if !self.readAllFields {
+			// read a random field
+			fieldName := self.fieldNames[state.fieldChooser.NextIntFrom(state.random)]
+			fields = []string{fieldName}
+		} else if self.dataIntegrity {
+			// pass the full field list if dataIntegrity is on for verification
+			fields = self.fieldNames
+		}
+		ret, status := db.Read(self.table, keyName, fields)
+		if status == StatusNotFound {
+			continue
+		}
+		if status != StatusOK {
+			return status
+		}
+		if self.dataIntegrity {
+			self.verifyRow(state, keyName, ret)
+		}
+	}
+	for i := int64(0); i < self.transactionWrites; i++ {
+		keyName := self.buildKeyName(self.nextKeyNumber(state))
+		var values KVMap
+		if !self.writeAllFields {
+			// new data for all the fields
+			values = self.buildValues(state, keyName)
+		} else {
+			// update a random field
+			values = self.buildSingleValue(state, keyName)
+		}
+		status := db.Update(self.table, keyName, values)
+		if status != StatusOK {
+			return status
+		}
+	}
+	return StatusOK
+}
+
 // A disk-fragmenting workload.
 // Properties to control the client:
 // disksize: how many bytes of storage can the disk store? (default 100,000,000)
@@ -0,0 +1,319 @@
+package yabf
+
+import (
+	"fmt"
+	"github.com/hhkbp2/testify/require"
+	"sync"
+	"testing"
+)
+
+// A DB which records the operations issued to it.
+type recordingDB struct {
+	*BasicDB
+	ops []string
+}
+
+func (self *recordingDB) Read(table string, key string, fields []string) (KVMap, StatusType) {
+	self.ops = append(self.ops, fmt.Sprintf("READ %s %v", key, fields))
+	return nil, StatusOK
+}
+
+func (self *recordingDB) Scan(table string, startKey string, recordCount int64, fields []string) ([]KVMap, StatusType) {
+	self.ops = append(self.ops, fmt.Sprintf("SCAN %s %d %v", startKey, recordCount, fields))
+	return nil, StatusOK
+}
+
+func (self *recordingDB) Update(table string, key string, values KVMap) StatusType {
+	self.ops = append(self.ops, fmt.Sprintf("UPDATE %s %v", key, values))
+	return StatusOK
+}
+
+func (self *recordingDB) Insert(table string, key string, values KVMap) StatusType {
+	self.ops = append(self.ops, fmt.Sprintf("INSERT %s %v", key, values))
+	return StatusOK
+}
+
+// Run the transactions of a routine of CoreWorkload, and return
+// the operations it issues.
+func runSeededWorkload(t *testing.T, seed string, routine int64) []string {
+	props := NewProperties()
+	props.Add(PropertyRecordCount, "1000")
+	props.Add(PropertyOperationCount, "100")
+	props.Add(PropertyReadProportion, "0.5")
+	props.Add(PropertyUpdateProportion, "0.3")
+	props.Add(PropertyScanProportion, "0.2")
+	props.Add(PropertyReadAllFields, "false")
+	props.Add(PropertyRequestDistribution, "zipfian")
+	props.Add(PropertySeed, seed)
+	workload := NewCoreWorkload()
+	require.Nil(t, workload.Init(props))
+	random, err := NewRandomStream(props, routine)
+	require.Nil(t, err)
+	state, err := workload.InitRoutine(props, random)
+	require.Nil(t, err)
+	db := &recordingDB{BasicDB: NewBasicDB()}
+	for i := 0; i < 100; i++ {
+		require.True(t, workload.DoTransaction(db, state))
+	}
+	return db.ops
+}
+
+func TestCoreWorkloadSeed(t *testing.T) {
+	ops := runSeededWorkload(t, "42", 0)
+	require.Equal(t, 100, len(ops))
+	// the same seed replays the same operations
+	require.Equal(t, ops, runSeededWorkload(t, "42", 0))
+	// but other routines and seeds don't
+	require.NotEqual(t, ops, runSeededWorkload(t, "42", 1))
+	require.NotEqual(t, ops, runSeededWorkload(t, "43", 0))
+	kinds := make(map[string]bool)
+	for _, op := range ops {
+		kinds[op[:4]] = true
+	}
+	require.Equal(t, 3, len(kinds))
+}
+
+// A DB which does nothing.
+type nopDB struct {
+	*BasicDB
+}
+
+func (self *nopDB) Read(table string, key string, fields []string) (KVMap, StatusType) {
+	return nil, StatusOK
+}
+
+func (self *nopDB) Update(table string, key string, values KVMap) StatusType {
+	return StatusOK
+}
+
+// Run the transactions of CoreWorkload in threadcount routines, each of
+// which draws from its own generators. The time per operation should stay
+// flat as threadcount grows, as long as there are enough CPUs.
+func BenchmarkCoreWorkloadTransaction(b *testing.B) {
+	for _, threadCount := range []int{1, 16, 256, 4096} {
+		b.Run(fmt.Sprintf("threadcount=%d", threadCount), func(b *testing.B) {
+			props := NewProperties()
+			props.Add(PropertyRecordCount, "1000000")
+			props.Add(PropertyOperationCount, "1000000")
+			props.Add(PropertyRequestDistribution, "zipfian")
+			workload := NewCoreWorkload()
+			require.Nil(b, workload.Init(props))
+			states := make([]interface{}, 0, threadCount)
+			for i := 0; i < threadCount; i++ {
+				random, err := NewRandomStream(props, int64(i))
+				require.Nil(b, err)
+				state, err := workload.InitRoutine(props, random)
+				require.Nil(b, err)
+				states = append(states, state)
+			}
+			db := &nopDB{BasicDB: NewBasicDB()}
+			b.ResetTimer()
+			var group sync.WaitGroup
+			for i, state := range states {
+				n := b.N / threadCount
+				if i < b.N%threadCount {
+					n++
+				}
+				group.Add(1)
+				go func(state interface{}, n int) {
+					defer group.Done()
+					for j := 0; j < n; j++ {
+						workload.DoTransaction(db, state)
+					}
+				}(state, n)
+			}
+			group.Wait()
+		})
+	}
+}
+
+// A MemoryDB without the batch operations, which fails the insertion of
+// the specified records once.
+type flakyInsertDB struct {
+	DB
+	failures map[string]bool
+}
+
+func (self *flakyInsertDB) Insert(table string, key string, values KVMap) StatusType {
+	if self.failures[key] {
+		delete(self.failures, key)
+		return StatusServiceUnavailable
+	}
+	return self.DB.Insert(table, key, values)
+}
+
+func newTestBatchWorkload(t *testing.T, retryLimit string) (*CoreWorkload, interface{}) {
+	props := NewProperties()
+	props.Add(PropertyRecordCount, "10")
+	props.Add(PropertyBatchSize, "4")
+	props.Add(PropertyMultiReadProportion, "1")
+	props.Add(PropertyReadProportion, "0")
+	props.Add(PropertyUpdateProportion, "0")
+	props.Add(PropertyDataIntegrity, "true")
+	props.Add(InsertionRetryLimit, retryLimit)
+	props.Add(InsertionRetryInterval, "0")
+	workload := NewCoreWorkload()
+	require.Nil(t, workload.Init(props))
+	random, err := NewRandomStream(props, 0)
+	require.Nil(t, err)
+	state, err := workload.InitRoutine(props, random)
+	require.Nil(t, err)
+	return workload, state
+}
+
+func TestCoreWorkloadBatchInsert(t *testing.T) {
+	resetMemoryTables()
+	ResetMeasurements()
+	defer ResetMeasurements()
+	workload, state := newTestBatchWorkload(t, "0")
+	db := NewDBWrapper(NewMemoryDB())
+	n, ok := workload.DoBatchInsert(db, state, 10)
+	require.True(t, ok)
+	require.Equal(t, int64(4), n)
+	n, ok = workload.DoBatchInsert(db, state, 2)
+	require.True(t, ok)
+	require.Equal(t, int64(2), n)
+	require.Equal(t, int64(6), GetMeasurements().GetCount("BATCH-INSERT", "Records"))
+	require.Equal(t, int64(6), getMemoryTable(PropertyTableNameDefault).length)
+}
+
+// The records are inserted one by one if the DB doesn't support batches,
+// so that only the failed one is retried.
+func TestCoreWorkloadBatchInsertFallback(t *testing.T) {
+	resetMemoryTables()
+	ResetMeasurements()
+	defer ResetMeasurements()
+	workload, state := newTestBatchWorkload(t, "2")
+	inner := &flakyInsertDB{
+		DB:       NewMemoryDB(),
+		failures: map[string]bool{workload.buildKeyName(2): true},
+	}
+	db := NewDBWrapper(inner)
+	n, ok := workload.DoBatchInsert(db, state, 10)
+	require.True(t, ok)
+	require.Equal(t, int64(4), n)
+	require.Equal(t, int64(4), getMemoryTable(PropertyTableNameDefault).length)
+	codes := GetMeasurements().Lookup("INSERT").GetReturnCodes()
+	require.Equal(t, uint32(4), codes[StatusOK])
+	require.Equal(t, uint32(1), codes[StatusServiceUnavailable])
+	require.Equal(t, uint32(0), codes[StatusError])
+
+	// without retry, the records inserted before the failure are counted
+	workload.insertionRetryLimit = 0
+	inner.failures[workload.buildKeyName(6)] = true
+	n, ok = workload.DoBatchInsert(db, state, 10)
+	require.False(t, ok)
+	require.Equal(t, int64(2), n)
+}
+
+func TestCoreWorkloadMultiRead(t *testing.T) {
+	resetMemoryTables()
+	ResetMeasurements()
+	defer ResetMeasurements()
+	for _, db := range []DB{NewDBWrapper(NewMemoryDB()), NewDBWrapper(&flakyInsertDB{DB: NewMemoryDB()})} {
+		workload, state := newTestBatchWorkload(t, "0")
+		for i := 0; i < 10; i++ {
+			require.True(t, workload.DoInsert(db, state))
+		}
+		for i := 0; i < 10; i++ {
+			require.True(t, workload.DoTransaction(db, state))
+		}
+		resetMemoryTables()
+	}
+	measurements := GetMeasurements()
+	require.Equal(t, int64(40), measurements.GetCount("MULTI-READ", "Records"))
+	// the DB without batches reads the records one by one
+	require.Equal(t, uint32(40), measurements.Lookup("READ").GetReturnCodes()[StatusOK])
+	codes := measurements.Lookup("VERIFY").GetReturnCodes()
+	require.Equal(t, 1, len(codes))
+	require.Equal(t, uint32(80), codes[StatusOK])
+}
+
+// A MemoryDB with fake transactions, which fails the updates if
+// failUpdates is set.
+type fakeTxDB struct {
+	DB
+	failUpdates bool
+	ops         []string
+}
+
+func (self *fakeTxDB) Update(table string, key string, values KVMap) StatusType {
+	if self.failUpdates {
+		return StatusError
+	}
+	return self.DB.Update(table, key, values)
+}
+
+func (self *fakeTxDB) Begin() StatusType {
+	self.ops = append(self.ops, "BEGIN")
+	return StatusOK
+}
+
+func (self *fakeTxDB) Commit() StatusType {
+	self.ops = append(self.ops, "COMMIT")
+	return StatusOK
+}
+
+func (self *fakeTxDB) Abort() StatusType {
+	self.ops = append(self.ops, "ABORT")
+	return StatusOK
+}
+
+func newTestTransactionalWorkload(t *testing.T, props Properties) (*CoreWorkload, interface{}, error) {
+	props.Add(PropertyRecordCount, "10")
+	props.Add(PropertyTransactional, "true")
+	props.Add(PropertyTransactionReads, "2")
+	props.Add(PropertyTransactionWrites, "1")
+	props.Add(PropertyDataIntegrity, "true")
+	workload := NewCoreWorkload()
+	if err := workload.Init(props); err != nil {
+		return nil, nil, err
+	}
+	random, err := NewRandomStream(props, 0)
+	require.Nil(t, err)
+	state, err := workload.InitRoutine(props, random)
+	require.Nil(t, err)
+	return workload, state, nil
+}
+
+func TestCoreWorkloadTransactionBundle(t *testing.T) {
+	resetMemoryTables()
+	ResetMeasurements()
+	defer ResetMeasurements()
+	workload, state, err := newTestTransactionalWorkload(t, NewProperties())
+	require.Nil(t, err)
+	inner := &fakeTxDB{DB: NewMemoryDB()}
+	db := NewDBWrapper(inner)
+	// the records are missing and the reads are not found, which doesn't
+	// abort the transactions without writes
+	workload.transactionWrites = 0
+	require.True(t, workload.DoTransaction(db, state))
+	require.Equal(t, uint32(2), GetMeasurements().Lookup("READ").GetReturnCodes()[StatusNotFound])
+
+	for i := 0; i < 10; i++ {
+		require.True(t, workload.DoInsert(db, state))
+	}
+	workload.transactionWrites = 1
+	require.True(t, workload.DoTransaction(db, state))
+	inner.failUpdates = true
+	require.True(t, workload.DoTransaction(db, state))
+	require.Equal(t, []string{"BEGIN", "COMMIT", "BEGIN", "COMMIT", "BEGIN", "ABORT"}, inner.ops)
+	measurements := GetMeasurements()
+	require.Equal(t, int64(2), measurements.GetCount("TRANSACTION", "Commits"))
+	require.Equal(t, int64(1), measurements.GetCount("TRANSACTION", "Aborts"))
+	require.Equal(t, uint32(4), measurements.Lookup("VERIFY").GetReturnCodes()[StatusOK])
+
+	// the DB has to support transactions
+	require.False(t, workload.DoTransaction(NewDBWrapper(NewMemoryDB()), state))
+}
+func TestCoreWorkloadTransactionalProportions(t *testing.T) {
+	props := NewProperties()
+	props.Add(PropertyScanProportion, "0.1")
+	_, _, err := newTestTransactionalWorkload(t, props)
+	require.NotNil(t, err)
+	props = NewProperties()
+	props.Add(PropertyReadProportion, "0.5")
+	props.Add(PropertyUpdateProportion, "0.5")
+	_, _, err = newTestTransactionalWorkload(t, props)
+	require.Nil(t, err)
+}